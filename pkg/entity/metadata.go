@@ -76,6 +76,20 @@ func (e Metadata) GetTenant() string {
 	return e.Tenant
 }
 
+// GetVersion returns the version of the entity.
+func (e Metadata) GetVersion() int {
+	return e.Version
+}
+
+// Touch updates the metadata to the next version of the entity, as CloneIn does.
+// Returns a function that restores the previous metadata, i.e. when the new version cannot be stored.
+func (e *Metadata) Touch(ctx context.Context, now time.Time) (restore func()) {
+	previous := *e
+	*e = e.CloneIn(ctx, now)
+
+	return func() { *e = previous }
+}
+
 // Clone returns a clone of the entity with a new ID and CreatedAt if necessary. Updates UpdatedAt.
 func (e Metadata) Clone(now time.Time) Metadata {
 	return Metadata{
@@ -138,3 +138,36 @@ func Test_NewInAt(t *testing.T) {
 	// AND should have the given tenant
 	assert.Equal(t, "tenant", m.Tenant)
 }
+
+func TestMetadata_Touch(t *testing.T) {
+	// GIVEN a new entity metadata
+	now := time.Now()
+	ctxWithTenant := context.WithValue(context.Background(), xcontext.TenantCtxKey, "tenant")
+
+	m := Metadata{}
+
+	// WHEN touched
+	m.Touch(ctxWithTenant, now)
+
+	// THEN should be the first version
+	assert.NotEmpty(t, m.ID)
+	assert.Equal(t, 1, m.GetVersion())
+	assert.Equal(t, now, m.CreatedAt)
+
+	// AND should have the tenant of the context
+	assert.Equal(t, "tenant", m.Tenant)
+}
+
+func TestMetadata_Touch_restore(t *testing.T) {
+	// GIVEN a stored entity metadata
+	m := New(At(time.Now()), WithTenant("tenant"))
+	m.Version = 3
+	previous := m
+
+	// WHEN touched and restored
+	restore := m.Touch(context.Background(), time.Now().Add(time.Minute))
+	restore()
+
+	// THEN should be the previous metadata
+	assert.Equal(t, previous, m)
+}
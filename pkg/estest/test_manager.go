@@ -0,0 +1,306 @@
+package estest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/aggregatestore/events"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/nsf/jsondiff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManager is helper to test event sourced aggregates and projectors with a Given/When/Then DSL.
+//
+//	estest.For(t).
+//		Given().Aggregate(NewAccount(id)).Event(AccountOpened, &OpenedData{}).
+//		When().Command(&Deposit{ID: id, Amount: 10}).
+//		Then().NoError().EventsAre(estest.Event(Deposited, &DepositedData{Amount: 10}))
+//
+// Past events are applied to the aggregate and projected to the read model, if given. The events emitted by the
+// command are applied and projected too, as the aggregate store and the event bus would do.
+type TestManager struct {
+	t             *testing.T
+	ctx           context.Context
+	now           time.Time
+	aggregateType eh.AggregateType
+	aggregateID   uuid.UUID
+	version       int
+	aggregate     events.VersionedAggregate
+	projector     eh.EventHandler
+	repo          eh.ReadRepo
+	emitted       []eh.Event
+	actualErr     error
+}
+
+type GivenWrapper struct {
+	tm *TestManager
+}
+
+type WhenWrapper struct {
+	tm *TestManager
+}
+
+type ThenWrapper struct {
+	tm *TestManager
+}
+
+// ExpectedEvent is an event expected to be emitted, as built by Event
+type ExpectedEvent struct {
+	EventType eh.EventType `json:"eventType"`
+	Data      interface{}  `json:"data,omitempty"`
+}
+
+// Event builds an expected event with the given type and data
+func Event(eventType eh.EventType, data eh.EventData) ExpectedEvent {
+	return ExpectedEvent{EventType: eventType, Data: data}
+}
+
+// For builds a test manager using the provided test context T
+func For(t *testing.T) *TestManager {
+	return &TestManager{t: t, ctx: context.Background(), now: time.Now()}
+}
+
+// Given returns the GIVEN builder. It allows to define the aggregate, projector and past events for the test
+func (m *TestManager) Given() *GivenWrapper {
+	return &GivenWrapper{m}
+}
+
+// When returns the WHEN builder. It allows to handle the command or events under test
+func (m *TestManager) When() *WhenWrapper {
+	return &WhenWrapper{m}
+}
+
+// Then returns the THEN builder. It allows to verify the expectations (post conditions) for the test
+func (m *TestManager) Then() *ThenWrapper {
+	return &ThenWrapper{m}
+}
+
+// Json allows to define the expected events or read model from JSON in a string.
+func (m *TestManager) Json(jsonStr string) interface{} {
+	return bytesHolder{[]byte(jsonStr)}
+}
+
+func (m *TestManager) addErr(err error) {
+	if err != nil {
+		m.t.Error(err)
+	}
+}
+
+// apply applies the event to the aggregate, if any, and projects it to the read model, if any.
+// Returns the projection error.
+func (m *TestManager) apply(event eh.Event) error {
+	if m.aggregate != nil {
+		m.addErr(m.aggregate.ApplyEvent(m.ctx, event))
+		m.aggregate.SetAggregateVersion(event.Version())
+	}
+
+	m.version = event.Version()
+
+	if m.projector == nil {
+		return nil
+	}
+
+	return m.projector.HandleEvent(m.ctx, event)
+}
+
+// Aggregate sets the aggregate under test. Past events and commands are applied to it.
+func (g *GivenWrapper) Aggregate(aggregate events.VersionedAggregate) *GivenWrapper {
+	g.tm.aggregate = aggregate
+	g.tm.aggregateType = aggregate.AggregateType()
+	g.tm.aggregateID = aggregate.EntityID()
+	g.tm.version = aggregate.AggregateVersion()
+	return g
+}
+
+// ForAggregate sets the aggregate type and id of the events created with Event, when there is no aggregate under test
+func (g *GivenWrapper) ForAggregate(aggregateType eh.AggregateType, id uuid.UUID) *GivenWrapper {
+	g.tm.aggregateType = aggregateType
+	g.tm.aggregateID = id
+	return g
+}
+
+// Projector sets the projector under test, and the repo where it saves the read models.
+func (g *GivenWrapper) Projector(projector eh.EventHandler, repo eh.ReadRepo) *GivenWrapper {
+	g.tm.projector = projector
+	g.tm.repo = repo
+	return g
+}
+
+// Context sets the context used to handle the commands and events. Used to set current user, tenant, etc.
+func (g *GivenWrapper) Context(ctx context.Context) *GivenWrapper {
+	g.tm.ctx = ctx
+	return g
+}
+
+// Now sets the timestamp of the events created with Event
+func (g *GivenWrapper) Now(now time.Time) *GivenWrapper {
+	g.tm.now = now
+	return g
+}
+
+// Events applies the given past events
+func (g *GivenWrapper) Events(events ...eh.Event) *GivenWrapper {
+	for _, event := range events {
+		g.tm.addErr(g.tm.apply(event))
+	}
+	return g
+}
+
+// Event applies a past event with the given type and data, for the aggregate under test and with the next version.
+func (g *GivenWrapper) Event(eventType eh.EventType, data eh.EventData, options ...eh.EventOption) *GivenWrapper {
+	options = append(options, eh.ForAggregate(g.tm.aggregateType, g.tm.aggregateID, g.tm.version+1))
+
+	return g.Events(eh.NewEvent(eventType, data, g.tm.now, options...))
+}
+
+// When returns the WHEN builder
+func (g *GivenWrapper) When() *WhenWrapper {
+	return g.tm.When()
+}
+
+// Command handles the command with the aggregate under test. The emitted events are applied and projected.
+func (w *WhenWrapper) Command(cmd eh.Command) *WhenWrapper {
+	require.NotNil(w.tm.t, w.tm.aggregate, "no aggregate given")
+
+	w.tm.actualErr = w.tm.aggregate.HandleCommand(w.tm.ctx, cmd)
+
+	w.tm.emitted = w.tm.aggregate.UncommittedEvents()
+	w.tm.aggregate.ClearUncommittedEvents()
+
+	if w.tm.actualErr != nil {
+		return w
+	}
+
+	for _, event := range w.tm.emitted {
+		w.tm.addErr(w.tm.apply(event))
+	}
+
+	return w
+}
+
+// Events projects the events with the projector under test. The first projection error is kept as the result.
+func (w *WhenWrapper) Events(events ...eh.Event) *WhenWrapper {
+	require.NotNil(w.tm.t, w.tm.projector, "no projector given")
+
+	for _, event := range events {
+		if err := w.tm.apply(event); err != nil {
+			w.tm.actualErr = err
+			break
+		}
+	}
+
+	return w
+}
+
+// Event projects an event with the given type and data, for the aggregate under test and with the next version.
+func (w *WhenWrapper) Event(eventType eh.EventType, data eh.EventData, options ...eh.EventOption) *WhenWrapper {
+	options = append(options, eh.ForAggregate(w.tm.aggregateType, w.tm.aggregateID, w.tm.version+1))
+
+	return w.Events(eh.NewEvent(eventType, data, w.tm.now, options...))
+}
+
+// Then returns the THEN builder
+func (w *WhenWrapper) Then() *ThenWrapper {
+	return w.tm.Then()
+}
+
+// NoError verifies the command or events were handled without error
+func (t *ThenWrapper) NoError() *ThenWrapper {
+	assert.NoError(t.tm.t, t.tm.actualErr)
+	return t
+}
+
+// ErrorIs verifies the returned error wraps the expected one
+func (t *ThenWrapper) ErrorIs(expectedErr error) *ThenWrapper {
+	assert.ErrorIs(t.tm.t, t.tm.actualErr, expectedErr)
+	return t
+}
+
+// NoEvents verifies the command did not emit events
+func (t *ThenWrapper) NoEvents() *ThenWrapper {
+	assert.Empty(t.tm.t, t.tm.emitted, "unexpected events emitted")
+	return t
+}
+
+// EventsAre verifies the command emitted the expected events, in order. The types and data are compared as JSON.
+func (t *ThenWrapper) EventsAre(expected ...ExpectedEvent) *ThenWrapper {
+	if expected == nil {
+		expected = []ExpectedEvent{}
+	}
+	return t.EventsJsonAre(expected)
+}
+
+// EventsJsonAre verifies the command emitted the expected events, given as a JSON array of objects with
+// eventType and data fields, or as a value marshalled to it.
+func (t *ThenWrapper) EventsJsonAre(expected interface{}) *ThenWrapper {
+	actual := make([]ExpectedEvent, 0, len(t.tm.emitted))
+	for _, event := range t.tm.emitted {
+		actual = append(actual, Event(event.EventType(), event.Data()))
+	}
+
+	t.jsonIs(expected, actual)
+
+	return t
+}
+
+// ReadModelIs verifies the read model with the given id, as found in the projector repo, has the expected value.
+// Values are compared as JSON.
+func (t *ThenWrapper) ReadModelIs(id uuid.UUID, expected interface{}) *ThenWrapper {
+	require.NotNil(t.tm.t, t.tm.repo, "no projector given")
+
+	entity, err := t.tm.repo.Find(t.tm.ctx, id)
+	require.NoError(t.tm.t, err)
+
+	t.jsonIs(expected, entity)
+
+	return t
+}
+
+// ReadModelNotFound verifies there is no read model with the given id
+func (t *ThenWrapper) ReadModelNotFound(id uuid.UUID) *ThenWrapper {
+	require.NotNil(t.tm.t, t.tm.repo, "no projector given")
+
+	_, err := t.tm.repo.Find(t.tm.ctx, id)
+	assert.ErrorIs(t.tm.t, err, eh.ErrEntityNotFound)
+
+	return t
+}
+
+// Aggregate returns the aggregate under test, to verify its state
+func (t *ThenWrapper) Aggregate() events.VersionedAggregate {
+	return t.tm.aggregate
+}
+
+func (t *ThenWrapper) jsonIs(expected interface{}, actual interface{}) {
+	actualBytes, err := json.Marshal(actual)
+	require.NoError(t.tm.t, err)
+
+	options := jsondiff.DefaultConsoleOptions()
+	options.SkipMatches = true
+
+	differences, explanation := jsondiff.Compare(t.getExpectedBytes(expected), actualBytes, &options)
+
+	if differences != jsondiff.FullMatch {
+		assert.Fail(t.tm.t, explanation)
+	}
+}
+
+func (t *ThenWrapper) getExpectedBytes(expected interface{}) []byte {
+	if bh, ok := expected.(bytesHolder); ok {
+		return bh.bytes
+	}
+
+	expectedBytes, err := json.Marshal(expected)
+	t.tm.addErr(err)
+
+	return expectedBytes
+}
+
+type bytesHolder struct {
+	bytes []byte
+}
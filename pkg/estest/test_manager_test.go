@@ -0,0 +1,126 @@
+package estest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xeh/aggregate"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+	"github.com/looplab/eventhorizon/repo/memory"
+	"github.com/looplab/eventhorizon/uuid"
+)
+
+const (
+	counterType      = eh.AggregateType("counter")
+	incrementedEvent = eh.EventType("incremented")
+)
+
+type increment struct {
+	ID    uuid.UUID `json:"id"`
+	Delta int       `json:"delta" validate:"gt=0"`
+}
+
+func (c *increment) AggregateID() uuid.UUID          { return c.ID }
+func (c *increment) AggregateType() eh.AggregateType { return counterType }
+func (c *increment) CommandType() eh.CommandType     { return "increment" }
+
+type incrementedData struct {
+	Delta int `json:"delta"`
+}
+
+type counter struct {
+	*aggregate.Base
+	total int
+}
+
+func newCounter(id uuid.UUID) *counter {
+	c := &counter{Base: aggregate.NewBase(counterType, id)}
+	aggregate.HandleCommand(c.Base, func(ctx context.Context, cmd *increment) error {
+		c.AppendEvent(ctx, incrementedEvent, &incrementedData{Delta: cmd.Delta})
+		return nil
+	})
+	aggregate.ApplyEvent(c.Base, incrementedEvent, func(_ context.Context, data *incrementedData, _ eh.Event) error {
+		c.total += data.Delta
+		return nil
+	})
+	return c
+}
+
+type counterView struct {
+	ID      uuid.UUID `json:"id"`
+	Total   int       `json:"total"`
+	Version int       `json:"version"`
+}
+
+func (v *counterView) EntityID() uuid.UUID { return v.ID }
+
+func (v *counterView) AggregateVersion() int { return v.Version }
+
+type counterProjector struct{}
+
+func (counterProjector) ProjectorType() projector.Type { return "counter" }
+
+func (counterProjector) Project(_ context.Context, event eh.Event, entity eh.Entity) (eh.Entity, error) {
+	view := entity.(*counterView)
+	view.ID = event.AggregateID()
+	view.Total += event.Data().(*incrementedData).Delta
+	view.Version = event.Version()
+	return view, nil
+}
+
+func newCounterProjector() (eh.EventHandler, eh.ReadRepo) {
+	repo := memory.NewRepo()
+	handler := projector.NewEventHandler(counterProjector{}, repo)
+	handler.SetEntityFactory(func() eh.Entity { return &counterView{} })
+	return handler, repo
+}
+
+func TestTestManager_verifies_emitted_events_and_read_model(t *testing.T) {
+	id := uuid.New()
+	handler, repo := newCounterProjector()
+
+	m := For(t)
+
+	m.Given().
+		Aggregate(newCounter(id)).
+		Projector(handler, repo).
+		Event(incrementedEvent, &incrementedData{Delta: 2}).
+		When().
+		Command(&increment{ID: id, Delta: 3}).
+		Then().
+		NoError().
+		EventsAre(Event(incrementedEvent, &incrementedData{Delta: 3})).
+		EventsJsonAre(m.Json(`[{"eventType": "incremented", "data": {"delta": 3}}]`)).
+		ReadModelIs(id, m.Json(`{"id": "`+id.String()+`", "total": 5, "version": 2}`))
+}
+
+func TestTestManager_verifies_returned_error(t *testing.T) {
+	id := uuid.New()
+
+	For(t).
+		Given().
+		Aggregate(newCounter(id)).
+		When().
+		Command(&increment{ID: id, Delta: 0}).
+		Then().
+		ErrorIs(xerrors.ErrInvalidArgument).
+		NoEvents()
+}
+
+func TestTestManager_projects_events_without_aggregate(t *testing.T) {
+	id := uuid.New()
+	handler, repo := newCounterProjector()
+
+	For(t).
+		Given().
+		ForAggregate(counterType, id).
+		Projector(handler, repo).
+		Event(incrementedEvent, &incrementedData{Delta: 1}).
+		When().
+		Event(incrementedEvent, &incrementedData{Delta: 4}).
+		Then().
+		NoError().
+		ReadModelIs(id, counterView{ID: id, Total: 5, Version: 2})
+}
@@ -11,6 +11,9 @@ const (
 	// TenantCtxKey is the key used to store the tenant in the context. If present
 	// it will be used in case the user is not present.
 	TenantCtxKey = "x-tenant"
+	// CorrelationIdCtxKey is the key used to store the correlation ID in the context. It identifies all
+	// the actions, sync and async, caused by the same request.
+	CorrelationIdCtxKey = "x-correlation-id"
 
 	// DefaultTenant is the tenant to use if no tenant is found in the context
 	DefaultTenant = "default"
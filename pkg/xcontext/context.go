@@ -68,3 +68,14 @@ func WithTenant(ctx context.Context, tenant string) context.Context {
 func WithJwt(ctx context.Context, jwt string) context.Context {
 	return context.WithValue(ctx, JwtCtxKey, jwt)
 }
+
+// WithCorrelationId returns a new context with the correlation ID set.
+func WithCorrelationId(ctx context.Context, correlationId string) context.Context {
+	return context.WithValue(ctx, CorrelationIdCtxKey, correlationId)
+}
+
+// GetCorrelationId returns the correlation ID from the context if it exists.
+func GetCorrelationId(ctx context.Context) (correlationId string, found bool) {
+	correlationId, found = ctx.Value(CorrelationIdCtxKey).(string)
+	return correlationId, found
+}
@@ -0,0 +1,147 @@
+package aggregate
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/entity"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xvalidator"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/aggregatestore/events"
+	"github.com/looplab/eventhorizon/uuid"
+)
+
+// Base is the base for event sourced aggregates. It dispatches the commands to the handlers registered by command
+// type with HandleCommand, and the events to the appliers registered by event type with ApplyEvent, so aggregates
+// don't need to write the type switches.
+//
+// Commands are validated with xvalidator.Struct before calling the handler. The entity metadata of the aggregate
+// is updated with each applied event.
+//
+// Usage:
+//
+//	type Account struct {
+//		*aggregate.Base
+//		Balance int
+//	}
+//
+//	func NewAccount(id uuid.UUID) *Account {
+//		a := &Account{Base: aggregate.NewBase(AccountAggregateType, id)}
+//		aggregate.HandleCommand(a.Base, a.deposit)
+//		aggregate.ApplyEvent(a.Base, DepositedEvent, a.deposited)
+//		return a
+//	}
+type Base struct {
+	*events.AggregateBase
+
+	metadata entity.Metadata
+	commands map[reflect.Type]func(ctx context.Context, cmd eh.Command) error
+	appliers map[eh.EventType]func(ctx context.Context, event eh.Event) error
+	now      func() time.Time
+}
+
+var _ events.VersionedAggregate = (*Base)(nil)
+
+// NewBase creates a new aggregate base for the given aggregate type and id
+func NewBase(aggregateType eh.AggregateType, id uuid.UUID) *Base {
+	xerrors.EnsureNotEmpty(aggregateType, "aggregateType")
+
+	return &Base{
+		AggregateBase: events.NewAggregateBase(aggregateType, id),
+		metadata:      entity.New(entity.WithId(id)),
+		commands:      make(map[reflect.Type]func(ctx context.Context, cmd eh.Command) error),
+		appliers:      make(map[eh.EventType]func(ctx context.Context, event eh.Event) error),
+		now:           time.Now,
+	}
+}
+
+// HandleCommand registers the handler for the commands of type C. Registering a second handler for the same type
+// replaces the previous one.
+func HandleCommand[C eh.Command](b *Base, handler func(ctx context.Context, cmd C) error) {
+	b.commands[typeOf[C]()] = func(ctx context.Context, cmd eh.Command) error {
+		return handler(ctx, cmd.(C))
+	}
+}
+
+// ApplyEvent registers the applier for the events of the event type, with data of type D. Events without data are
+// applied with the zero value of D, use eh.EventData as D for them. Registering a second applier for the same event
+// type replaces the previous one.
+func ApplyEvent[D eh.EventData](b *Base, eventType eh.EventType, applier func(ctx context.Context, data D, event eh.Event) error) {
+	b.appliers[eventType] = func(ctx context.Context, event eh.Event) error {
+		var data D
+
+		if event.Data() != nil {
+			var ok bool
+			if data, ok = event.Data().(D); !ok {
+				return xerrors.NewInvalidEventTypeError(b.AggregateType().String(), "unexpected data %T for event %s", event.Data(), eventType)
+			}
+		}
+
+		return applier(ctx, data, event)
+	}
+}
+
+// HandleCommand implements the eh.CommandHandler interface.
+// Returns an invalid argument error if the command is not valid or there is no handler for it.
+func (b *Base) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	handler, found := b.commands[reflect.TypeOf(cmd)]
+	if !found {
+		return xerrors.NewInvalidArgumentError(b.AggregateType().String(), "unsupported command %s", cmd.CommandType())
+	}
+
+	if err := xvalidator.Struct(cmd); err != nil {
+		return xerrors.NewInvalidArgumentError(cmd.CommandType().String(), "%s", err)
+	}
+
+	return handler(ctx, cmd)
+}
+
+// ApplyEvent implements the events.VersionedAggregate interface, applying the event to the aggregate and updating
+// its metadata. Returns an invalid event type error if there is no applier for the event type, or its data is not of
+// the type of the applier.
+func (b *Base) ApplyEvent(ctx context.Context, event eh.Event) error {
+	applier, found := b.appliers[event.EventType()]
+	if !found {
+		return xerrors.NewInvalidEventTypeError(b.AggregateType().String(), "unsupported event %s", event.EventType())
+	}
+
+	if err := applier(ctx, event); err != nil {
+		return err
+	}
+
+	b.updateMetadata(event)
+
+	return nil
+}
+
+// AppendEvent appends a new event with the current time to the aggregate uncommitted events, to be applied
+// when the aggregate is saved. The tenant, user and correlation id in the context are stored in the event.
+func (b *Base) AppendEvent(ctx context.Context, eventType eh.EventType, data eh.EventData, options ...eh.EventOption) eh.Event {
+	return b.AggregateBase.AppendEvent(eventType, data, b.now(), append([]eh.EventOption{xeh.WithContext(ctx)}, options...)...)
+}
+
+// Metadata returns the entity metadata of the aggregate, as of the last applied event
+func (b *Base) Metadata() entity.Metadata {
+	return b.metadata
+}
+
+func (b *Base) updateMetadata(event eh.Event) {
+	if b.metadata.CreatedAt.IsZero() {
+		b.metadata.CreatedAt = event.Timestamp()
+	}
+
+	if b.metadata.Tenant == "" {
+		// The tenant of an aggregate does not change, it is taken from the first event
+		b.metadata.Tenant = xeh.GetEventTenant(event)
+	}
+
+	b.metadata.UpdatedAt = event.Timestamp()
+	b.metadata.Version = event.Version()
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
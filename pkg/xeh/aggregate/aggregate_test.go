@@ -0,0 +1,184 @@
+package aggregate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	accountType    = eh.AggregateType("account")
+	depositType    = eh.CommandType("deposit")
+	withdrawType   = eh.CommandType("withdraw")
+	depositedEvent = eh.EventType("deposited")
+	frozenEvent    = eh.EventType("frozen")
+)
+
+type deposit struct {
+	ID     uuid.UUID
+	Amount int `validate:"gt=0"`
+}
+
+func (c *deposit) AggregateID() uuid.UUID          { return c.ID }
+func (c *deposit) AggregateType() eh.AggregateType { return accountType }
+func (c *deposit) CommandType() eh.CommandType     { return depositType }
+
+type withdraw struct {
+	ID uuid.UUID
+}
+
+func (c *withdraw) AggregateID() uuid.UUID          { return c.ID }
+func (c *withdraw) AggregateType() eh.AggregateType { return accountType }
+func (c *withdraw) CommandType() eh.CommandType     { return withdrawType }
+
+type depositedData struct {
+	Amount int
+}
+
+type account struct {
+	*Base
+	balance  int
+	isFrozen bool
+}
+
+func newAccount(id uuid.UUID) *account {
+	a := &account{Base: NewBase(accountType, id)}
+	HandleCommand(a.Base, a.deposit)
+	ApplyEvent(a.Base, depositedEvent, a.deposited)
+	ApplyEvent(a.Base, frozenEvent, a.frozen)
+	return a
+}
+
+func (a *account) deposit(ctx context.Context, cmd *deposit) error {
+	a.AppendEvent(ctx, depositedEvent, &depositedData{Amount: cmd.Amount})
+	return nil
+}
+
+func (a *account) deposited(_ context.Context, data *depositedData, _ eh.Event) error {
+	a.balance += data.Amount
+	return nil
+}
+
+func (a *account) frozen(_ context.Context, _ eh.EventData, _ eh.Event) error {
+	a.isFrozen = true
+	return nil
+}
+
+func TestBase_dispatches_command_to_typed_handler(t *testing.T) {
+	// GIVEN an account aggregate
+	id := uuid.New()
+	a := newAccount(id)
+
+	// WHEN a valid command is handled
+	err := a.HandleCommand(xcontext.WithTenant(context.Background(), "a-tenant"), &deposit{ID: id, Amount: 10})
+
+	// THEN the event is appended for the aggregate
+	require.NoError(t, err)
+	require.Len(t, a.UncommittedEvents(), 1)
+
+	event := a.UncommittedEvents()[0]
+	require.Equal(t, depositedEvent, event.EventType())
+	require.Equal(t, id, event.AggregateID())
+	require.Equal(t, 1, event.Version())
+	require.Equal(t, &depositedData{Amount: 10}, event.Data())
+}
+
+func TestBase_rejects_invalid_commands(t *testing.T) {
+	// GIVEN an account aggregate
+	id := uuid.New()
+	a := newAccount(id)
+
+	// WHEN an invalid command is handled
+	err := a.HandleCommand(context.Background(), &deposit{ID: id, Amount: 0})
+
+	// THEN an invalid argument error is returned
+	require.ErrorIs(t, err, xerrors.ErrInvalidArgument)
+
+	// AND no event is appended
+	require.Empty(t, a.UncommittedEvents())
+}
+
+func TestBase_rejects_unsupported_commands(t *testing.T) {
+	// GIVEN an account aggregate without handler for withdraw
+	id := uuid.New()
+	a := newAccount(id)
+
+	// WHEN the command is handled
+	err := a.HandleCommand(context.Background(), &withdraw{ID: id})
+
+	// THEN an invalid argument error is returned
+	require.ErrorIs(t, err, xerrors.ErrInvalidArgument)
+}
+
+func TestBase_applies_events_and_updates_metadata(t *testing.T) {
+	// GIVEN an account aggregate
+	id := uuid.New()
+	a := newAccount(id)
+
+	created := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	// WHEN two events are applied
+	require.NoError(t, a.ApplyEvent(context.Background(), eh.NewEvent(depositedEvent, &depositedData{Amount: 10}, created,
+		eh.ForAggregate(accountType, id, 1), eh.WithMetadata(map[string]interface{}{"tenant": "a-tenant"}))))
+	require.NoError(t, a.ApplyEvent(context.Background(), eh.NewEvent(depositedEvent, &depositedData{Amount: 5}, updated,
+		eh.ForAggregate(accountType, id, 2))))
+
+	// THEN the state is updated
+	require.Equal(t, 15, a.balance)
+
+	// AND the metadata reflects the applied events
+	metadata := a.Metadata()
+	require.Equal(t, id, metadata.ID)
+	require.Equal(t, created, metadata.CreatedAt)
+	require.Equal(t, updated, metadata.UpdatedAt)
+	require.Equal(t, 2, metadata.Version)
+	require.Equal(t, "a-tenant", metadata.Tenant)
+}
+
+func TestBase_fails_to_apply_unsupported_events(t *testing.T) {
+	// GIVEN an account aggregate
+	id := uuid.New()
+	a := newAccount(id)
+
+	// WHEN an event without applier is applied
+	err := a.ApplyEvent(context.Background(), eh.NewEvent("closed", nil, time.Now(), eh.ForAggregate(accountType, id, 1)))
+
+	// THEN an invalid event type error is returned
+	require.ErrorIs(t, err, xerrors.ErrInvalidEventType)
+
+	// AND the metadata is not updated
+	require.Equal(t, 0, a.Metadata().Version)
+}
+
+func TestBase_applies_events_without_data(t *testing.T) {
+	// GIVEN an account aggregate
+	id := uuid.New()
+	a := newAccount(id)
+
+	// WHEN a marker event without data is applied
+	err := a.ApplyEvent(context.Background(), eh.NewEvent(frozenEvent, nil, time.Now(), eh.ForAggregate(accountType, id, 1)))
+
+	// THEN it is applied
+	require.NoError(t, err)
+	require.True(t, a.isFrozen)
+	require.Equal(t, 1, a.Metadata().Version)
+}
+
+func TestBase_fails_to_apply_events_with_unexpected_data(t *testing.T) {
+	// GIVEN an account aggregate
+	id := uuid.New()
+	a := newAccount(id)
+
+	// WHEN an event is applied with data of other type
+	err := a.ApplyEvent(context.Background(), eh.NewEvent(depositedEvent, &withdraw{ID: id}, time.Now(), eh.ForAggregate(accountType, id, 1)))
+
+	// THEN an invalid event type error is returned
+	require.ErrorIs(t, err, xerrors.ErrInvalidEventType)
+}
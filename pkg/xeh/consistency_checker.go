@@ -0,0 +1,273 @@
+package xeh
+
+import (
+	"context"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultCheckInterval = time.Minute
+	defaultSampleSize    = 10
+	defaultCheckRate     = rate.Limit(10)
+	defaultRecheckDelay  = time.Second
+)
+
+// ReadModelHealer regenerates the read models of an aggregate. ReadModelRegenerator implements it.
+type ReadModelHealer interface {
+	Regenerate(ctx context.Context, aggType eh.AggregateType, id uuid.UUID) error
+}
+
+// ConsistencyCheckResult is the result of checking a sample of aggregates of a type
+type ConsistencyCheckResult struct {
+	AggregateType eh.AggregateType
+	Checked       int                   // number of aggregates compared
+	Mismatches    []ReadModelDiff       // the read models that don't match the events
+	Healed        int                   // number of mismatched read models regenerated
+	Failures      []RegenerationFailure // the aggregates that could not be checked or healed
+}
+
+// ConsistencyChecker verifies in background that the read models match their events. Periodically, it takes a sample
+// of the aggregates of each type registered in the EventStoreInspector, replays their events in a scratch repo and
+// compares the result with the stored read model.
+//
+// EntityHealer only heals the read models when a projection fails, this checker finds the ones silently wrong.
+// Mismatches are reported, and if configured with WithAutoHeal, the read models are regenerated.
+// Checks and heals are rate limited, to bound the load added to the event store and the read models.
+type ConsistencyChecker struct {
+	logger       *zap.Logger
+	inspector    *EventStoreInspector
+	lister       AggregateLister
+	interval     time.Duration
+	sampleSize   int
+	recheckDelay time.Duration
+	checkLimiter *rate.Limiter
+	healer       ReadModelHealer
+	healLimiter  *rate.Limiter
+	report       func(ctx context.Context, diff ReadModelDiff)
+	randomId     func() uuid.UUID
+}
+
+// CheckerOption configures a ConsistencyChecker
+type CheckerOption func(*ConsistencyChecker)
+
+// WithCheckInterval sets how often a sample of each aggregate type is checked. Default is 1 minute.
+func WithCheckInterval(interval time.Duration) CheckerOption {
+	return func(c *ConsistencyChecker) {
+		c.interval = interval
+	}
+}
+
+// WithSampleSize sets how many aggregates of each type are checked each time. Default is 10.
+func WithSampleSize(size int) CheckerOption {
+	return func(c *ConsistencyChecker) {
+		c.sampleSize = size
+	}
+}
+
+// WithCheckRate sets the max number of aggregates checked per second. Default is 10.
+func WithCheckRate(limit rate.Limit) CheckerOption {
+	return func(c *ConsistencyChecker) {
+		c.checkLimiter = rate.NewLimiter(limit, 1)
+	}
+}
+
+// WithRecheckDelay sets how long to wait to compare again a mismatched read model, before reporting it.
+// It avoids reporting read models not projected yet. Default is 1 second.
+func WithRecheckDelay(delay time.Duration) CheckerOption {
+	return func(c *ConsistencyChecker) {
+		c.recheckDelay = delay
+	}
+}
+
+// WithAutoHeal regenerates the mismatched read models with the healer, at most the given number of heals per minute.
+// Mismatches exceeding the limit are only reported, and healed in a later check.
+// If healsPerMinute is not positive, auto heal is disabled and mismatches are only reported.
+func WithAutoHeal(healer ReadModelHealer, healsPerMinute int) CheckerOption {
+	return func(c *ConsistencyChecker) {
+		if healsPerMinute <= 0 {
+			c.healer = nil
+			c.healLimiter = nil
+			return
+		}
+
+		c.healer = healer
+		c.healLimiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(healsPerMinute)), healsPerMinute)
+	}
+}
+
+// WithMismatchReporter sets the function called for each mismatched read model. By default, they are logged.
+func WithMismatchReporter(report func(ctx context.Context, diff ReadModelDiff)) CheckerOption {
+	return func(c *ConsistencyChecker) {
+		c.report = report
+	}
+}
+
+// NewConsistencyChecker creates a new ConsistencyChecker comparing the read models of the inspector projections,
+// for the aggregates listed by the lister.
+func NewConsistencyChecker(logger *zap.Logger, inspector *EventStoreInspector, lister AggregateLister, options ...CheckerOption) *ConsistencyChecker {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(inspector, "inspector")
+	xerrors.EnsureNotEmpty(lister, "lister")
+
+	c := &ConsistencyChecker{
+		logger:       logger.Named("consistency checker"),
+		inspector:    inspector,
+		lister:       lister,
+		interval:     defaultCheckInterval,
+		sampleSize:   defaultSampleSize,
+		recheckDelay: defaultRecheckDelay,
+		checkLimiter: rate.NewLimiter(defaultCheckRate, 1),
+		randomId:     ids.New,
+	}
+
+	c.report = c.logMismatch
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// Run checks a sample of each aggregate type every check interval, until ctx is done.
+func (c *ConsistencyChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, aggType := range c.inspector.aggregateTypes() {
+			if _, err := c.CheckSample(ctx, aggType); err != nil && ctx.Err() == nil {
+				c.logger.Warn("could not check read models", zap.String("agg_type", aggType.String()), zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckSample checks the read models of a random sample of aggregates of the given type.
+// The sample are consecutive aggregates, starting at a random id.
+func (c *ConsistencyChecker) CheckSample(ctx context.Context, aggType eh.AggregateType) (ConsistencyCheckResult, error) {
+	sample, err := c.sample(ctx, aggType)
+	if err != nil {
+		return ConsistencyCheckResult{AggregateType: aggType}, err
+	}
+
+	return c.Check(ctx, aggType, sample...)
+}
+
+// Check checks the read models of the given aggregates. A failure to check an aggregate does not stop the process,
+// it is reported in the result.
+func (c *ConsistencyChecker) Check(ctx context.Context, aggType eh.AggregateType, aggIds ...uuid.UUID) (ConsistencyCheckResult, error) {
+	result := ConsistencyCheckResult{AggregateType: aggType}
+
+	for _, id := range aggIds {
+		if err := c.checkLimiter.Wait(ctx); err != nil {
+			return result, err
+		}
+
+		diff, err := c.diff(ctx, aggType, id)
+		if err != nil {
+			result.Failures = append(result.Failures, RegenerationFailure{ID: id, Err: err})
+			continue
+		}
+
+		result.Checked++
+
+		if diff.Match {
+			continue
+		}
+
+		result.Mismatches = append(result.Mismatches, diff)
+		c.report(ctx, diff)
+
+		healed, err := c.heal(ctx, aggType, id)
+		if err != nil {
+			result.Failures = append(result.Failures, RegenerationFailure{ID: id, Err: err})
+		} else if healed {
+			result.Healed++
+		}
+	}
+
+	return result, nil
+}
+
+// sample returns up to sample size aggregate ids after a random one, continuing from the first if there are not enough
+func (c *ConsistencyChecker) sample(ctx context.Context, aggType eh.AggregateType) ([]uuid.UUID, error) {
+	sample, err := c.lister.ListAggregateIDs(ctx, aggType, c.randomId(), c.sampleSize)
+	if err != nil || len(sample) == c.sampleSize {
+		return sample, err
+	}
+
+	first, err := c.lister.ListAggregateIDs(ctx, aggType, ids.Empty(), c.sampleSize-len(sample))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range first {
+		if len(sample) > 0 && id == sample[0] {
+			break // all the aggregates are in the sample
+		}
+		sample = append(sample, id)
+	}
+
+	return sample, nil
+}
+
+// diff compares the read model, comparing it again after the recheck delay if it does not match,
+// because the projection of the last events could be in progress.
+func (c *ConsistencyChecker) diff(ctx context.Context, aggType eh.AggregateType, id uuid.UUID) (ReadModelDiff, error) {
+	diff, err := c.inspector.Diff(ctx, aggType, id)
+	if err != nil || diff.Match || c.recheckDelay <= 0 {
+		return diff, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return diff, ctx.Err()
+	case <-time.After(c.recheckDelay):
+	}
+
+	return c.inspector.Diff(ctx, aggType, id)
+}
+
+func (c *ConsistencyChecker) heal(ctx context.Context, aggType eh.AggregateType, id uuid.UUID) (bool, error) {
+	if c.healer == nil {
+		return false, nil
+	}
+
+	if !c.healLimiter.Allow() {
+		c.logger.Warn("read model not healed, heal rate exceeded", zap.String("agg_type", aggType.String()), zap.String("agg_id", id.String()))
+		return false, nil
+	}
+
+	if err := c.healer.Regenerate(ctx, aggType, id); err != nil {
+		return false, err
+	}
+
+	c.logger.Info("read model healed", zap.String("agg_type", aggType.String()), zap.String("agg_id", id.String()))
+
+	return true, nil
+}
+
+func (c *ConsistencyChecker) logMismatch(_ context.Context, diff ReadModelDiff) {
+	c.logger.Warn(
+		"read model does not match its events",
+		zap.String("agg_type", diff.AggregateType.String()),
+		zap.String("agg_id", diff.AggregateID.String()),
+		zap.Int("version", diff.Version),
+		zap.String("difference", diff.Difference),
+		zap.String("explanation", diff.Explanation),
+	)
+}
@@ -0,0 +1,157 @@
+package xeh
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+type healerFake struct {
+	healed []uuid.UUID
+	err    error
+}
+
+func (h *healerFake) Regenerate(_ context.Context, _ eh.AggregateType, id uuid.UUID) error {
+	if h.err != nil {
+		return h.err
+	}
+	h.healed = append(h.healed, id)
+	return nil
+}
+
+func newTestChecker(t *testing.T, inspector *EventStoreInspector, aggIds []uuid.UUID, options ...CheckerOption) (*ConsistencyChecker, *[]ReadModelDiff) {
+	var reported []ReadModelDiff
+
+	options = append([]CheckerOption{
+		WithCheckRate(rate.Inf),
+		WithRecheckDelay(0),
+		WithMismatchReporter(func(_ context.Context, diff ReadModelDiff) { reported = append(reported, diff) }),
+	}, options...)
+
+	return NewConsistencyChecker(zap.NewNop(), inspector, &fakeAggregateLister{ids: aggIds}, options...), &reported
+}
+
+func TestConsistencyChecker_reports_mismatched_read_models(t *testing.T) {
+	// GIVEN a wrong read model
+	inspector, repo, id := newInspectorFixture(t)
+	require.NoError(t, repo.Save(context.Background(), &inspectedView{ID: id, Count: 5, Version: 2}))
+
+	checker, reported := newTestChecker(t, inspector, []uuid.UUID{id})
+
+	// WHEN it is checked
+	result, err := checker.Check(context.Background(), testAggType, id)
+
+	// THEN the mismatch is reported and not healed
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Checked)
+	require.Len(t, result.Mismatches, 1)
+	require.Equal(t, 0, result.Healed)
+	require.Len(t, *reported, 1)
+	require.Equal(t, id, (*reported)[0].AggregateID)
+}
+
+func TestConsistencyChecker_ignores_matching_read_models(t *testing.T) {
+	// GIVEN an up-to-date read model
+	inspector, repo, id := newInspectorFixture(t)
+	require.NoError(t, repo.Save(context.Background(), &inspectedView{ID: id, Count: 2, Version: 2}))
+
+	checker, reported := newTestChecker(t, inspector, []uuid.UUID{id})
+
+	// WHEN a sample is checked
+	result, err := checker.CheckSample(context.Background(), testAggType)
+
+	// THEN nothing is reported
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Checked)
+	require.Empty(t, result.Mismatches)
+	require.Empty(t, *reported)
+}
+
+func TestConsistencyChecker_heals_mismatches_up_to_the_heal_rate(t *testing.T) {
+	// GIVEN an aggregate without read model
+	inspector, _, id := newInspectorFixture(t)
+	other := uuid.New()
+	healer := &healerFake{}
+
+	checker, _ := newTestChecker(t, inspector, nil, WithAutoHeal(healer, 1))
+
+	// WHEN it is checked twice with auto heal limited to one heal per minute
+	result, err := checker.Check(context.Background(), testAggType, id, id)
+
+	// THEN it is healed only once
+	require.NoError(t, err)
+	require.Len(t, result.Mismatches, 2)
+	require.Equal(t, 1, result.Healed)
+	require.Equal(t, []uuid.UUID{id}, healer.healed)
+
+	// AND unknown aggregates are reported as failures
+	result, err = checker.Check(context.Background(), testAggType, other)
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Checked)
+	require.Len(t, result.Failures, 1)
+	require.Equal(t, other, result.Failures[0].ID)
+}
+
+func TestConsistencyChecker_reports_heal_failures(t *testing.T) {
+	// GIVEN a missing read model and a failing healer
+	inspector, _, id := newInspectorFixture(t)
+	healErr := errors.New("heal failed")
+
+	checker, _ := newTestChecker(t, inspector, nil, WithAutoHeal(&healerFake{err: healErr}, 10))
+
+	// WHEN it is checked
+	result, err := checker.Check(context.Background(), testAggType, id)
+
+	// THEN the failure is in the result
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Healed)
+	require.Len(t, result.Failures, 1)
+	require.ErrorIs(t, result.Failures[0].Err, healErr)
+}
+
+func TestConsistencyChecker_only_reports_mismatches_without_heal_rate(t *testing.T) {
+	for _, healsPerMinute := range []int{0, -1} {
+		// GIVEN an aggregate without read model, and auto heal without heals per minute
+		inspector, _, id := newInspectorFixture(t)
+		healer := &healerFake{}
+
+		checker, reported := newTestChecker(t, inspector, nil, WithAutoHeal(healer, healsPerMinute))
+
+		// WHEN it is checked
+		result, err := checker.Check(context.Background(), testAggType, id)
+
+		// THEN the mismatch is reported but not healed
+		require.NoError(t, err)
+		require.Len(t, *reported, 1)
+		require.Equal(t, 0, result.Healed)
+		require.Empty(t, healer.healed)
+	}
+}
+
+func TestConsistencyChecker_sample_wraps_around_aggregates(t *testing.T) {
+	// GIVEN 5 aggregates and a random start after the third one
+	aggIds := newSortedIds(5)
+	inspector, _, _ := newInspectorFixture(t)
+
+	checker, _ := newTestChecker(t, inspector, aggIds, WithSampleSize(4))
+	checker.randomId = func() uuid.UUID { return aggIds[2] }
+
+	// WHEN a sample is taken
+	sample, err := checker.sample(context.Background(), testAggType)
+
+	// THEN it continues from the first aggregates
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{aggIds[3], aggIds[4], aggIds[0], aggIds[1]}, sample)
+
+	// AND it does not repeat aggregates when the sample is larger than the aggregates
+	checker.sampleSize = 10
+	sample, err = checker.sample(context.Background(), testAggType)
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{aggIds[3], aggIds[4], aggIds[0], aggIds[1], aggIds[2]}, sample)
+}
@@ -18,6 +18,7 @@ type EntityHealer struct {
 
 	eventStore eh.EventStore
 	repo       eh.ReadWriteRepo
+	snapshots  SnapshotStore
 }
 
 func NewEntityHealer(logger *zap.Logger, eventStore eh.EventStore, prj projector.Projector, repo eh.ReadWriteRepo, options ...projector.Option) *EntityHealer {
@@ -30,6 +31,15 @@ func NewEntityHealer(logger *zap.Logger, eventStore eh.EventStore, prj projector
 	}
 }
 
+// NewEntityHealerWithSnapshots creates a new EntityHealer that heals the entities starting from their latest snapshot
+// in the store, instead of the first event. Snapshots hold projected state, so they should be discarded when the
+// projector changes.
+func NewEntityHealerWithSnapshots(logger *zap.Logger, eventStore eh.EventStore, prj projector.Projector, repo eh.ReadWriteRepo, snapshots SnapshotStore, options ...projector.Option) *EntityHealer {
+	healer := NewEntityHealer(logger, eventStore, prj, repo, options...)
+	healer.snapshots = snapshots
+	return healer
+}
+
 func (h *EntityHealer) HandleEvent(ctx context.Context, event eh.Event) error {
 	err := h.EventHandler.HandleEvent(ctx, event)
 
@@ -74,10 +84,15 @@ func (h *EntityHealer) removeReadModels(ctx context.Context, id uuid.UUID) error
 	return err
 }
 
-// replayEvents replays events for the given aggregate id from the first event
+// replayEvents replays events for the given aggregate id from the latest snapshot, or the first event if there is none
 // Events are not published outside the own event bus
 func (h *EntityHealer) replayEvents(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID) error {
-	events, err := h.eventStore.Load(ctx, id)
+	fromVersion, err := restoreSnapshot(ctx, h.snapshots, h.repo, aggregateType, id)
+	if err != nil {
+		return err
+	}
+
+	events, err := loadEventsAfter(ctx, h.eventStore, id, fromVersion)
 	if err != nil {
 		return err
 	}
@@ -2,17 +2,70 @@ package xeh
 
 import (
 	"context"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
 	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xuser"
 	eh "github.com/looplab/eventhorizon"
 )
 
+// Keys of the event metadata with the context of the action that caused the event
+const (
+	TenantMetadataKey        = "tenant"
+	UserIdMetadataKey        = "user_id"
+	UserNameMetadataKey      = "user_name"
+	RealUserIdMetadataKey    = "real_user_id"
+	CorrelationIdMetadataKey = "correlation_id"
+)
+
 // WithTenant adds the tenant to the event metadata
 func WithTenant(ctx context.Context) eh.EventOption {
 	return eh.WithMetadata(map[string]interface{}{
-		"tenant": xcontext.GetTenantOrDefault(ctx),
+		TenantMetadataKey: xcontext.GetTenantOrDefault(ctx),
 	})
 }
 
+// WithUser adds the user in context to the event metadata, and the real user if it is impersonated.
+// Nothing is added if there is no user in context.
+func WithUser(ctx context.Context) eh.EventOption {
+	metadata := map[string]interface{}{}
+
+	if user, err := xcontext.GetUser(ctx); err == nil {
+		metadata[UserIdMetadataKey] = user.Id().String()
+		metadata[UserNameMetadataKey] = user.Name()
+
+		if impersonated, ok := user.(xuser.ImpersonatedUser); ok && impersonated.RealUserId() != user.Id() {
+			metadata[RealUserIdMetadataKey] = impersonated.RealUserId().String()
+		}
+	}
+
+	return eh.WithMetadata(metadata)
+}
+
+// WithCorrelationId adds the correlation ID in context to the event metadata, if present.
+func WithCorrelationId(ctx context.Context) eh.EventOption {
+	metadata := map[string]interface{}{}
+
+	if correlationId, found := xcontext.GetCorrelationId(ctx); found {
+		metadata[CorrelationIdMetadataKey] = correlationId
+	}
+
+	return eh.WithMetadata(metadata)
+}
+
+// WithContext adds the tenant, user and correlation ID in context to the event metadata.
+// ContextFromEvent restores them in the handlers context.
+// The JWT is not added: events are persisted, and it would be expired when the event is replayed.
+func WithContext(ctx context.Context) eh.EventOption {
+	withTenant, withUser, withCorrelationId := WithTenant(ctx), WithUser(ctx), WithCorrelationId(ctx)
+
+	return func(event eh.Event) {
+		withTenant(event)
+		withUser(event)
+		withCorrelationId(event)
+	}
+}
+
 // GetEventTenant returns the tenant of the event, or the default tenant if not found
 func GetEventTenant(event eh.Event) string {
 	metadata := event.Metadata()
@@ -20,10 +73,105 @@ func GetEventTenant(event eh.Event) string {
 		return xcontext.DefaultTenant
 	}
 
-	tenant, ok := metadata["tenant"]
+	tenant, ok := metadata[TenantMetadataKey]
 	if !ok {
 		return xcontext.DefaultTenant
 	}
 
 	return tenant.(string)
 }
+
+// GetEventUser returns the user that caused the event, as added by WithUser.
+// The user has no permissions, it only identifies who caused the event.
+func GetEventUser(event eh.Event) (xuser.User, bool) {
+	id, found := getMetadataId(event, UserIdMetadataKey)
+	if !found {
+		return nil, false
+	}
+
+	user := &eventUser{id: id, realUserId: id, tenant: GetEventTenant(event)}
+	user.name, _ = event.Metadata()[UserNameMetadataKey].(string)
+
+	if realUserId, found := getMetadataId(event, RealUserIdMetadataKey); found {
+		user.realUserId = realUserId
+	}
+
+	return user, true
+}
+
+// GetEventCorrelationId returns the correlation ID of the event, as added by WithCorrelationId
+func GetEventCorrelationId(event eh.Event) (string, bool) {
+	correlationId, found := event.Metadata()[CorrelationIdMetadataKey].(string)
+	return correlationId, found
+}
+
+func getMetadataId(event eh.Event, key string) (ids.Id, bool) {
+	value, found := event.Metadata()[key].(string)
+	if !found {
+		return ids.Empty(), false
+	}
+
+	id, err := ids.Parse(value)
+	return id, err == nil
+}
+
+// ContextFromEvent returns the context with the tenant, user and correlation ID of the event metadata.
+// Values already present in the context are kept.
+func ContextFromEvent(ctx context.Context, event eh.Event) context.Context {
+	if _, found := xcontext.GetTenant(ctx); !found {
+		ctx = xcontext.WithTenant(ctx, GetEventTenant(event))
+	}
+
+	if _, err := xcontext.GetUser(ctx); err != nil {
+		if user, found := GetEventUser(event); found {
+			ctx = xcontext.WithUser(ctx, user)
+		}
+	}
+
+	if _, found := xcontext.GetCorrelationId(ctx); !found {
+		if correlationId, found := GetEventCorrelationId(event); found {
+			ctx = xcontext.WithCorrelationId(ctx, correlationId)
+		}
+	}
+
+	return ctx
+}
+
+// EventContextMiddleware returns a middleware that calls the handlers with the context restored by ContextFromEvent.
+// Use it for async handlers, so the audit data of the original request is available to them.
+func EventContextMiddleware() eh.EventHandlerMiddleware {
+	return func(handler eh.EventHandler) eh.EventHandler {
+		return &eventContextHandler{handler: handler}
+	}
+}
+
+type eventContextHandler struct {
+	handler eh.EventHandler
+}
+
+func (h *eventContextHandler) HandlerType() eh.EventHandlerType {
+	return h.handler.HandlerType()
+}
+
+func (h *eventContextHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	return h.handler.HandleEvent(ContextFromEvent(ctx, event), event)
+}
+
+// eventUser is the user that caused an event, rebuilt from the event metadata
+type eventUser struct {
+	id         ids.Id
+	realUserId ids.Id
+	name       string
+	tenant     string
+}
+
+var _ xuser.User = (*eventUser)(nil)
+var _ xuser.ImpersonatedUser = (*eventUser)(nil)
+
+func (u *eventUser) Id() ids.Id         { return u.id }
+func (u *eventUser) Name() string       { return u.name }
+func (u *eventUser) Tenant() string     { return u.tenant }
+func (u *eventUser) RealUserId() ids.Id { return u.realUserId }
+
+// HasPermission returns always false, the permissions of the user are not known when handling the event.
+func (u *eventUser) HasPermission(string) bool { return false }
@@ -0,0 +1,72 @@
+package xeh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xuser"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+)
+
+type userFake struct {
+	id         ids.Id
+	realUserId ids.Id
+	tenant     string
+}
+
+func (u *userFake) Id() ids.Id                { return u.id }
+func (u *userFake) Name() string              { return "John" }
+func (u *userFake) Tenant() string            { return u.tenant }
+func (u *userFake) HasPermission(string) bool { return true }
+func (u *userFake) RealUserId() ids.Id        { return u.realUserId }
+
+func TestContextFromEvent_restores_the_context_of_the_event(t *testing.T) {
+	// GIVEN an event created by an impersonated user with a correlation ID
+	user := &userFake{id: ids.New(), realUserId: ids.New(), tenant: "a-tenant"}
+	ctx := xcontext.WithCorrelationId(xcontext.WithUser(context.Background(), user), "correlation")
+
+	event := eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate(testAggType, ids.New(), 1), WithContext(ctx))
+
+	// WHEN the context is restored in an empty context
+	restored := ContextFromEvent(context.Background(), event)
+
+	// THEN the tenant, user, real user and correlation ID are restored
+	tenant, _ := xcontext.GetTenant(restored)
+	require.Equal(t, "a-tenant", tenant)
+
+	restoredUser, err := xcontext.GetUser(restored)
+	require.NoError(t, err)
+	require.Equal(t, user.id, restoredUser.Id())
+	require.Equal(t, "John", restoredUser.Name())
+	require.Equal(t, user.realUserId, restoredUser.(xuser.ImpersonatedUser).RealUserId())
+	require.False(t, restoredUser.HasPermission("any"))
+
+	correlationId, _ := xcontext.GetCorrelationId(restored)
+	require.Equal(t, "correlation", correlationId)
+}
+
+func TestEventContextMiddleware_keeps_values_present_in_context(t *testing.T) {
+	// GIVEN an event of a tenant without user
+	event := eh.NewEvent("test-event", nil, time.Now(), WithContext(xcontext.WithTenant(context.Background(), "event-tenant")))
+
+	var handled context.Context
+	handler := eh.UseEventHandlerMiddleware(eh.EventHandlerFunc(func(ctx context.Context, _ eh.Event) error {
+		handled = ctx
+		return nil
+	}), EventContextMiddleware())
+
+	// WHEN it is handled in a context with other tenant
+	require.NoError(t, handler.HandleEvent(xcontext.WithTenant(context.Background(), "context-tenant"), event))
+
+	// THEN the tenant in context is kept
+	tenant, _ := xcontext.GetTenant(handled)
+	require.Equal(t, "context-tenant", tenant)
+
+	// AND there is no user
+	_, err := xcontext.GetUser(handled)
+	require.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package xeh
+
+import (
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	eh "github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// EventRecord is the stored form of an event. It allows to rebuild the event to replay it.
+// Event data is decoded using the factory registered with eh.RegisterEventData.
+type EventRecord struct {
+	EventType     eh.EventType           `bson:"event_type"`
+	AggregateType eh.AggregateType       `bson:"aggregate_type"`
+	AggregateID   ids.Id                 `bson:"aggregate_id"`
+	Version       int                    `bson:"version"`
+	Timestamp     time.Time              `bson:"timestamp"`
+	Metadata      map[string]interface{} `bson:"metadata"`
+	RawData       bson.Raw               `bson:"data,omitempty"`
+}
+
+// NewEventRecord creates the record to store the given event
+func NewEventRecord(event eh.Event) (EventRecord, error) {
+	record := EventRecord{
+		EventType:     event.EventType(),
+		AggregateType: event.AggregateType(),
+		AggregateID:   event.AggregateID(),
+		Version:       event.Version(),
+		Timestamp:     event.Timestamp(),
+		Metadata:      event.Metadata(),
+	}
+
+	if event.Data() != nil {
+		rawData, err := bson.Marshal(event.Data())
+		if err != nil {
+			return record, err
+		}
+		record.RawData = rawData
+	}
+
+	return record, nil
+}
+
+// ToEvent rebuilds the stored event
+func (r EventRecord) ToEvent() (eh.Event, error) {
+	var data eh.EventData
+
+	if len(r.RawData) > 0 {
+		var err error
+		if data, err = eh.CreateEventData(r.EventType); err != nil {
+			return nil, err
+		}
+
+		if err := bson.Unmarshal(r.RawData, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return eh.NewEvent(
+		r.EventType,
+		data,
+		r.Timestamp,
+		eh.ForAggregate(r.AggregateType, r.AggregateID, r.Version),
+		eh.WithMetadata(r.Metadata),
+	), nil
+}
@@ -0,0 +1,247 @@
+package xeh
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+	"github.com/looplab/eventhorizon/repo/memory"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/nsf/jsondiff"
+)
+
+// EventView is an event of the event store as shown by the EventStoreInspector
+type EventView struct {
+	EventType     eh.EventType           `json:"eventType"`
+	AggregateType eh.AggregateType       `json:"aggregateType"`
+	AggregateID   uuid.UUID              `json:"aggregateId"`
+	Version       int                    `json:"version"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Data          eh.EventData           `json:"data,omitempty"`
+}
+
+// NewEventView returns the view of the event
+func NewEventView(event eh.Event) EventView {
+	return EventView{
+		EventType:     event.EventType(),
+		AggregateType: event.AggregateType(),
+		AggregateID:   event.AggregateID(),
+		Version:       event.Version(),
+		Timestamp:     event.Timestamp(),
+		Metadata:      event.Metadata(),
+		Data:          event.Data(),
+	}
+}
+
+// ReadModelDiff is the comparison of a stored read model with the one projected from the events of the aggregate
+type ReadModelDiff struct {
+	AggregateType eh.AggregateType `json:"aggregateType"`
+	AggregateID   uuid.UUID        `json:"aggregateId"`
+	Version       int              `json:"version"`               // The version of the last event projected
+	Match         bool             `json:"match"`                 // True if both read models are equal
+	Difference    string           `json:"difference"`            // The jsondiff result, i.e. FullMatch, SupersetMatch, NoMatch
+	Explanation   string           `json:"explanation,omitempty"` // The differences, only when they don't match
+	Stored        json.RawMessage  `json:"stored"`                // The stored read model, null if not found
+	Projected     json.RawMessage  `json:"projected"`             // The projected read model, null if removed by the projector
+}
+
+// EventStoreInspector allows to inspect the event stream of an aggregate, to debug production issues.
+// It compares the stored read models with a fresh projection of the events, for the aggregate types registered with
+// RegisterProjection.
+type EventStoreInspector struct {
+	eventStore eh.EventStore
+
+	projections     map[eh.AggregateType]inspectedProjection
+	projectionsLock sync.RWMutex
+}
+
+type inspectedProjection struct {
+	projector projector.Projector
+	repo      eh.ReadRepo
+	factory   func() eh.Entity
+}
+
+// NewEventStoreInspector creates a new EventStoreInspector reading the events from the event store
+func NewEventStoreInspector(eventStore eh.EventStore) *EventStoreInspector {
+	xerrors.EnsureNotEmpty(eventStore, "eventStore")
+
+	return &EventStoreInspector{
+		eventStore:  eventStore,
+		projections: make(map[eh.AggregateType]inspectedProjection),
+	}
+}
+
+// RegisterProjection registers the projector of the read models of the aggregate type, the repo where they are
+// stored, and the factory of new read models used by the projector.
+func (i *EventStoreInspector) RegisterProjection(aggregateType eh.AggregateType, prj projector.Projector, repo eh.ReadRepo, factory func() eh.Entity) {
+	xerrors.EnsureNotEmpty(prj, "prj")
+	xerrors.EnsureNotEmpty(repo, "repo")
+	xerrors.EnsureNotEmpty(factory, "factory")
+
+	i.projectionsLock.Lock()
+	defer i.projectionsLock.Unlock()
+
+	i.projections[aggregateType] = inspectedProjection{projector: prj, repo: repo, factory: factory}
+}
+
+// Events returns the events of the aggregate, ordered by version.
+// Returns a not found error if there are no events for the aggregate of the given type.
+func (i *EventStoreInspector) Events(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID) ([]EventView, error) {
+	events, err := i.load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]EventView, 0, len(events))
+	for _, event := range events {
+		views = append(views, NewEventView(event))
+	}
+
+	return views, nil
+}
+
+// Export writes the events of the aggregate to w as JSON lines, one EventView by line.
+func (i *EventStoreInspector) Export(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID, w io.Writer) error {
+	events, err := i.Events(ctx, aggregateType, id)
+	if err != nil {
+		return err
+	}
+
+	return WriteJSONLines(w, events)
+}
+
+// WriteJSONLines writes the events to w as JSON lines, one EventView by line.
+func WriteJSONLines(w io.Writer, events []EventView) error {
+	encoder := json.NewEncoder(w)
+
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Diff compares the stored read model of the aggregate with the one projected from all its events in memory,
+// as EntityHealer would rebuild it. The stored read model is not modified.
+func (i *EventStoreInspector) Diff(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID) (ReadModelDiff, error) {
+	i.projectionsLock.RLock()
+	projection, found := i.projections[aggregateType]
+	i.projectionsLock.RUnlock()
+
+	if !found {
+		return ReadModelDiff{}, xerrors.NewNotFoundError("projection", "%s", aggregateType)
+	}
+
+	events, err := i.load(ctx, aggregateType, id)
+	if err != nil {
+		return ReadModelDiff{}, err
+	}
+
+	projected, err := projection.project(ctx, id, events)
+	if err != nil {
+		return ReadModelDiff{}, err
+	}
+
+	stored, err := projection.repo.Find(ctx, id)
+	if err != nil && !IsEHNotFound(err) {
+		return ReadModelDiff{}, err
+	}
+
+	diff, err := compareReadModels(stored, projected)
+	if err != nil {
+		return ReadModelDiff{}, err
+	}
+
+	diff.AggregateType = aggregateType
+	diff.AggregateID = id
+	diff.Version = events[len(events)-1].Version()
+
+	return diff, nil
+}
+
+// aggregateTypes returns the aggregate types with a registered projection
+func (i *EventStoreInspector) aggregateTypes() []eh.AggregateType {
+	i.projectionsLock.RLock()
+	defer i.projectionsLock.RUnlock()
+
+	types := make([]eh.AggregateType, 0, len(i.projections))
+	for aggregateType := range i.projections {
+		types = append(types, aggregateType)
+	}
+
+	return types
+}
+
+func (i *EventStoreInspector) load(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID) ([]eh.Event, error) {
+	events, err := i.eventStore.Load(ctx, id)
+	if err != nil && !IsEHNotFound(err) {
+		return nil, err
+	}
+
+	if len(events) == 0 || events[0].AggregateType() != aggregateType {
+		return nil, xerrors.NewNotFoundError(aggregateType.String(), "%s", id)
+	}
+
+	return events, nil
+}
+
+// project projects the events in a scratch in memory repo, and returns the resulting read model.
+// Returns nil if the projector removed the read model.
+func (p inspectedProjection) project(ctx context.Context, id uuid.UUID, events []eh.Event) (eh.Entity, error) {
+	repo := memory.NewRepo()
+
+	handler := projector.NewEventHandler(p.projector, repo)
+	handler.SetEntityFactory(p.factory)
+
+	for _, event := range events {
+		if err := handler.HandleEvent(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	entity, err := repo.Find(ctx, id)
+	if IsEHNotFound(err) {
+		return nil, nil
+	}
+
+	return entity, err
+}
+
+// compareReadModels compares the read models as JSON. Missing read models are compared as null.
+func compareReadModels(stored eh.Entity, projected eh.Entity) (ReadModelDiff, error) {
+	storedJson, err := json.Marshal(stored)
+	if err != nil {
+		return ReadModelDiff{}, err
+	}
+
+	projectedJson, err := json.Marshal(projected)
+	if err != nil {
+		return ReadModelDiff{}, err
+	}
+
+	options := jsondiff.DefaultJSONOptions()
+	options.SkipMatches = true
+
+	difference, explanation := jsondiff.Compare(storedJson, projectedJson, &options)
+
+	diff := ReadModelDiff{
+		Match:      difference == jsondiff.FullMatch,
+		Difference: difference.String(),
+		Stored:     storedJson,
+		Projected:  projectedJson,
+	}
+
+	if !diff.Match {
+		diff.Explanation = explanation
+	}
+
+	return diff, nil
+}
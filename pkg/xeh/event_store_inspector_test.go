@@ -0,0 +1,137 @@
+package xeh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+	"github.com/looplab/eventhorizon/repo/memory"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type inspectedView struct {
+	ID      uuid.UUID `json:"id"`
+	Count   int       `json:"count"`
+	Version int       `json:"version"`
+}
+
+func (v *inspectedView) EntityID() uuid.UUID   { return v.ID }
+func (v *inspectedView) AggregateVersion() int { return v.Version }
+
+type countingProjector struct{}
+
+func (countingProjector) ProjectorType() projector.Type { return "counting" }
+
+func (countingProjector) Project(_ context.Context, event eh.Event, entity eh.Entity) (eh.Entity, error) {
+	view := entity.(*inspectedView)
+	view.ID = event.AggregateID()
+	view.Count++
+	view.Version = event.Version()
+	return view, nil
+}
+
+func newInspectorFixture(t *testing.T) (*EventStoreInspector, *memory.Repo, uuid.UUID) {
+	id := uuid.New()
+	timestamp := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	eventStore := &ehmocks.EventStoreMock{}
+	eventStore.On("Load", mock.Anything, id).Return([]eh.Event{
+		eh.NewEvent("created", nil, timestamp, eh.ForAggregate(testAggType, id, 1), eh.WithMetadata(map[string]interface{}{"tenant": "a-tenant"})),
+		eh.NewEvent("updated", nil, timestamp, eh.ForAggregate(testAggType, id, 2)),
+	}, nil)
+	eventStore.On("Load", mock.Anything, mock.Anything).Return(nil, nil)
+
+	repo := memory.NewRepo()
+
+	inspector := NewEventStoreInspector(eventStore)
+	inspector.RegisterProjection(testAggType, countingProjector{}, repo, func() eh.Entity { return &inspectedView{} })
+
+	return inspector, repo, id
+}
+
+func TestEventStoreInspector_lists_aggregate_events(t *testing.T) {
+	// GIVEN an aggregate with two events
+	inspector, _, id := newInspectorFixture(t)
+
+	// WHEN its events are listed
+	events, err := inspector.Events(context.Background(), testAggType, id)
+
+	// THEN they are returned with version and metadata
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, eh.EventType("created"), events[0].EventType)
+	require.Equal(t, 1, events[0].Version)
+	require.Equal(t, "a-tenant", events[0].Metadata["tenant"])
+	require.Equal(t, 2, events[1].Version)
+}
+
+func TestEventStoreInspector_returns_not_found_for_unknown_aggregate(t *testing.T) {
+	// GIVEN an inspector
+	inspector, _, _ := newInspectorFixture(t)
+
+	// WHEN the events of an unknown aggregate are listed
+	_, err := inspector.Events(context.Background(), testAggType, uuid.New())
+
+	// THEN a not found error is returned
+	require.ErrorIs(t, err, xerrors.ErrNotFound)
+}
+
+func TestEventStoreInspector_exports_events_as_json_lines(t *testing.T) {
+	// GIVEN an aggregate with two events
+	inspector, _, id := newInspectorFixture(t)
+
+	// WHEN its events are exported
+	var buffer bytes.Buffer
+	err := inspector.Export(context.Background(), testAggType, id, &buffer)
+
+	// THEN each event is written in a line
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var event EventView
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	require.Equal(t, eh.EventType("updated"), event.EventType)
+	require.Equal(t, id, event.AggregateID)
+}
+
+func TestEventStoreInspector_diff_matches_up_to_date_read_model(t *testing.T) {
+	// GIVEN an up-to-date read model
+	inspector, repo, id := newInspectorFixture(t)
+	require.NoError(t, repo.Save(context.Background(), &inspectedView{ID: id, Count: 2, Version: 2}))
+
+	// WHEN it is compared with the events
+	diff, err := inspector.Diff(context.Background(), testAggType, id)
+
+	// THEN it matches
+	require.NoError(t, err)
+	require.True(t, diff.Match)
+	require.Equal(t, 2, diff.Version)
+	require.Empty(t, diff.Explanation)
+}
+
+func TestEventStoreInspector_diff_reports_differences(t *testing.T) {
+	// GIVEN a wrong read model
+	inspector, repo, id := newInspectorFixture(t)
+	require.NoError(t, repo.Save(context.Background(), &inspectedView{ID: id, Count: 5, Version: 2}))
+
+	// WHEN it is compared with the events
+	diff, err := inspector.Diff(context.Background(), testAggType, id)
+
+	// THEN the differences are reported
+	require.NoError(t, err)
+	require.False(t, diff.Match)
+	require.Equal(t, "NoMatch", diff.Difference)
+	require.Contains(t, diff.Explanation, "count")
+	require.JSONEq(t, `{"id": "`+id.String()+`", "count": 2, "version": 2}`, string(diff.Projected))
+}
@@ -0,0 +1,76 @@
+package eventerrors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// EventErrorId returns the id of the EventError for the given handler and event.
+// The id is the same for all the failures of the handler processing the event.
+func EventErrorId(handlerType eh.EventHandlerType, event eh.Event) ids.Id {
+	return ids.NewID(handlerType, event.AggregateType(), event.AggregateID(), event.Version(), event.EventType())
+}
+
+// recordFailure updates the EventError with a new failure of the handler
+func (e *EventError) recordFailure(err error, now time.Time) {
+	e.Err = err.Error()
+	e.Causes = causeChain(err)
+	e.Stack = errorStack(err)
+	e.Code = errorCode(err)
+	e.Attempts++
+	e.LastFailedAt = now
+	e.Status = StatusPending
+	e.ResolvedAt = nil
+	e.ResolvedBy = nil
+}
+
+// causeChain returns the messages of the wrapped errors, outermost first, excluding the error itself
+func causeChain(err error) []string {
+	var causes []string
+
+	pending := unwrapAll(err)
+	for len(pending) > 0 {
+		cause := pending[0]
+		pending = append(unwrapAll(cause), pending[1:]...)
+
+		causes = append(causes, cause.Error())
+	}
+
+	return causes
+}
+
+func unwrapAll(err error) []error {
+	switch wrapper := err.(type) {
+	case interface{ Unwrap() []error }:
+		return wrapper.Unwrap()
+	case interface{ Unwrap() error }:
+		if cause := wrapper.Unwrap(); cause != nil {
+			return []error{cause}
+		}
+	}
+	return nil
+}
+
+// errorStack returns the detailed representation of the error, if it gives more information than the message.
+// Errors with stack traces (i.e. github.com/pkg/errors) print them with %+v.
+func errorStack(err error) string {
+	detailed := fmt.Sprintf("%+v", err)
+	if detailed == err.Error() {
+		return ""
+	}
+	return detailed
+}
+
+// errorCode returns the code of the xerrors.HttpError wrapped by err, if any
+func errorCode(err error) string {
+	var httpError xerrors.HttpError
+	if errors.As(err, &httpError) {
+		return httpError.Code()
+	}
+	return ""
+}
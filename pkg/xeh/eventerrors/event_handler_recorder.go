@@ -4,46 +4,77 @@ import (
 	"context"
 	"github.com/AltScore/gothic/v2/pkg/ids"
 	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
 	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/cenkalti/backoff/v4"
 	eh "github.com/looplab/eventhorizon"
-	"github.com/looplab/eventhorizon/repo/mongodb"
 	"github.com/looplab/eventhorizon/uuid"
 	"github.com/totemcaf/gollections/ptrs"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
+	"os"
+	"sync"
 	"time"
 )
 
-// RetriableError is a marker to identify an error that can be retried.
-type RetriableError interface {
-	IsRetriable() bool
-}
+// Status is the processing status of an EventError
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // The error was not processed yet
+	StatusResolved  Status = "resolved"  // The event was replayed successfully or the error was fixed by other means
+	StatusDiscarded Status = "discarded" // The event will not be processed
+)
 
+// EventError is the failure of an event handler to process an event.
+// There is only one EventError for each event and handler, repeated failures increment the attempts.
 type EventError struct {
-	Id        ids.Id    `bson:"_id"`
-	CreatedAt time.Time `bson:"createdAt"`
-	UserId    *ids.Id   `bson:"userId"` // The user that caused the error, if present
-	Tenant    *string   `bson:"tenant"` // The tenant that caused the error, if present
-	Err       string    `bson:"error"`  // The error returned by the event handler
-	Event     eh.Event  `bson:"event"`  // The event that caused the error
-	Host      string    `bson:"host"`   // This is the machine name
+	Id           ids.Id              `bson:"_id"`
+	CreatedAt    time.Time           `bson:"createdAt"`
+	UserId       *ids.Id             `bson:"userId"`               // The user that caused the error, if present
+	Tenant       *string             `bson:"tenant"`               // The tenant that caused the error, if present
+	Err          string              `bson:"error"`                // The error returned by the event handler
+	Causes       []string            `bson:"causes,omitempty"`     // The chain of wrapped errors, outermost first
+	Stack        string              `bson:"stack,omitempty"`      // The detailed error, if it provides more information (i.e. a stack trace)
+	Code         string              `bson:"code,omitempty"`       // The xerrors code, if the error wraps an xerrors.HttpError
+	Event        xeh.EventRecord     `bson:"event"`                // The event that caused the error
+	HandlerType  eh.EventHandlerType `bson:"handlerType"`          // The event handler that returned the error
+	Host         string              `bson:"host"`                 // This is the machine name
+	Attempts     int                 `bson:"attempts"`             // The number of times the handler failed to process the event
+	LastFailedAt time.Time           `bson:"lastFailedAt"`         // When the handler failed the last time
+	Status       Status              `bson:"status"`               // The processing status of the error
+	ResolvedAt   *time.Time          `bson:"resolvedAt,omitempty"` // When the error was resolved or discarded
+	ResolvedBy   *ids.Id             `bson:"resolvedBy,omitempty"` // The user that resolved or discarded the error
 }
 
 var _ eh.Entity = (*EventError)(nil)
 
 func (e EventError) EntityID() uuid.UUID { return e.Id }
 
+// IsPending returns true if the error was not resolved nor discarded yet
+func (e EventError) IsPending() bool {
+	return e.Status == "" || e.Status == StatusPending
+}
+
 // EventHandlerErrorRecorder is a wrapper to a EventHandler to catch the returned errors from a target event handler,
 // and record them to process them.
 type EventHandlerErrorRecorder struct {
 	logger *zap.Logger
 	target eh.EventBus
-	store  eh.WriteRepo
+	store  FailureRecorder
+	host   string
+	retry  *RetryPolicy
+
+	handlers     map[eh.EventHandlerType]eh.EventHandler
+	handlersLock sync.RWMutex
 }
 
+// RecorderOption configures an EventHandlerErrorRecorder
+type RecorderOption func(*EventHandlerErrorRecorder)
+
 // NewEventHandlerErrorRecorder returns a new instance of EventHandlerErrorRecorder using the mongo client to
 // record the events in the indicated database and collection.
-func NewEventHandlerErrorRecorder(logger *zap.Logger, client *mongo.Client, databaseName, collectionName string, target eh.EventBus) (*EventHandlerErrorRecorder, error) {
+func NewEventHandlerErrorRecorder(logger *zap.Logger, client *mongo.Client, databaseName, collectionName string, target eh.EventBus, options ...RecorderOption) (*EventHandlerErrorRecorder, error) {
 	xerrors.EnsureNotEmpty(logger, "logger")
 	xerrors.EnsureNotEmpty(client, "client")
 	xerrors.EnsureNotEmpty(databaseName, "databaseName")
@@ -54,19 +85,73 @@ func NewEventHandlerErrorRecorder(logger *zap.Logger, client *mongo.Client, data
 
 	logger.Info("creating event handler error recorder", zap.String("databaseName", databaseName), zap.String("collectionName", collectionName))
 
-	store, err := mongodb.NewRepoWithClient(client, databaseName, collectionName)
+	return newEventHandlerErrorRecorder(logger, NewMongoStore(client, databaseName, collectionName), target, options...), nil
+}
+
+func newEventHandlerErrorRecorder(logger *zap.Logger, store FailureRecorder, target eh.EventBus, options ...RecorderOption) *EventHandlerErrorRecorder {
+	host, err := os.Hostname()
 	if err != nil {
-		return nil, err
+		logger.Warn("could not get host name", zap.Error(err))
 	}
 
-	return &EventHandlerErrorRecorder{logger: logger, target: target, store: store}, nil
+	recorder := &EventHandlerErrorRecorder{
+		logger:   logger,
+		target:   target,
+		store:    store,
+		host:     host,
+		handlers: make(map[eh.EventHandlerType]eh.EventHandler),
+	}
+
+	for _, option := range options {
+		option(recorder)
+	}
+
+	return recorder
+}
+
+// WithRetryPolicy configures the recorder to retry in process the handlers failing with a RetriableError.
+// Only after exhausting the retries, the error is recorded. Without a policy, retriable errors are returned.
+func WithRetryPolicy(policy RetryPolicy) RecorderOption {
+	return func(e *EventHandlerErrorRecorder) {
+		e.retry = &policy
+	}
 }
 
 var _ eh.EventBus = (*EventHandlerErrorRecorder)(nil)
 
 // AddHandler implements the AddHandler method of the EventBus interface.
 func (e *EventHandlerErrorRecorder) AddHandler(ctx context.Context, matcher eh.EventMatcher, handler eh.EventHandler) error {
-	return e.target.AddHandler(ctx, matcher, e.wrap(handler))
+	if err := e.target.AddHandler(ctx, matcher, e.wrap(handler)); err != nil {
+		return err
+	}
+
+	e.handlersLock.Lock()
+	defer e.handlersLock.Unlock()
+
+	e.handlers[handler.HandlerType()] = handler
+
+	return nil
+}
+
+// Wrap returns the handler wrapped to record its failures, for handlers called directly instead of through the bus,
+// like the saga timeouts. The handler can be replayed as the ones added with AddHandler.
+func (e *EventHandlerErrorRecorder) Wrap(handler eh.EventHandler) eh.EventHandler {
+	e.handlersLock.Lock()
+	defer e.handlersLock.Unlock()
+
+	e.handlers[handler.HandlerType()] = handler
+
+	return e.wrap(handler)
+}
+
+// Handler returns the handler of the given type added to this recorder.
+// It allows to replay the recorded events through the handler that failed.
+func (e *EventHandlerErrorRecorder) Handler(handlerType eh.EventHandlerType) (eh.EventHandler, bool) {
+	e.handlersLock.RLock()
+	defer e.handlersLock.RUnlock()
+
+	handler, found := e.handlers[handlerType]
+	return handler, found
 }
 
 // HandlerType implements the HandlerType method of the EventBus interface.
@@ -98,20 +183,29 @@ func (e *EventHandlerErrorRecorder) wrap(handler eh.EventHandler) eh.EventHandle
 }
 
 // persistError persists the error in the database for later processing.
-// Current user and tenant in context are recorded.
-func (e *EventHandlerErrorRecorder) persistError(ctx context.Context, event eh.Event, err error) error {
-	userId, tenant := e.getUserAndTenant(ctx)
+// Current user and tenant in context, or else the ones in the event metadata, are recorded.
+// If the same handler already failed with the same event, the existing error is updated.
+func (e *EventHandlerErrorRecorder) persistError(ctx context.Context, handlerType eh.EventHandlerType, event eh.Event, err error) error {
+	userId, tenant := e.getUserAndTenant(xeh.ContextFromEvent(ctx, event))
+
+	record, recordErr := xeh.NewEventRecord(event)
+	if recordErr != nil {
+		e.logger.Error("could not encode event", zap.Error(recordErr))
+		return recordErr
+	}
 
 	eventError := EventError{
-		Id:        ids.New(),
-		CreatedAt: event.Timestamp(),
-		UserId:    userId,
-		Tenant:    tenant,
-		Err:       err.Error(),
-		Event:     event,
+		Id:          EventErrorId(handlerType, event),
+		CreatedAt:   event.Timestamp(),
+		UserId:      userId,
+		Tenant:      tenant,
+		Event:       record,
+		HandlerType: handlerType,
+		Host:        e.host,
 	}
+	eventError.recordFailure(err, time.Now())
 
-	if err := e.store.Save(ctx, &eventError); err != nil {
+	if err := e.store.Record(ctx, eventError); err != nil {
 		e.logger.Error("could not save event error", zap.Error(err))
 		// TODO send error in error channel
 
@@ -147,12 +241,13 @@ func (w wrapper) HandlerType() eh.EventHandlerType {
 }
 
 func (w wrapper) HandleEvent(ctx context.Context, event eh.Event) error {
-	err := w.handler.HandleEvent(ctx, event)
+	err := w.handleWithRetries(ctx, event)
 	if err == nil {
 		return nil
 	}
-	if retryable, ok := err.(RetriableError); ok && retryable.IsRetriable() {
-		// Error is retriable, so we return it to indicate that the event was not handled.
+	if isRetriable(err) && (w.recorder.retry == nil || ctx.Err() != nil) {
+		// Error is retriable, and it was not retried or retries were canceled,
+		// so we return it to indicate that the event was not handled.
 		return err
 	}
 
@@ -166,11 +261,41 @@ func (w wrapper) HandleEvent(ctx context.Context, event eh.Event) error {
 		zap.String("handler", w.handler.HandlerType().String()),
 	)
 
-	if err := w.recorder.persistError(ctx, event, err); err != nil {
+	if err := w.recorder.persistError(ctx, w.handler.HandlerType(), event, err); err != nil {
 		// Failed to persist the error, so we return it to indicate that the event was not handled.
 		return err
 	}
 
-	// Error is not retriable, so we return nil to indicate that the event was handled.
+	// Error is not retriable or retries were exhausted, so we return nil to indicate that the event was handled.
 	return nil
 }
+
+// handleWithRetries calls the handler, retrying it with the recorder policy while it fails with a RetriableError.
+// Returns the last error returned by the handler.
+func (w wrapper) handleWithRetries(ctx context.Context, event eh.Event) error {
+	if w.recorder.retry == nil {
+		return w.handler.HandleEvent(ctx, event)
+	}
+
+	var lastErr error
+
+	_ = backoff.RetryNotify(func() error {
+		lastErr = w.handler.HandleEvent(ctx, event)
+
+		if lastErr != nil && !isRetriable(lastErr) {
+			return backoff.Permanent(lastErr)
+		}
+		return lastErr
+	}, w.recorder.retry.newBackOff(ctx), func(err error, delay time.Duration) {
+		w.recorder.logger.Debug(
+			"retrying event handler",
+			zap.Error(err),
+			zap.Duration("delay", delay),
+			zap.String("event", event.EventType().String()),
+			zap.String("agg_id", event.AggregateID().String()),
+			zap.String("handler", w.handler.HandlerType().String()),
+		)
+	})
+
+	return lastErr
+}
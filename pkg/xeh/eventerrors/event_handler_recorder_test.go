@@ -0,0 +1,223 @@
+package eventerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type failureRecorderFake struct {
+	recorded []EventError
+}
+
+func (f *failureRecorderFake) Record(_ context.Context, eventError EventError) error {
+	f.recorded = append(f.recorded, eventError)
+	return nil
+}
+
+type retriableError struct{}
+
+func (retriableError) Error() string     { return "retriable" }
+func (retriableError) IsRetriable() bool { return true }
+
+func newTestEvent() eh.Event {
+	return eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate("test-agg", ids.New(), 2))
+}
+
+func TestWrapper_records_failure_details(t *testing.T) {
+	// GIVEN a handler failing with a wrapped xerrors error
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil)
+
+	cause := xerrors.NewNotFoundError("client", "%s", "123")
+	handlerErr := fmt.Errorf("cannot process: %w", cause)
+
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error { return handlerErr }))
+	event := newTestEvent()
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(xcontext.WithTenant(context.Background(), "a-tenant"), event)
+
+	// THEN the error is not returned
+	require.NoError(t, err)
+
+	// AND the failure is recorded with its details
+	require.Len(t, store.recorded, 1)
+	recorded := store.recorded[0]
+
+	require.Equal(t, EventErrorId(handler.HandlerType(), event), recorded.Id)
+	require.Equal(t, handler.HandlerType(), recorded.HandlerType)
+	require.Equal(t, handlerErr.Error(), recorded.Err)
+	require.Equal(t, []string{cause.Error(), xerrors.ErrNotFound.Error()}, recorded.Causes)
+	require.Equal(t, "not-found", recorded.Code)
+	require.Equal(t, "a-tenant", *recorded.Tenant)
+	require.Equal(t, 1, recorded.Attempts)
+	require.Equal(t, StatusPending, recorded.Status)
+	require.Equal(t, recorder.host, recorded.Host)
+}
+
+func TestWrapper_uses_same_id_for_same_event_and_handler(t *testing.T) {
+	// GIVEN a failing handler
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil)
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error { return errors.New("failed") }))
+	event := newTestEvent()
+
+	// WHEN the same event fails twice, and other event once
+	require.NoError(t, handler.HandleEvent(context.Background(), event))
+	require.NoError(t, handler.HandleEvent(context.Background(), event))
+	require.NoError(t, handler.HandleEvent(context.Background(), newTestEvent()))
+
+	// THEN the same event is recorded with the same id
+	require.Len(t, store.recorded, 3)
+	require.Equal(t, store.recorded[0].Id, store.recorded[1].Id)
+	require.NotEqual(t, store.recorded[0].Id, store.recorded[2].Id)
+}
+
+func TestWrapper_returns_retriable_errors(t *testing.T) {
+	// GIVEN a handler failing with a retriable error
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil)
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error { return retriableError{} }))
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(context.Background(), newTestEvent())
+
+	// THEN the error is returned
+	require.Equal(t, retriableError{}, err)
+
+	// AND it is not recorded
+	require.Empty(t, store.recorded)
+}
+
+func newTestRetryPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     maxAttempts,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		Multiplier:      2,
+	}
+}
+
+func TestWrapper_retries_retriable_errors_until_success(t *testing.T) {
+	// GIVEN a handler failing twice with a retriable error
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil, WithRetryPolicy(newTestRetryPolicy(3)))
+
+	calls := 0
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error {
+		calls++
+		if calls < 3 {
+			return retriableError{}
+		}
+		return nil
+	}))
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(context.Background(), newTestEvent())
+
+	// THEN the handler is retried until it succeeds
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// AND no failure is recorded
+	require.Empty(t, store.recorded)
+}
+
+func TestWrapper_records_failure_after_exhausting_retries(t *testing.T) {
+	// GIVEN a handler always failing with a retriable error
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil, WithRetryPolicy(newTestRetryPolicy(3)))
+
+	calls := 0
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error {
+		calls++
+		return retriableError{}
+	}))
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(context.Background(), newTestEvent())
+
+	// THEN the handler is called max attempts times
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// AND the failure is recorded
+	require.Len(t, store.recorded, 1)
+	require.Equal(t, "retriable", store.recorded[0].Err)
+}
+
+func TestWrapper_does_not_retry_non_retriable_errors(t *testing.T) {
+	// GIVEN a handler failing with a non retriable error
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil, WithRetryPolicy(newTestRetryPolicy(3)))
+
+	calls := 0
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error {
+		calls++
+		return errors.New("failed")
+	}))
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(context.Background(), newTestEvent())
+
+	// THEN the handler is called once and the failure recorded
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Len(t, store.recorded, 1)
+}
+
+func TestWrapper_stops_retrying_when_context_is_canceled(t *testing.T) {
+	// GIVEN a handler that cancels the context and fails with a retriable error
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil, WithRetryPolicy(newTestRetryPolicy(10)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	handler := recorder.wrap(eh.EventHandlerFunc(func(context.Context, eh.Event) error {
+		calls++
+		cancel()
+		return retriableError{}
+	}))
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(ctx, newTestEvent())
+
+	// THEN retries stop and the error is returned
+	require.Equal(t, retriableError{}, err)
+	require.Equal(t, 1, calls)
+
+	// AND it is not recorded
+	require.Empty(t, store.recorded)
+}
+
+func TestRecorder_Wrap_records_failures_and_registers_handler_for_replay(t *testing.T) {
+	// GIVEN a failing handler wrapped by the recorder
+	store := &failureRecorderFake{}
+	recorder := newEventHandlerErrorRecorder(zap.NewNop(), store, nil)
+	target := eh.EventHandlerFunc(func(context.Context, eh.Event) error { return errors.New("failed") })
+
+	handler := recorder.Wrap(target)
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(context.Background(), newTestEvent())
+
+	// THEN the failure is recorded
+	require.NoError(t, err)
+	require.Len(t, store.recorded, 1)
+
+	// AND the handler can be found to replay the event
+	_, found := recorder.Handler(target.HandlerType())
+	require.True(t, found)
+}
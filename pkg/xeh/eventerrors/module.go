@@ -0,0 +1,214 @@
+package eventerrors
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xapi"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"github.com/AltScore/gothic/v2/pkg/xvalidator"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const basePath = "/event-errors"
+
+// Module exposes the Service over HTTP to let operators drain the recorded event errors.
+// All the routes require the given permission.
+type Module struct {
+	service    *Service
+	permission string
+}
+
+var _ xapi.Module = (*Module)(nil)
+
+// NewModule creates a new Module for the service, guarded by the given permission
+func NewModule(service *Service, permission string) *Module {
+	xerrors.EnsureNotEmpty(service, "service")
+	xerrors.EnsureNotEmpty(permission, "permission")
+
+	return &Module{service: service, permission: permission}
+}
+
+// Routes implements the xapi.Module interface
+func (m *Module) Routes() []xapi.Route {
+	return []xapi.Route{
+		m.route(http.MethodGet, basePath, m.list),
+		m.route(http.MethodGet, basePath+"/:id", m.get),
+		m.route(http.MethodPost, basePath+"/replay", m.replayBatch),
+		m.route(http.MethodPost, basePath+"/:id/replay", m.replay),
+		m.route(http.MethodPost, basePath+"/:id/resolve", m.resolve),
+		m.route(http.MethodPost, basePath+"/:id/discard", m.discard),
+	}
+}
+
+func (m *Module) route(method string, path string, handler echo.HandlerFunc) xapi.Route {
+	return xapi.Route{
+		Method:      method,
+		Path:        path,
+		Permissions: []string{m.permission},
+		Handler:     handler,
+	}
+}
+
+type listRequest struct {
+	Filter
+	xpaging.PagingOptions
+}
+
+func (r listRequest) Validate() error {
+	return r.PagingOptions.Validate()
+}
+
+type replayBatchRequest struct {
+	Ids []ids.Id `json:"ids" validate:"required,min=1,max=100"`
+}
+
+func (r replayBatchRequest) Validate() error {
+	return xvalidator.Struct(r)
+}
+
+func (m *Module) list(c echo.Context) error {
+	request, err := xapi.BindValidated[listRequest](c)
+	if err != nil {
+		return err
+	}
+
+	page, err := m.service.List(xapi.FromApi(c), request.Filter, request.PagingOptions)
+	if err != nil {
+		return err
+	}
+
+	items := make([]eventErrorResponse, 0, len(page.Items))
+	for _, eventError := range page.Items {
+		items = append(items, toEventErrorResponse(eventError))
+	}
+
+	return c.JSON(http.StatusOK, xpaging.PaginatedResponse[eventErrorResponse]{
+		Items:         items,
+		PagingOptions: page.PagingOptions,
+		Total:         page.Total,
+	})
+}
+
+func (m *Module) get(c echo.Context) error {
+	id, err := xapi.ParseParamID(c, "id")
+	if err != nil {
+		return err
+	}
+
+	eventError, err := m.service.Get(xapi.FromApi(c), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, toEventErrorResponse(eventError))
+}
+
+func (m *Module) replay(c echo.Context) error {
+	return m.apply(c, m.service.Replay)
+}
+
+func (m *Module) resolve(c echo.Context) error {
+	return m.apply(c, m.service.Resolve)
+}
+
+func (m *Module) discard(c echo.Context) error {
+	return m.apply(c, m.service.Discard)
+}
+
+func (m *Module) replayBatch(c echo.Context) error {
+	request, err := xapi.BindValidated[replayBatchRequest](c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, m.service.ReplayBatch(xapi.FromApi(c), request.Ids))
+}
+
+// apply executes an action over the event error identified by the id path parameter
+func (m *Module) apply(c echo.Context, action func(ctx context.Context, id ids.Id) (EventError, error)) error {
+	id, err := xapi.ParseParamID(c, "id")
+	if err != nil {
+		return err
+	}
+
+	eventError, err := action(xapi.FromApi(c), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, toEventErrorResponse(eventError))
+}
+
+type eventErrorResponse struct {
+	Id           ids.Id        `json:"id"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	UserId       *ids.Id       `json:"userId,omitempty"`
+	Tenant       *string       `json:"tenant,omitempty"`
+	Err          string        `json:"error"`
+	Causes       []string      `json:"causes,omitempty"`
+	Stack        string        `json:"stack,omitempty"`
+	Code         string        `json:"code,omitempty"`
+	HandlerType  string        `json:"handlerType"`
+	Host         string        `json:"host"`
+	Attempts     int           `json:"attempts"`
+	LastFailedAt time.Time     `json:"lastFailedAt"`
+	Status       Status        `json:"status"`
+	ResolvedAt   *time.Time    `json:"resolvedAt,omitempty"`
+	ResolvedBy   *ids.Id       `json:"resolvedBy,omitempty"`
+	Event        eventResponse `json:"event"`
+}
+
+type eventResponse struct {
+	EventType     string                 `json:"eventType"`
+	AggregateType string                 `json:"aggregateType"`
+	AggregateID   ids.Id                 `json:"aggregateId"`
+	Version       int                    `json:"version"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Data          bson.M                 `json:"data,omitempty"`
+}
+
+func toEventErrorResponse(e EventError) eventErrorResponse {
+	status := e.Status
+	if status == "" {
+		status = StatusPending
+	}
+
+	var data bson.M
+	if len(e.Event.RawData) > 0 {
+		// Data is informative, if it cannot be decoded it is not returned
+		_ = bson.Unmarshal(e.Event.RawData, &data)
+	}
+
+	return eventErrorResponse{
+		Id:           e.Id,
+		CreatedAt:    e.CreatedAt,
+		UserId:       e.UserId,
+		Tenant:       e.Tenant,
+		Err:          e.Err,
+		Causes:       e.Causes,
+		Stack:        e.Stack,
+		Code:         e.Code,
+		HandlerType:  e.HandlerType.String(),
+		Host:         e.Host,
+		Attempts:     e.Attempts,
+		LastFailedAt: e.LastFailedAt,
+		Status:       status,
+		ResolvedAt:   e.ResolvedAt,
+		ResolvedBy:   e.ResolvedBy,
+		Event: eventResponse{
+			EventType:     e.Event.EventType.String(),
+			AggregateType: e.Event.AggregateType.String(),
+			AggregateID:   e.Event.AggregateID,
+			Version:       e.Event.Version,
+			Timestamp:     e.Event.Timestamp,
+			Metadata:      e.Event.Metadata,
+			Data:          data,
+		},
+	}
+}
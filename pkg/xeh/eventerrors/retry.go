@@ -0,0 +1,61 @@
+package eventerrors
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// RetriableError is a marker to identify an error that can be retried.
+type RetriableError interface {
+	IsRetriable() bool
+}
+
+func isRetriable(err error) bool {
+	var retriable RetriableError
+	return errors.As(err, &retriable) && retriable.IsRetriable()
+}
+
+// RetryPolicy configures the in process retries of an event handler that fails with a RetriableError.
+// The delay between retries grows exponentially up to MaxInterval, with a random jitter.
+type RetryPolicy struct {
+	MaxAttempts         int           // max number of calls to the handler, including the first one
+	InitialInterval     time.Duration // delay before the first retry
+	MaxInterval         time.Duration // max delay between retries
+	Multiplier          float64       // factor to increase the delay after each retry
+	RandomizationFactor float64       // jitter of the delay, 0.5 means a random delay between 50% and 150% of the interval
+}
+
+// DefaultRetryPolicy returns a policy that calls the handler up to 3 times, starting with a 100ms delay
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:         3,
+		InitialInterval:     100 * time.Millisecond,
+		MaxInterval:         5 * time.Second,
+		Multiplier:          backoff.DefaultMultiplier,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+	}
+}
+
+// newBackOff returns the backoff for the policy, stopping when the context is done
+func (p RetryPolicy) newBackOff(ctx context.Context) backoff.BackOff {
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     p.InitialInterval,
+		RandomizationFactor: p.RandomizationFactor,
+		Multiplier:          p.Multiplier,
+		MaxInterval:         p.MaxInterval,
+		MaxElapsedTime:      0, // limited by max attempts
+		Stop:                backoff.Stop,
+		Clock:               backoff.SystemClock,
+	}
+	b.Reset()
+
+	maxRetries := 0
+	if p.MaxAttempts > 1 {
+		maxRetries = p.MaxAttempts - 1
+	}
+
+	return backoff.WithContext(backoff.WithMaxRetries(b, uint64(maxRetries)), ctx)
+}
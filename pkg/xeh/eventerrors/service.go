@@ -0,0 +1,173 @@
+package eventerrors
+
+import (
+	"context"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	eh "github.com/looplab/eventhorizon"
+	"go.uber.org/zap"
+)
+
+// HandlerResolver finds the event handler that failed to replay the event through it.
+// EventHandlerErrorRecorder implements it with the handlers added to it.
+type HandlerResolver interface {
+	Handler(handlerType eh.EventHandlerType) (eh.EventHandler, bool)
+}
+
+// ReplayResult is the result of replaying an EventError
+type ReplayResult struct {
+	Id     ids.Id `json:"id"`
+	Status Status `json:"status"`
+	Err    string `json:"error,omitempty"`
+}
+
+// Service allows to list, replay, resolve and discard the EventErrors recorded by EventHandlerErrorRecorder.
+type Service struct {
+	logger   *zap.Logger
+	store    Store
+	handlers HandlerResolver
+	now      func() time.Time
+}
+
+// NewService creates a new Service reading the errors from store and replaying them with the handlers
+func NewService(logger *zap.Logger, store Store, handlers HandlerResolver) *Service {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(store, "store")
+	xerrors.EnsureNotEmpty(handlers, "handlers")
+
+	return &Service{
+		logger:   logger,
+		store:    store,
+		handlers: handlers,
+		now:      time.Now,
+	}
+}
+
+// List returns the EventErrors matching the filter, most recent first.
+func (s *Service) List(ctx context.Context, filter Filter, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[EventError], error) {
+	return s.store.Find(ctx, filter, paging)
+}
+
+// Get returns the EventError with the given id
+func (s *Service) Get(ctx context.Context, id ids.Id) (EventError, error) {
+	return s.store.FindById(ctx, id)
+}
+
+// Replay sends the event of a pending EventError to the handler that failed.
+// If the handler succeeds, the error is marked as resolved. If not, the error message is updated, and it is kept pending.
+// The returned error is only for failures not related to the handler.
+func (s *Service) Replay(ctx context.Context, id ids.Id) (EventError, error) {
+	eventError, err := s.findPending(ctx, id)
+	if err != nil {
+		return eventError, err
+	}
+
+	handler, found := s.handlers.Handler(eventError.HandlerType)
+	if !found {
+		return eventError, xerrors.NewNotFoundError("event handler", "%s", eventError.HandlerType)
+	}
+
+	event, err := eventError.Event.ToEvent()
+	if err != nil {
+		return eventError, err
+	}
+
+	if handlerErr := handler.HandleEvent(replayContext(ctx, eventError, event), event); handlerErr != nil {
+		s.logger.Warn("replayed event failed", zap.String("id", id.String()), zap.String("handler", eventError.HandlerType.String()), zap.Error(handlerErr))
+
+		eventError.recordFailure(handlerErr, s.now())
+	} else {
+		s.markAs(ctx, &eventError, StatusResolved)
+	}
+
+	return eventError, s.store.Save(ctx, eventError)
+}
+
+// replayContext returns the context to replay the event, with the tenant, user and correlation ID of the original
+// delivery instead of the ones of the operator replaying it.
+func replayContext(ctx context.Context, eventError EventError, event eh.Event) context.Context {
+	if eventError.Tenant != nil {
+		ctx = xcontext.WithTenant(ctx, *eventError.Tenant)
+	}
+
+	if user, found := xeh.GetEventUser(event); found {
+		ctx = xcontext.WithUser(ctx, user)
+	}
+
+	if correlationId, found := xeh.GetEventCorrelationId(event); found {
+		ctx = xcontext.WithCorrelationId(ctx, correlationId)
+	}
+
+	return xeh.ContextFromEvent(ctx, event)
+}
+
+// ReplayBatch replays each one of the given EventErrors, reporting the result of each one.
+func (s *Service) ReplayBatch(ctx context.Context, errorIds []ids.Id) []ReplayResult {
+	results := make([]ReplayResult, 0, len(errorIds))
+
+	for _, id := range errorIds {
+		eventError, err := s.Replay(ctx, id)
+
+		result := ReplayResult{Id: id, Status: eventError.Status}
+		if err != nil {
+			result.Err = err.Error()
+		} else if eventError.Status == StatusPending {
+			result.Err = eventError.Err
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Resolve marks a pending EventError as resolved without replaying it.
+func (s *Service) Resolve(ctx context.Context, id ids.Id) (EventError, error) {
+	return s.updateStatus(ctx, id, StatusResolved)
+}
+
+// Discard marks a pending EventError as discarded, the event will not be processed.
+func (s *Service) Discard(ctx context.Context, id ids.Id) (EventError, error) {
+	return s.updateStatus(ctx, id, StatusDiscarded)
+}
+
+func (s *Service) updateStatus(ctx context.Context, id ids.Id, status Status) (EventError, error) {
+	eventError, err := s.findPending(ctx, id)
+	if err != nil {
+		return eventError, err
+	}
+
+	s.markAs(ctx, &eventError, status)
+
+	return eventError, s.store.Save(ctx, eventError)
+}
+
+func (s *Service) findPending(ctx context.Context, id ids.Id) (EventError, error) {
+	eventError, err := s.store.FindById(ctx, id)
+	if err != nil {
+		return eventError, err
+	}
+
+	if !eventError.IsPending() {
+		return eventError, xerrors.NewInvalidStateError("event error", "%s is already %s", id, eventError.Status)
+	}
+
+	return eventError, nil
+}
+
+func (s *Service) markAs(ctx context.Context, eventError *EventError, status Status) {
+	now := s.now()
+
+	eventError.Status = status
+	eventError.ResolvedAt = &now
+
+	if user, err := xcontext.GetUser(ctx); err == nil {
+		userId := user.Id()
+		eventError.ResolvedBy = &userId
+	}
+}
@@ -0,0 +1,204 @@
+package eventerrors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"github.com/AltScore/gothic/v2/pkg/xrepo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testHandlerType eh.EventHandlerType = "test-handler"
+
+type inMemoryStore struct {
+	*xrepo.InMemoryRepo[EventError]
+}
+
+func newInMemoryStore() *inMemoryStore {
+	return &inMemoryStore{xrepo.NewInMemoryRepo(func(e EventError) string { return e.Id.String() })}
+}
+
+func (s *inMemoryStore) Find(_ context.Context, _ Filter, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[EventError], error) {
+	items := s.InMemoryRepo.Find(func(EventError) bool { return true })
+	return xpaging.PaginatedResponse[EventError]{Items: items, PagingOptions: paging, Total: int64(len(items))}, nil
+}
+
+func (s *inMemoryStore) FindById(_ context.Context, id ids.Id) (EventError, error) {
+	if eventError, found := s.FindByKey(id.String()); found {
+		return eventError, nil
+	}
+	return EventError{}, xerrors.NewNotFoundError("event error", "%s", id)
+}
+
+func (s *inMemoryStore) Save(_ context.Context, eventError EventError) error {
+	s.Store(eventError)
+	return nil
+}
+
+type handlerResolverFake map[eh.EventHandlerType]eh.EventHandler
+
+func (h handlerResolverFake) Handler(handlerType eh.EventHandlerType) (eh.EventHandler, bool) {
+	handler, found := h[handlerType]
+	return handler, found
+}
+
+func newServiceWithError(handlerErr error) (*Service, *inMemoryStore, EventError, *[]eh.Event) {
+	store := newInMemoryStore()
+	received := &[]eh.Event{}
+
+	handler := eh.EventHandlerFunc(func(_ context.Context, event eh.Event) error {
+		*received = append(*received, event)
+		return handlerErr
+	})
+
+	eventError := EventError{
+		Id:          ids.New(),
+		CreatedAt:   time.Now(),
+		Err:         "original error",
+		HandlerType: testHandlerType,
+		Status:      StatusPending,
+		Event: xeh.EventRecord{
+			EventType:     "test-event",
+			AggregateType: "test-agg",
+			AggregateID:   ids.New(),
+			Version:       3,
+			Timestamp:     time.Now(),
+		},
+	}
+	store.Store(eventError)
+
+	service := NewService(zap.NewNop(), store, handlerResolverFake{testHandlerType: handler})
+
+	return service, store, eventError, received
+}
+
+func TestService_Replay_resolves_error_when_handler_succeeds(t *testing.T) {
+	// GIVEN a pending event error and a handler that succeeds
+	service, store, eventError, received := newServiceWithError(nil)
+
+	// WHEN the error is replayed
+	replayed, err := service.Replay(context.Background(), eventError.Id)
+
+	// THEN the event is sent to the handler
+	require.NoError(t, err)
+	require.Len(t, *received, 1)
+	require.Equal(t, eventError.Event.AggregateID, (*received)[0].AggregateID())
+	require.Equal(t, 3, (*received)[0].Version())
+
+	// AND the error is resolved
+	require.Equal(t, StatusResolved, replayed.Status)
+	require.NotNil(t, replayed.ResolvedAt)
+
+	stored, _ := store.FindById(context.Background(), eventError.Id)
+	require.Equal(t, StatusResolved, stored.Status)
+}
+
+func TestService_Replay_restores_the_context_of_the_event(t *testing.T) {
+	// GIVEN a pending event error of an event caused by a user, and a handler recording its context
+	store := newInMemoryStore()
+	userId := ids.New()
+	tenant := "a-tenant"
+
+	var handledCtx context.Context
+	handler := eh.EventHandlerFunc(func(ctx context.Context, _ eh.Event) error {
+		handledCtx = ctx
+		return nil
+	})
+
+	eventError := EventError{
+		Id:          ids.New(),
+		Tenant:      &tenant,
+		HandlerType: testHandlerType,
+		Status:      StatusPending,
+		Event: xeh.EventRecord{
+			EventType:     "test-event",
+			AggregateType: "test-agg",
+			AggregateID:   ids.New(),
+			Version:       1,
+			Timestamp:     time.Now(),
+			Metadata: map[string]interface{}{
+				xeh.TenantMetadataKey:        tenant,
+				xeh.UserIdMetadataKey:        userId.String(),
+				xeh.CorrelationIdMetadataKey: "a-correlation-id",
+			},
+		},
+	}
+	store.Store(eventError)
+
+	service := NewService(zap.NewNop(), store, handlerResolverFake{testHandlerType: handler})
+
+	// WHEN the error is replayed by an operator in other correlation
+	_, err := service.Replay(xcontext.WithCorrelationId(context.Background(), "operator-correlation-id"), eventError.Id)
+
+	// THEN the handler is called with the tenant, user and correlation ID of the event
+	require.NoError(t, err)
+
+	handledTenant, _ := xcontext.GetTenant(handledCtx)
+	require.Equal(t, tenant, handledTenant)
+
+	user, err := xcontext.GetUser(handledCtx)
+	require.NoError(t, err)
+	require.Equal(t, userId, user.Id())
+
+	correlationId, _ := xcontext.GetCorrelationId(handledCtx)
+	require.Equal(t, "a-correlation-id", correlationId)
+}
+
+func TestService_Replay_keeps_error_pending_when_handler_fails(t *testing.T) {
+	// GIVEN a pending event error and a handler that fails
+	service, store, eventError, _ := newServiceWithError(errors.New("still failing"))
+
+	// WHEN the error is replayed
+	replayed, err := service.Replay(context.Background(), eventError.Id)
+
+	// THEN the error is kept pending with the new error message
+	require.NoError(t, err)
+	require.Equal(t, StatusPending, replayed.Status)
+
+	stored, _ := store.FindById(context.Background(), eventError.Id)
+	require.Equal(t, "still failing", stored.Err)
+}
+
+func TestService_ReplayBatch_reports_each_result(t *testing.T) {
+	// GIVEN a pending event error
+	service, _, eventError, _ := newServiceWithError(nil)
+	unknownId := ids.New()
+
+	// WHEN a batch with it and an unknown error is replayed
+	results := service.ReplayBatch(context.Background(), []ids.Id{eventError.Id, unknownId})
+
+	// THEN each result is reported
+	require.Len(t, results, 2)
+	require.Equal(t, ReplayResult{Id: eventError.Id, Status: StatusResolved}, results[0])
+	require.Equal(t, unknownId, results[1].Id)
+	require.NotEmpty(t, results[1].Err)
+}
+
+func TestService_Discard_only_pending_errors(t *testing.T) {
+	// GIVEN a discarded event error
+	service, _, eventError, received := newServiceWithError(nil)
+
+	discarded, err := service.Discard(context.Background(), eventError.Id)
+	require.NoError(t, err)
+	require.Equal(t, StatusDiscarded, discarded.Status)
+
+	// WHEN it is resolved or replayed
+	_, resolveErr := service.Resolve(context.Background(), eventError.Id)
+	_, replayErr := service.Replay(context.Background(), eventError.Id)
+
+	// THEN an invalid state error is returned
+	require.ErrorIs(t, resolveErr, xerrors.ErrInvalidState)
+	require.ErrorIs(t, replayErr, xerrors.ErrInvalidState)
+
+	// AND the event is not sent to the handler
+	require.Empty(t, *received)
+}
@@ -0,0 +1,182 @@
+package eventerrors
+
+import (
+	"context"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	eh "github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Filter selects the EventErrors to list. Empty fields are not used to filter.
+type Filter struct {
+	Tenant        string              `query:"tenant"`
+	HandlerType   eh.EventHandlerType `query:"handler"`
+	AggregateType eh.AggregateType    `query:"aggregateType"`
+	Status        Status              `query:"status"`
+	From          time.Time           `query:"from"` // inclusive
+	To            time.Time           `query:"to"`   // exclusive
+}
+
+// Store allows to read back and update the recorded EventErrors
+type Store interface {
+	// Find returns the EventErrors matching the filter, most recent first.
+	Find(ctx context.Context, filter Filter, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[EventError], error)
+
+	// FindById returns the EventError with the given id.
+	FindById(ctx context.Context, id ids.Id) (EventError, error)
+
+	// Save updates or creates the given EventError.
+	Save(ctx context.Context, eventError EventError) error
+}
+
+// FailureRecorder records the failures of the event handlers
+type FailureRecorder interface {
+	// Record creates the EventError, or updates the one with the same id incrementing its attempts.
+	Record(ctx context.Context, eventError EventError) error
+}
+
+// MongoStore is a Store for the EventErrors recorded by EventHandlerErrorRecorder in a mongo collection.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+var _ Store = (*MongoStore)(nil)
+var _ FailureRecorder = (*MongoStore)(nil)
+
+// NewMongoStore returns a new MongoStore reading the same database and collection used by the recorder.
+func NewMongoStore(client *mongo.Client, databaseName, collectionName string) *MongoStore {
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+
+	return &MongoStore{collection: client.Database(databaseName).Collection(collectionName)}
+}
+
+// Find implements the Find method of the Store interface.
+func (s *MongoStore) Find(ctx context.Context, filter Filter, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[EventError], error) {
+	paging = paging.Normalized()
+	query := toMongoFilter(filter)
+
+	response := xpaging.PaginatedResponse[EventError]{
+		Items:         []EventError{},
+		PagingOptions: paging,
+	}
+
+	total, err := s.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return response, xmongo.ConvertMongoError(err, "event error", "%v", filter)
+	}
+	response.Total = total
+
+	opts := options.Find().
+		SetSort(xmongo.ConvertSortOptionsToMongo("createdAt", xpaging.DirectionDesc, nil)).
+		SetSkip(paging.Offset).
+		SetLimit(paging.Limit)
+
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return response, xmongo.ConvertMongoError(err, "event error", "%v", filter)
+	}
+
+	if err := cursor.All(ctx, &response.Items); err != nil {
+		return response, xmongo.ConvertMongoError(err, "event error", "%v", filter)
+	}
+
+	return response, nil
+}
+
+// FindById implements the FindById method of the Store interface.
+func (s *MongoStore) FindById(ctx context.Context, id ids.Id) (EventError, error) {
+	var eventError EventError
+
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&eventError)
+
+	return eventError, xmongo.ConvertMongoError(err, "event error", "%s", id)
+}
+
+// Save implements the Save method of the Store interface.
+func (s *MongoStore) Save(ctx context.Context, eventError EventError) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": eventError.Id}, eventError, options.Replace().SetUpsert(true))
+
+	return xmongo.ConvertMongoError(err, "event error", "%s", eventError.Id)
+}
+
+// Record implements the Record method of the FailureRecorder interface.
+// The original event, user and tenant are kept from the first failure.
+func (s *MongoStore) Record(ctx context.Context, eventError EventError) error {
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"createdAt":   eventError.CreatedAt,
+			"userId":      eventError.UserId,
+			"tenant":      eventError.Tenant,
+			"event":       eventError.Event,
+			"handlerType": eventError.HandlerType,
+		},
+		"$set": bson.M{
+			"error":        eventError.Err,
+			"causes":       eventError.Causes,
+			"stack":        eventError.Stack,
+			"code":         eventError.Code,
+			"host":         eventError.Host,
+			"lastFailedAt": eventError.LastFailedAt,
+			"status":       StatusPending,
+		},
+		"$unset": bson.M{
+			"resolvedAt": "",
+			"resolvedBy": "",
+		},
+		"$inc": bson.M{
+			"attempts": 1,
+		},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": eventError.Id}, update, options.Update().SetUpsert(true))
+
+	return xmongo.ConvertMongoError(err, "event error", "%s", eventError.Id)
+}
+
+func toMongoFilter(filter Filter) bson.M {
+	query := bson.M{}
+
+	if filter.Tenant != "" {
+		query["tenant"] = filter.Tenant
+	}
+
+	if filter.HandlerType != "" {
+		query["handlerType"] = filter.HandlerType
+	}
+
+	if filter.AggregateType != "" {
+		query["event.aggregate_type"] = filter.AggregateType
+	}
+
+	switch filter.Status {
+	case "":
+		// no filter
+	case StatusPending:
+		// Errors recorded before status was introduced have no status
+		query["status"] = bson.M{"$nin": []Status{StatusResolved, StatusDiscarded}}
+	default:
+		query["status"] = filter.Status
+	}
+
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+
+	return query
+}
@@ -0,0 +1,97 @@
+package xeh
+
+import (
+	"context"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.uber.org/zap"
+)
+
+// ProcessedEvent identifies an event processed by an event handler
+type ProcessedEvent struct {
+	HandlerType eh.EventHandlerType
+	AggregateID uuid.UUID
+	Version     int
+}
+
+// Ledger records the events already processed by the event handlers
+type Ledger interface {
+	// IsProcessed returns true if the event was recorded as processed
+	IsProcessed(ctx context.Context, processed ProcessedEvent) (bool, error)
+
+	// MarkProcessed records the event as processed
+	MarkProcessed(ctx context.Context, processed ProcessedEvent) error
+}
+
+// IdempotentHandler is an event handler decorator that skips the events already processed by the handler.
+// The event is recorded in the ledger after the handler processes it successfully, so the same event delivered
+// concurrently can still be processed twice.
+// Events without aggregate are always sent to the handler.
+type IdempotentHandler struct {
+	logger  *zap.Logger
+	handler eh.EventHandler
+	ledger  Ledger
+}
+
+var _ eh.EventHandler = (*IdempotentHandler)(nil)
+
+// NewIdempotentHandler creates a new IdempotentHandler decorating the handler, recording the events in the ledger
+func NewIdempotentHandler(logger *zap.Logger, handler eh.EventHandler, ledger Ledger) *IdempotentHandler {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(handler, "handler")
+	xerrors.EnsureNotEmpty(ledger, "ledger")
+
+	return &IdempotentHandler{
+		logger:  logger,
+		handler: handler,
+		ledger:  ledger,
+	}
+}
+
+// NewIdempotentMiddleware returns a middleware that decorates the handlers with an IdempotentHandler
+func NewIdempotentMiddleware(logger *zap.Logger, ledger Ledger) eh.EventHandlerMiddleware {
+	return func(handler eh.EventHandler) eh.EventHandler {
+		return NewIdempotentHandler(logger, handler, ledger)
+	}
+}
+
+// HandlerType implements the HandlerType method of the eh.EventHandler interface.
+func (h *IdempotentHandler) HandlerType() eh.EventHandlerType {
+	return h.handler.HandlerType()
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface.
+func (h *IdempotentHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	if event.AggregateID() == uuid.Nil {
+		return h.handler.HandleEvent(ctx, event)
+	}
+
+	processed := ProcessedEvent{
+		HandlerType: h.handler.HandlerType(),
+		AggregateID: event.AggregateID(),
+		Version:     event.Version(),
+	}
+
+	isProcessed, err := h.ledger.IsProcessed(ctx, processed)
+	if err != nil {
+		return err
+	}
+
+	if isProcessed {
+		h.logger.Debug("skipping already processed event",
+			zap.String("event", event.EventType().String()),
+			zap.String("agg_id", event.AggregateID().String()),
+			zap.Int("agg_version", event.Version()),
+			zap.String("handler", processed.HandlerType.String()),
+		)
+		return nil
+	}
+
+	if err := h.handler.HandleEvent(ctx, event); err != nil {
+		return err
+	}
+
+	return h.ledger.MarkProcessed(ctx, processed)
+}
@@ -0,0 +1,84 @@
+package xeh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type countingHandler struct {
+	handlerType eh.EventHandlerType
+	err         error
+	calls       int
+}
+
+func (h *countingHandler) HandlerType() eh.EventHandlerType { return h.handlerType }
+
+func (h *countingHandler) HandleEvent(context.Context, eh.Event) error {
+	h.calls++
+	return h.err
+}
+
+func newAggregateEvent(id uuid.UUID, version int) eh.Event {
+	return eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate(testAggType, id, version))
+}
+
+func TestIdempotentHandler_skips_already_processed_events(t *testing.T) {
+	// GIVEN an idempotent handler
+	handler := &countingHandler{handlerType: "counting"}
+	idempotent := NewIdempotentHandler(zap.NewNop(), handler, NewInMemoryLedger())
+
+	id := ids.New()
+
+	// WHEN the same event is delivered twice, and the next version once
+	require.NoError(t, idempotent.HandleEvent(context.Background(), newAggregateEvent(id, 1)))
+	require.NoError(t, idempotent.HandleEvent(context.Background(), newAggregateEvent(id, 1)))
+	require.NoError(t, idempotent.HandleEvent(context.Background(), newAggregateEvent(id, 2)))
+
+	// THEN each event is processed once
+	require.Equal(t, 2, handler.calls)
+}
+
+func TestIdempotentHandler_records_events_per_handler(t *testing.T) {
+	// GIVEN two handlers sharing the ledger
+	ledger := NewInMemoryLedger()
+	first := &countingHandler{handlerType: "first"}
+	second := &countingHandler{handlerType: "second"}
+
+	event := newAggregateEvent(ids.New(), 1)
+
+	// WHEN both handle the same event
+	require.NoError(t, NewIdempotentHandler(zap.NewNop(), first, ledger).HandleEvent(context.Background(), event))
+	require.NoError(t, NewIdempotentHandler(zap.NewNop(), second, ledger).HandleEvent(context.Background(), event))
+
+	// THEN both process it
+	require.Equal(t, 1, first.calls)
+	require.Equal(t, 1, second.calls)
+}
+
+func TestIdempotentHandler_does_not_record_failed_events(t *testing.T) {
+	// GIVEN a failing handler
+	handler := &countingHandler{handlerType: "failing", err: errors.New("failed")}
+	ledger := NewInMemoryLedger()
+	idempotent := NewIdempotentHandler(zap.NewNop(), handler, ledger)
+
+	event := newAggregateEvent(ids.New(), 1)
+
+	// WHEN the event is handled
+	err := idempotent.HandleEvent(context.Background(), event)
+
+	// THEN the error is returned
+	require.ErrorIs(t, err, handler.err)
+
+	// AND the event is not recorded, so it can be retried
+	processed, err := ledger.IsProcessed(context.Background(), ProcessedEvent{HandlerType: "failing", AggregateID: event.AggregateID(), Version: 1})
+	require.NoError(t, err)
+	require.False(t, processed)
+}
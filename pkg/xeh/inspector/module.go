@@ -0,0 +1,107 @@
+package inspector
+
+import (
+	"net/http"
+
+	"github.com/AltScore/gothic/v2/pkg/xapi"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/labstack/echo/v4"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+)
+
+const basePath = "/event-store/:aggregateType/:id"
+
+// MIMEApplicationJSONLines is the content type of the exported event streams
+const MIMEApplicationJSONLines = "application/x-ndjson"
+
+// Module exposes the xeh.EventStoreInspector over HTTP to let operators debug the event streams.
+// All the routes require the given permission.
+type Module struct {
+	inspector  *xeh.EventStoreInspector
+	permission string
+}
+
+var _ xapi.Module = (*Module)(nil)
+
+// NewModule creates a new Module for the inspector, guarded by the given permission
+func NewModule(inspector *xeh.EventStoreInspector, permission string) *Module {
+	xerrors.EnsureNotEmpty(inspector, "inspector")
+	xerrors.EnsureNotEmpty(permission, "permission")
+
+	return &Module{inspector: inspector, permission: permission}
+}
+
+// Routes implements the xapi.Module interface
+func (m *Module) Routes() []xapi.Route {
+	return []xapi.Route{
+		m.route(basePath+"/events", m.events),
+		m.route(basePath+"/events/export", m.export),
+		m.route(basePath+"/read-model/diff", m.diff),
+	}
+}
+
+func (m *Module) route(path string, handler echo.HandlerFunc) xapi.Route {
+	return xapi.Route{
+		Method:      http.MethodGet,
+		Path:        path,
+		Permissions: []string{m.permission},
+		Handler:     handler,
+	}
+}
+
+func (m *Module) events(c echo.Context) error {
+	aggregateType, id, err := parseAggregate(c)
+	if err != nil {
+		return err
+	}
+
+	events, err := m.inspector.Events(xapi.FromApi(c), aggregateType, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, events)
+}
+
+func (m *Module) export(c echo.Context) error {
+	aggregateType, id, err := parseAggregate(c)
+	if err != nil {
+		return err
+	}
+
+	events, err := m.inspector.Events(xapi.FromApi(c), aggregateType, id)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationJSONLines)
+	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\""+id.String()+".jsonl\"")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return xeh.WriteJSONLines(c.Response(), events)
+}
+
+func (m *Module) diff(c echo.Context) error {
+	aggregateType, id, err := parseAggregate(c)
+	if err != nil {
+		return err
+	}
+
+	diff, err := m.inspector.Diff(xapi.FromApi(c), aggregateType, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+func parseAggregate(c echo.Context) (eh.AggregateType, uuid.UUID, error) {
+	id, err := xapi.ParseParamID(c, "id")
+	if err != nil {
+		return "", id, err
+	}
+
+	return eh.AggregateType(c.Param("aggregateType")), id, nil
+}
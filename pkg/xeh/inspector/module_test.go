@@ -0,0 +1,66 @@
+package inspector
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/restest"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+const testAggType eh.AggregateType = "test-agg"
+
+func newTestInspector(id uuid.UUID) *xeh.EventStoreInspector {
+	timestamp := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	eventStore := &ehmocks.EventStoreMock{}
+	eventStore.On("Load", mock.Anything, id).Return([]eh.Event{
+		eh.NewEvent("created", nil, timestamp, eh.ForAggregate(testAggType, id, 1), eh.WithMetadata(map[string]interface{}{"tenant": "a-tenant"})),
+		eh.NewEvent("updated", nil, timestamp, eh.ForAggregate(testAggType, id, 2)),
+	}, nil)
+	eventStore.On("Load", mock.Anything, mock.Anything).Return(nil, nil)
+
+	return xeh.NewEventStoreInspector(eventStore)
+}
+
+func TestModule_lists_events(t *testing.T) {
+	id := uuid.New()
+
+	m := restest.For(t)
+
+	m.Given().
+		Module(NewModule(newTestInspector(id), "event-store:read")).
+		Method(http.MethodGet)
+
+	m.When().
+		CallsPath("/event-store/%s/%s/events", testAggType, id)
+
+	m.Then().
+		StatusCodeIs(http.StatusOK).
+		BodyIs(m.Json(`[
+			{"eventType": "created", "aggregateType": "test-agg", "aggregateId": "` + id.String() + `", "version": 1, "timestamp": "2023-05-01T10:00:00Z", "metadata": {"tenant": "a-tenant"}},
+			{"eventType": "updated", "aggregateType": "test-agg", "aggregateId": "` + id.String() + `", "version": 2, "timestamp": "2023-05-01T10:00:00Z"}
+		]`))
+}
+
+func TestModule_exports_events_as_json_lines(t *testing.T) {
+	id := uuid.New()
+
+	m := restest.For(t)
+
+	m.Given().
+		Module(NewModule(newTestInspector(id), "event-store:read")).
+		Method(http.MethodGet)
+
+	m.When().
+		CallsPath("/event-store/%s/%s/events/export", testAggType, id)
+
+	m.Then().
+		StatusCodeIs(http.StatusOK).
+		ContentTypeIs(MIMEApplicationJSONLines)
+}
@@ -0,0 +1,38 @@
+package xeh
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AltScore/gothic/v2/pkg/xrepo"
+)
+
+// InMemoryLedger is a Ledger that keeps the processed events in memory, without expiration. Useful for tests.
+type InMemoryLedger struct {
+	processed *xrepo.InMemoryRepo[ProcessedEvent]
+}
+
+var _ Ledger = (*InMemoryLedger)(nil)
+
+// NewInMemoryLedger creates a new empty InMemoryLedger
+func NewInMemoryLedger() *InMemoryLedger {
+	return &InMemoryLedger{
+		processed: xrepo.NewInMemoryRepo(processedEventKey),
+	}
+}
+
+func processedEventKey(p ProcessedEvent) string {
+	return fmt.Sprintf("%s/%s/%d", p.HandlerType, p.AggregateID, p.Version)
+}
+
+// IsProcessed implements the IsProcessed method of the Ledger interface.
+func (l *InMemoryLedger) IsProcessed(_ context.Context, processed ProcessedEvent) (bool, error) {
+	_, found := l.processed.FindByKey(processedEventKey(processed))
+	return found, nil
+}
+
+// MarkProcessed implements the MarkProcessed method of the Ledger interface.
+func (l *InMemoryLedger) MarkProcessed(_ context.Context, processed ProcessedEvent) error {
+	l.processed.Store(processed)
+	return nil
+}
@@ -0,0 +1,91 @@
+package xeh
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MongoLedger is a Ledger that keeps the processed events in a mongo collection.
+// The records expire after the retention period, so it must be longer than the time an event can be redelivered.
+type MongoLedger struct {
+	collection *mongo.Collection
+}
+
+var _ Ledger = (*MongoLedger)(nil)
+
+type processedEventDocument struct {
+	Id          ids.Id              `bson:"_id"`
+	HandlerType eh.EventHandlerType `bson:"handlerType"`
+	AggregateID uuid.UUID           `bson:"aggregateId"`
+	Version     int                 `bson:"version"`
+	ProcessedAt time.Time           `bson:"processedAt"`
+}
+
+// NewMongoLedger creates a new MongoLedger using the given database and collection.
+// It creates the TTL index that deletes the records after the retention period.
+func NewMongoLedger(logger *zap.Logger, client *mongo.Client, databaseName, collectionName string, retention time.Duration) *MongoLedger {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	xmongo.CreateIndexes(logger, collection, mongo.IndexModel{
+		Keys: bson.D{{Key: "processedAt", Value: 1}},
+		Options: options.Index().
+			SetName("processed_ttl").
+			SetExpireAfterSeconds(int32(retention.Seconds())),
+	})
+
+	return &MongoLedger{collection: collection}
+}
+
+func processedEventId(p ProcessedEvent) ids.Id {
+	return ids.NewID(p.HandlerType, p.AggregateID, p.Version)
+}
+
+// IsProcessed implements the IsProcessed method of the Ledger interface.
+func (l *MongoLedger) IsProcessed(ctx context.Context, processed ProcessedEvent) (bool, error) {
+	id := processedEventId(processed)
+
+	count, err := l.collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, xmongo.ConvertMongoError(err, "processed event", "%s", id)
+	}
+
+	return count > 0, nil
+}
+
+// MarkProcessed implements the MarkProcessed method of the Ledger interface.
+// When the event is marked by other handler at the same time, the upsert can fail with a duplicate key error, and
+// the event is already marked as processed.
+func (l *MongoLedger) MarkProcessed(ctx context.Context, processed ProcessedEvent) error {
+	doc := processedEventDocument{
+		Id:          processedEventId(processed),
+		HandlerType: processed.HandlerType,
+		AggregateID: processed.AggregateID,
+		Version:     processed.Version,
+		ProcessedAt: time.Now(),
+	}
+
+	_, err := l.collection.ReplaceOne(ctx, bson.M{"_id": doc.Id}, doc, options.Replace().SetUpsert(true))
+
+	err = xmongo.ConvertMongoError(err, "processed event", "%s", doc.Id)
+	if errors.Is(err, xerrors.ErrDuplicate) {
+		return nil
+	}
+
+	return err
+}
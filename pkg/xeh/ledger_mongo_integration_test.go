@@ -0,0 +1,87 @@
+//go:build integration
+
+package xeh
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+func newTestMongoLedger(t *testing.T) *MongoLedger {
+	ledger := NewMongoLedger(zap.NewNop(), mongoInMemory.Client(), "test", "processed-"+ids.New().String(), time.Hour)
+
+	t.Cleanup(func() { _ = ledger.collection.Drop(context.Background()) })
+
+	return ledger
+}
+
+func TestMongoLedger_records_processed_events(t *testing.T) {
+	// GIVEN a ledger with an event marked as processed
+	ctx := context.Background()
+	ledger := newTestMongoLedger(t)
+	processed := ProcessedEvent{HandlerType: "projector", AggregateID: ids.New(), Version: 2}
+
+	require.NoError(t, ledger.MarkProcessed(ctx, processed))
+
+	// WHEN the events are checked
+	found, err := ledger.IsProcessed(ctx, processed)
+	require.NoError(t, err)
+	otherVersion, err := ledger.IsProcessed(ctx, ProcessedEvent{HandlerType: "projector", AggregateID: processed.AggregateID, Version: 3})
+	require.NoError(t, err)
+	otherHandler, err := ledger.IsProcessed(ctx, ProcessedEvent{HandlerType: "saga", AggregateID: processed.AggregateID, Version: 2})
+	require.NoError(t, err)
+
+	// THEN only the marked event of the handler is processed
+	require.True(t, found)
+	require.False(t, otherVersion)
+	require.False(t, otherHandler)
+
+	// AND the records expire after the retention period
+	cursor, err := ledger.collection.Indexes().List(ctx)
+	require.NoError(t, err)
+	var indexes []bson.M
+	require.NoError(t, cursor.All(ctx, &indexes))
+
+	var expireAfter interface{}
+	for _, index := range indexes {
+		if index["name"] == "processed_ttl" {
+			expireAfter = index["expireAfterSeconds"]
+		}
+	}
+	require.EqualValues(t, 3600, expireAfter)
+}
+
+func TestMongoLedger_marks_the_same_event_concurrently(t *testing.T) {
+	// GIVEN an event delivered many times at once
+	ctx := context.Background()
+	ledger := newTestMongoLedger(t)
+	processed := ProcessedEvent{HandlerType: "projector", AggregateID: ids.New(), Version: 1}
+
+	// WHEN it is marked as processed by all the deliveries
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ledger.MarkProcessed(ctx, processed)
+		}(i)
+	}
+	wg.Wait()
+
+	// THEN none fails, and it is recorded once
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	count, err := ledger.collection.CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, count)
+}
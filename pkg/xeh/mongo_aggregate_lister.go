@@ -0,0 +1,68 @@
+package xeh
+
+import (
+	"context"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoAggregateLister lists the aggregates stored by the Event Horizon mongo event stores.
+// It reads the collection with one document per aggregate: "streams" for mongodb_v2 and "events" for mongodb.
+// The streams have the aggregate type in the aggregate_type field, while the aggregates of mongodb only have it in
+// their events, so both are matched.
+type MongoAggregateLister struct {
+	collection *mongo.Collection
+}
+
+var _ AggregateLister = (*MongoAggregateLister)(nil)
+
+// NewMongoAggregateLister creates a new MongoAggregateLister reading the given database and collection.
+func NewMongoAggregateLister(client *mongo.Client, databaseName, collectionName string) *MongoAggregateLister {
+	return &MongoAggregateLister{
+		collection: client.Database(databaseName).Collection(collectionName),
+	}
+}
+
+// ListAggregateIDs implements the AggregateLister interface.
+func (l *MongoAggregateLister) ListAggregateIDs(ctx context.Context, aggType eh.AggregateType, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"aggregate_type": aggType},
+			bson.M{"events.aggregate_type": aggType},
+		},
+	}
+
+	if ids.IsNotEmpty(after) {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"_id": 1}).
+		SetLimit(int64(limit))
+
+	cursor, err := l.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID uuid.UUID `bson:"_id"`
+	}
+
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	aggregateIDs := make([]uuid.UUID, 0, len(docs))
+	for _, doc := range docs {
+		aggregateIDs = append(aggregateIDs, doc.ID)
+	}
+
+	return aggregateIDs, nil
+}
@@ -0,0 +1,76 @@
+//go:build integration
+
+package xeh
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect()
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+func TestMongoAggregateLister_lists_mongodb_v2_streams(t *testing.T) {
+	// GIVEN a streams collection, as stored by mongodb_v2, with aggregates of two types
+	ctx := context.Background()
+	collectionName := "streams-" + ids.New().String()
+	collection := mongoInMemory.Client().Database("test").Collection(collectionName)
+	t.Cleanup(func() { _ = collection.Drop(ctx) })
+
+	aggIds := newSortedIds(3)
+	for _, id := range aggIds {
+		_, err := collection.InsertOne(ctx, bson.M{"_id": id, "aggregate_type": testAggType, "version": 1})
+		require.NoError(t, err)
+	}
+	_, err := collection.InsertOne(ctx, bson.M{"_id": ids.New(), "aggregate_type": "other", "version": 1})
+	require.NoError(t, err)
+
+	lister := NewMongoAggregateLister(mongoInMemory.Client(), "test", collectionName)
+
+	// WHEN the aggregates of the type are listed after the first one
+	found, err := lister.ListAggregateIDs(ctx, testAggType, aggIds[0], 10)
+
+	// THEN the following ones are returned
+	require.NoError(t, err)
+	require.Equal(t, aggIds[1:], found)
+}
+
+func TestMongoAggregateLister_lists_mongodb_aggregates(t *testing.T) {
+	// GIVEN an events collection, as stored by mongodb, with the aggregate type only in the events
+	ctx := context.Background()
+	collectionName := "events-" + ids.New().String()
+	collection := mongoInMemory.Client().Database("test").Collection(collectionName)
+	t.Cleanup(func() { _ = collection.Drop(ctx) })
+
+	aggIds := newSortedIds(2)
+	for _, id := range aggIds {
+		_, err := collection.InsertOne(ctx, bson.M{
+			"_id":     id,
+			"version": 1,
+			"events":  bson.A{bson.M{"event_type": "created", "aggregate_type": testAggType, "_id": id, "version": 1}},
+		})
+		require.NoError(t, err)
+	}
+
+	lister := NewMongoAggregateLister(mongoInMemory.Client(), "test", collectionName)
+
+	// WHEN the aggregates of the type are listed
+	found, err := lister.ListAggregateIDs(ctx, testAggType, ids.Empty(), 10)
+
+	// THEN all are returned
+	require.NoError(t, err)
+	require.Equal(t, aggIds, found)
+}
@@ -0,0 +1,71 @@
+package xeh
+
+import (
+	"context"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	eh "github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoReadRepo is a QueryableReadRepo for a mongo read repository, running the queries in the database.
+// Filters are translated with Filter.ToMongo and sorts with xmongo.ConvertSortOptionsToMongo.
+type MongoReadRepo[Entity eh.Entity] struct {
+	*TypedReadRepo[Entity]
+	collection *mongo.Collection
+}
+
+var _ QueryableReadRepo[eh.Entity] = (*MongoReadRepo[eh.Entity])(nil)
+
+// NewMongoReadRepo creates a new MongoReadRepo wrapping the repo, querying the collection where it stores the entities.
+func NewMongoReadRepo[Entity eh.Entity](repo eh.ReadRepo, collection *mongo.Collection) *MongoReadRepo[Entity] {
+	xerrors.EnsureNotEmpty(collection, "collection")
+
+	return &MongoReadRepo[Entity]{
+		TypedReadRepo: NewTypedReadRepo[Entity](repo),
+		collection:    collection,
+	}
+}
+
+// FindWhere implements the FindWhere method of the QueryableReadRepo interface.
+// Without sort options, entities are sorted by ID.
+func (r *MongoReadRepo[Entity]) FindWhere(ctx context.Context, filter Filter, sort xpaging.SortOptions, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[Entity], error) {
+	paging = paging.Normalized()
+	query := filter.ToMongo()
+
+	response := xpaging.PaginatedResponse[Entity]{Items: []Entity{}, PagingOptions: paging}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return response, xmongo.ConvertMongoError(err, r.collection.Name(), "%v", query)
+	}
+	response.Total = total
+
+	opts := options.Find().
+		SetSort(xmongo.ConvertSortOptionsToMongo("_id", xpaging.DirectionAsc, sort)).
+		SetSkip(paging.Offset).
+		SetLimit(paging.Limit)
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return response, xmongo.ConvertMongoError(err, r.collection.Name(), "%v", query)
+	}
+
+	if err := cursor.All(ctx, &response.Items); err != nil {
+		return response, xmongo.ConvertMongoError(err, r.collection.Name(), "%v", query)
+	}
+
+	return response, nil
+}
+
+// Count implements the Count method of the QueryableReadRepo interface.
+func (r *MongoReadRepo[Entity]) Count(ctx context.Context, filter Filter) (int64, error) {
+	query := filter.ToMongo()
+
+	count, err := r.collection.CountDocuments(ctx, query)
+
+	return count, xmongo.ConvertMongoError(err, r.collection.Name(), "%v", query)
+}
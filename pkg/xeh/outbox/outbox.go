@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const outboxHandlerType eh.EventHandlerType = "outbox"
+
+// Message is an event stored in the outbox waiting to be published
+type Message struct {
+	Id             ids.Id          `bson:"_id"`
+	Event          xeh.EventRecord `bson:"event"`
+	CreatedAt      time.Time       `bson:"createdAt"`
+	Attempts       int             `bson:"attempts"`                 // The number of times the relay tried to publish it
+	LockedUntil    *time.Time      `bson:"lockedUntil,omitempty"`    // A relay is publishing it until this time
+	PublishedAt    *time.Time      `bson:"publishedAt,omitempty"`    // When it was published, nil if pending
+	LastError      string          `bson:"lastError,omitempty"`      // The error of the last failed attempt
+	DeadLetteredAt *time.Time      `bson:"deadLetteredAt,omitempty"` // When it was given up, it is not published anymore
+}
+
+// Outbox stores the events to publish in a mongo collection, in the same transaction used to write the read models.
+// A Relay publishes them later, so the events are not lost if the process crashes after writing the read models.
+//
+// Outbox implements eh.EventHandler, so it can be used where an event bus is expected to publish events.
+type Outbox struct {
+	collection *mongo.Collection
+	now        func() time.Time
+}
+
+var _ eh.EventHandler = (*Outbox)(nil)
+
+// NewOutbox creates a new Outbox storing the events in the given database and collection
+func NewOutbox(client *mongo.Client, databaseName, collectionName string) *Outbox {
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+
+	return &Outbox{
+		collection: client.Database(databaseName).Collection(collectionName),
+		now:        time.Now,
+	}
+}
+
+// CreateIndexes creates the indexes used by the Relay to find the pending and the old published messages
+func (o *Outbox) CreateIndexes(logger *zap.Logger) {
+	xmongo.CreateIndexes(logger, o.collection,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "publishedAt", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("outbox_pending"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "event.aggregate_id", Value: 1}, {Key: "event.version", Value: 1}},
+			Options: options.Index().SetName("outbox_aggregate"),
+		},
+	)
+}
+
+// Add stores the events in the outbox.
+// To store them atomically with other writes, ctx must be the mongo.SessionContext of the transaction,
+// i.e. the one given by xmongo.WithTransaction.
+func (o *Outbox) Add(ctx context.Context, events ...eh.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := o.now()
+	documents := make([]interface{}, 0, len(events))
+
+	for _, event := range events {
+		record, err := xeh.NewEventRecord(event)
+		if err != nil {
+			return err
+		}
+
+		documents = append(documents, Message{
+			Id:        ids.New(),
+			Event:     record,
+			CreatedAt: now,
+		})
+	}
+
+	_, err := o.collection.InsertMany(ctx, documents)
+
+	return xmongo.ConvertMongoError(err, "outbox message", "%s", events[0])
+}
+
+// HandlerType implements the HandlerType method of the eh.EventHandler interface.
+func (o *Outbox) HandlerType() eh.EventHandlerType {
+	return outboxHandlerType
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface, adding the event to the outbox.
+func (o *Outbox) HandleEvent(ctx context.Context, event eh.Event) error {
+	return o.Add(ctx, event)
+}
@@ -0,0 +1,288 @@
+//go:build integration
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/local"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect(xmongo.WithReplicaSet())
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+type failingBus struct {
+	eh.EventBus
+	failures int
+}
+
+func (b *failingBus) HandleEvent(ctx context.Context, event eh.Event) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("bus not available")
+	}
+	return b.EventBus.HandleEvent(ctx, event)
+}
+
+type aggregateFailingBus struct {
+	eh.EventBus
+	failing ids.Id
+	calls   int
+}
+
+func (b *aggregateFailingBus) HandleEvent(ctx context.Context, event eh.Event) error {
+	if event.AggregateID() == b.failing {
+		b.calls++
+		return errors.New("bus not available")
+	}
+	return b.EventBus.HandleEvent(ctx, event)
+}
+
+func newTestOutbox(t *testing.T) *Outbox {
+	outbox := NewOutbox(mongoInMemory.Client(), "test", "outbox-"+ids.New().String())
+	outbox.CreateIndexes(zap.NewNop())
+
+	t.Cleanup(func() { _ = outbox.collection.Drop(context.Background()) })
+
+	return outbox
+}
+
+func newTestEvent(aggregateId ids.Id, version int) eh.Event {
+	return eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate("test-agg", aggregateId, version))
+}
+
+// addInTransaction writes a document and adds the events to the outbox in the same transaction
+func addInTransaction(t *testing.T, outbox *Outbox, abort bool, events ...eh.Event) {
+	ctx := context.Background()
+	models := mongoInMemory.Client().Database("test").Collection("models")
+
+	session, err := mongoInMemory.Client().StartSession()
+	require.NoError(t, err)
+	defer session.EndSession(ctx)
+
+	_, _ = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		if _, err := models.InsertOne(sessionCtx, bson.M{"_id": ids.New()}); err != nil {
+			return nil, err
+		}
+
+		if err := outbox.Add(sessionCtx, events...); err != nil {
+			return nil, err
+		}
+
+		if abort {
+			return nil, errors.New("aborted")
+		}
+		return nil, nil
+	})
+}
+
+func TestOutbox_stores_events_only_when_transaction_commits(t *testing.T) {
+	// GIVEN an outbox
+	outbox := newTestOutbox(t)
+
+	// WHEN events are added in a committed and in an aborted transaction
+	addInTransaction(t, outbox, false, newTestEvent(ids.New(), 1))
+	addInTransaction(t, outbox, true, newTestEvent(ids.New(), 1))
+
+	// THEN only the events of the committed transaction are stored
+	count, err := outbox.collection.CountDocuments(context.Background(), bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func TestRelay_publishes_pending_events_in_order_retrying_failures(t *testing.T) {
+	// GIVEN an outbox with the events of an aggregate
+	outbox := newTestOutbox(t)
+	aggregateId := ids.New()
+	addInTransaction(t, outbox, false, newTestEvent(aggregateId, 1), newTestEvent(aggregateId, 2), newTestEvent(aggregateId, 3))
+
+	// AND a bus that fails the first time
+	var received []eh.Event
+	target := local.NewEventBus()
+	require.NoError(t, target.AddHandler(context.Background(), eh.MatchAll{}, eh.EventHandlerFunc(func(_ context.Context, event eh.Event) error {
+		received = append(received, event)
+		return nil
+	})))
+
+	relay := NewRelay(zap.NewNop(), outbox, &failingBus{EventBus: target, failures: 1})
+
+	// WHEN the pending events are relayed twice
+	published, err := relay.RelayPending(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 0, published)
+
+	published, err = relay.RelayPending(context.Background())
+
+	// THEN all the events are published in order
+	require.NoError(t, err)
+	require.Equal(t, 3, published)
+
+	require.Eventually(t, func() bool { return len(received) == 3 }, 5*time.Second, 10*time.Millisecond)
+	for i, event := range received {
+		require.Equal(t, i+1, event.Version())
+	}
+
+	// AND nothing is pending
+	published, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+}
+
+func newTestTarget(t *testing.T) (eh.EventBus, *[]eh.Event) {
+	var received []eh.Event
+	target := local.NewEventBus()
+	require.NoError(t, target.AddHandler(context.Background(), eh.MatchAll{}, eh.EventHandlerFunc(func(_ context.Context, event eh.Event) error {
+		received = append(received, event)
+		return nil
+	})))
+	return target, &received
+}
+
+func TestRelay_moves_poison_messages_to_dead_letter(t *testing.T) {
+	// GIVEN an outbox with an event that cannot be rebuilt, as its data is not registered, followed by other event
+	outbox := newTestOutbox(t)
+	poison := Message{
+		Id:        ids.New(),
+		Event:     xeh.EventRecord{EventType: "unregistered-event", AggregateType: "test-agg", AggregateID: ids.New(), Version: 1, RawData: bson.Raw{5, 0, 0, 0, 0}},
+		CreatedAt: time.Now().Add(-time.Minute),
+	}
+	_, err := outbox.collection.InsertOne(context.Background(), poison)
+	require.NoError(t, err)
+	addInTransaction(t, outbox, false, newTestEvent(ids.New(), 1))
+
+	target, received := newTestTarget(t)
+	relay := NewRelay(zap.NewNop(), outbox, target)
+
+	// WHEN the pending events are relayed
+	published, err := relay.RelayPending(context.Background())
+
+	// THEN the other event is published
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+	require.Eventually(t, func() bool { return len(*received) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// AND the poison message is dead lettered
+	var stored Message
+	require.NoError(t, outbox.collection.FindOne(context.Background(), bson.M{"_id": poison.Id}).Decode(&stored))
+	require.NotNil(t, stored.DeadLetteredAt)
+	require.NotEmpty(t, stored.LastError)
+}
+
+func TestRelay_publishes_other_aggregates_while_one_fails(t *testing.T) {
+	// GIVEN an outbox with the events of two aggregates
+	outbox := newTestOutbox(t)
+	failing, other := ids.New(), ids.New()
+	addInTransaction(t, outbox, false, newTestEvent(failing, 1), newTestEvent(failing, 2), newTestEvent(other, 1))
+
+	// AND a bus that always fails for the first aggregate
+	target, received := newTestTarget(t)
+	bus := &aggregateFailingBus{EventBus: target, failing: failing}
+	relay := NewRelay(zap.NewNop(), outbox, bus, WithMaxAttempts(2))
+
+	// WHEN the pending events are relayed
+	published, err := relay.RelayPending(context.Background())
+
+	// THEN the event of the other aggregate is published, and the following event of the failing one waits
+	require.Error(t, err)
+	require.Equal(t, 1, published)
+	require.Eventually(t, func() bool { return len(*received) == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, other, (*received)[0].AggregateID())
+
+	// WHEN it fails up to the max attempts
+	bus.calls = 0
+	published, err = relay.RelayPending(context.Background())
+
+	// THEN the failing event is dead lettered, and the next one is tried
+	require.Error(t, err)
+	require.Equal(t, 0, published)
+	require.Equal(t, 2, bus.calls)
+
+	count, err := outbox.collection.CountDocuments(context.Background(), bson.M{"deadLetteredAt": bson.M{"$ne": nil}})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func TestRelay_waits_for_earlier_events_locked_by_other_relay(t *testing.T) {
+	// GIVEN an outbox with the events of an aggregate, where the first one is locked by a relay that crashed
+	outbox := newTestOutbox(t)
+	aggregateId := ids.New()
+	addInTransaction(t, outbox, false, newTestEvent(aggregateId, 1), newTestEvent(aggregateId, 2))
+
+	_, err := outbox.collection.UpdateOne(context.Background(),
+		bson.M{"event.aggregate_id": aggregateId, "event.version": 1},
+		bson.M{"$set": bson.M{"lockedUntil": time.Now().Add(time.Minute)}},
+	)
+	require.NoError(t, err)
+
+	target, received := newTestTarget(t)
+	relay := NewRelay(zap.NewNop(), outbox, target)
+
+	// WHEN the pending events are relayed
+	published, err := relay.RelayPending(context.Background())
+
+	// THEN the second event is not published before the first one, and it is released without counting the attempt
+	require.NoError(t, err)
+	require.Equal(t, 0, published)
+
+	var second Message
+	require.NoError(t, outbox.collection.FindOne(context.Background(), bson.M{"event.version": 2}).Decode(&second))
+	require.Equal(t, 0, second.Attempts)
+	require.Nil(t, second.LockedUntil)
+
+	// WHEN the lock of the first one expires
+	outbox.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	published, err = relay.RelayPending(context.Background())
+
+	// THEN both are published in order
+	require.NoError(t, err)
+	require.Equal(t, 2, published)
+	require.Eventually(t, func() bool { return len(*received) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, (*received)[0].Version())
+	require.Equal(t, 2, (*received)[1].Version())
+
+	// AND their leases are released
+	count, err := outbox.collection.CountDocuments(context.Background(), bson.M{"$or": bson.A{
+		bson.M{"lockedUntil": bson.M{"$exists": true}},
+		bson.M{"lockedBy": bson.M{"$exists": true}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
+
+func TestRelay_deletes_published_events_after_retention(t *testing.T) {
+	// GIVEN an outbox with a published event
+	outbox := newTestOutbox(t)
+	addInTransaction(t, outbox, false, newTestEvent(ids.New(), 1))
+
+	relay := NewRelay(zap.NewNop(), outbox, local.NewEventBus(), WithRetention(time.Hour))
+	_, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+
+	// WHEN the published events are deleted after the retention period
+	outbox.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	require.NoError(t, relay.DeletePublished(context.Background()))
+
+	// THEN the outbox is empty
+	count, err := outbox.collection.CountDocuments(context.Background(), bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
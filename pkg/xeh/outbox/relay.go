@@ -0,0 +1,269 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/cenkalti/backoff/v4"
+	eh "github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultLockDuration = 30 * time.Second
+	defaultRetention    = 24 * time.Hour
+	defaultMaxAttempts  = 10
+)
+
+// Relay publishes the events stored in an Outbox to an event bus, with at-least-once delivery.
+// An event is marked as published after the bus accepts it; if the process crashes in between it is published again.
+// The messages are locked while they are published, so many relays can run on the same outbox. The order of the
+// events of an aggregate is kept: an event is not published while an earlier event of its aggregate is pending, even
+// if it is locked by other relay, or by one that crashed, until its lock expires. When an event cannot be published,
+// the following events of its aggregate wait for it, while the events of other aggregates are published.
+// A message failing with a permanent error (see backoff.Permanent), or after the max attempts, is moved to the dead
+// letter state and not retried anymore, so it does not block its aggregate. To retry it, unset its deadLetteredAt.
+// Published messages are deleted after the retention period.
+type Relay struct {
+	logger       *zap.Logger
+	outbox       *Outbox
+	target       eh.EventBus
+	pollInterval time.Duration
+	lockDuration time.Duration
+	retention    time.Duration
+	maxAttempts  int
+	lease        *xmongo.Lease
+}
+
+// RelayOption configures a Relay
+type RelayOption func(*Relay)
+
+// WithPollInterval sets how often the outbox is checked for pending messages. Default is 1 second.
+func WithPollInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithLockDuration sets how long a message is locked while published, before other relay can take it.
+// It must be longer than the time to publish an event. Default is 30 seconds.
+func WithLockDuration(duration time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.lockDuration = duration
+	}
+}
+
+// WithRetention sets how long the published messages are kept before deleting them. Default is 24 hours.
+func WithRetention(retention time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.retention = retention
+	}
+}
+
+// WithMaxAttempts sets how many times a message is published before moving it to the dead letter state.
+// Default is 10.
+func WithMaxAttempts(maxAttempts int) RelayOption {
+	return func(r *Relay) {
+		r.maxAttempts = maxAttempts
+	}
+}
+
+// NewRelay creates a new Relay publishing the messages of the outbox to the target bus
+func NewRelay(logger *zap.Logger, outbox *Outbox, target eh.EventBus, options ...RelayOption) *Relay {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(outbox, "outbox")
+	xerrors.EnsureNotEmpty(target, "target")
+
+	r := &Relay{
+		logger:       logger.Named("outbox relay"),
+		outbox:       outbox,
+		target:       target,
+		pollInterval: defaultPollInterval,
+		lockDuration: defaultLockDuration,
+		retention:    defaultRetention,
+		maxAttempts:  defaultMaxAttempts,
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	r.lease = xmongo.NewLease(outbox.collection,
+		bson.D{{Key: "createdAt", Value: 1}, {Key: "event.aggregate_id", Value: 1}, {Key: "event.version", Value: 1}},
+	)
+
+	return r
+}
+
+// Run publishes the pending messages and deletes the old published ones every poll interval, until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Warn("could not relay outbox messages", zap.Error(err))
+		}
+
+		if err := r.DeletePublished(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Warn("could not delete published outbox messages", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the pending messages, oldest first, and returns the number of published messages.
+// When a message cannot be published, the following messages of its aggregate are skipped, and it is retried first
+// in the next call. Returns the first error publishing a message, after relaying the messages of the other aggregates.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+	var blocked []ids.Id
+	var firstErr error
+
+	for ctx.Err() == nil {
+		message, found, err := r.lockNext(ctx, blocked)
+		if err != nil {
+			return published, err
+		}
+		if !found {
+			return published, firstErr
+		}
+
+		waiting, err := r.waitsForEarlier(ctx, message)
+		if err != nil {
+			return published, err
+		}
+		if waiting {
+			blocked = append(blocked, message.Event.AggregateID)
+			continue
+		}
+
+		deadLettered, err := r.publish(ctx, message)
+		if err != nil {
+			blocked = append(blocked, message.Event.AggregateID)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if !deadLettered {
+			published++
+		}
+	}
+
+	return published, ctx.Err()
+}
+
+// DeletePublished deletes the messages published before the retention period
+func (r *Relay) DeletePublished(ctx context.Context) error {
+	limit := r.outbox.now().Add(-r.retention)
+
+	_, err := r.outbox.collection.DeleteMany(ctx, bson.M{"publishedAt": bson.M{"$lt": limit}})
+
+	return xmongo.ConvertMongoError(err, "outbox message", "published before %s", limit)
+}
+
+// lockNext finds the oldest pending message not locked by other relay, and locks it.
+// The messages of the blocked aggregates are skipped.
+func (r *Relay) lockNext(ctx context.Context, blocked []ids.Id) (Message, bool, error) {
+	filter := bson.M{
+		"publishedAt":    nil,
+		"deadLetteredAt": nil,
+	}
+	if len(blocked) > 0 {
+		filter["event.aggregate_id"] = bson.M{"$nin": blocked}
+	}
+
+	var message Message
+
+	found, err := r.lease.ClaimNext(ctx, filter, r.outbox.now(), r.lockDuration, &message)
+
+	return message, found, err
+}
+
+// waitsForEarlier checks if an earlier message of the aggregate is pending, i.e. locked by other relay. In that case
+// the message is released, without counting the attempt, to be published after the earlier one.
+func (r *Relay) waitsForEarlier(ctx context.Context, message Message) (bool, error) {
+	count, err := r.outbox.collection.CountDocuments(ctx, bson.M{
+		"event.aggregate_id": message.Event.AggregateID,
+		"event.version":      bson.M{"$lt": message.Event.Version},
+		"publishedAt":        nil,
+		"deadLetteredAt":     nil,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, xmongo.ConvertMongoError(err, "outbox message", "before %s", message.Id)
+	}
+
+	if count == 0 {
+		return false, nil
+	}
+
+	_, err = r.outbox.collection.UpdateByID(ctx, message.Id, bson.M{
+		"$unset": r.lease.Released(),
+		"$inc":   bson.M{xmongo.LeaseAttemptsField: -1},
+	})
+
+	return true, xmongo.ConvertMongoError(err, "outbox message", "%s", message.Id)
+}
+
+// publish publishes the message and marks it as published. Returns true if the message could not be published but
+// it was moved to the dead letter state, and the error if it must be retried.
+func (r *Relay) publish(ctx context.Context, message Message) (bool, error) {
+	event, err := message.Event.ToEvent()
+	if err != nil {
+		// The event cannot be rebuilt, i.e. its data is not registered, retrying it will not help
+		err = backoff.Permanent(err)
+	} else {
+		err = r.target.HandleEvent(ctx, event)
+	}
+
+	if err == nil {
+		unset := r.lease.Released()
+		unset["lastError"] = ""
+
+		_, err = r.outbox.collection.UpdateByID(ctx, message.Id, bson.M{
+			"$set":   bson.M{"publishedAt": r.outbox.now()},
+			"$unset": unset,
+		})
+
+		return false, xmongo.ConvertMongoError(err, "outbox message", "%s", message.Id)
+	}
+
+	var permanent *backoff.PermanentError
+	if errors.As(err, &permanent) || message.Attempts >= r.maxAttempts {
+		r.logger.Error("moving outbox message to dead letter", zap.String("id", message.Id.String()), zap.Int("attempts", message.Attempts), zap.Error(err))
+
+		_, updateErr := r.outbox.collection.UpdateByID(ctx, message.Id, bson.M{
+			"$set":   bson.M{"deadLetteredAt": r.outbox.now(), "lastError": err.Error()},
+			"$unset": r.lease.Released(),
+		})
+
+		return true, xmongo.ConvertMongoError(updateErr, "outbox message", "%s", message.Id)
+	}
+
+	r.logger.Warn("could not publish outbox message", zap.String("id", message.Id.String()), zap.Int("attempts", message.Attempts), zap.Error(err))
+
+	// The lock is released so the message is retried first, keeping the order of the events
+	_, updateErr := r.outbox.collection.UpdateByID(ctx, message.Id, bson.M{
+		"$set":   bson.M{"lastError": err.Error()},
+		"$unset": r.lease.Released(),
+	})
+	if updateErr != nil {
+		r.logger.Error("could not release outbox message", zap.String("id", message.Id.String()), zap.Error(updateErr))
+	}
+
+	return false, err
+}
@@ -0,0 +1,175 @@
+package xeh
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ProjectionStatus is the progress of a projector applying the events of an aggregate type
+type ProjectionStatus struct {
+	HandlerType     eh.EventHandlerType `json:"handlerType"`
+	AggregateType   eh.AggregateType    `json:"aggregateType"`
+	LastVersion     int                 `json:"lastVersion"`     // The version of the last applied event
+	LastEventAt     time.Time           `json:"lastEventAt"`     // The timestamp of the last applied event
+	LastAppliedAt   time.Time           `json:"lastAppliedAt"`   // When the last event was applied
+	LastDeliveryLag time.Duration       `json:"lastDeliveryLag"` // The delay from the last event timestamp until it was applied
+	InFlight        int                 `json:"inFlight"`        // The number of events being applied
+	Lag             time.Duration       `json:"lag"`             // How far behind the projector is, see ProjectionMonitor
+	Failures        int                 `json:"failures"`        // The number of events the projector failed to apply
+	Lagging         bool                `json:"lagging"`         // The lag exceeds the threshold
+}
+
+// ProjectionMonitor tracks how far behind each projector is, per aggregate type.
+//
+// The lag is the largest of the delivery lag of the last applied event, i.e. the delay from its timestamp until it
+// was applied, and the time since the timestamp of the oldest event the projector is applying. So a projector
+// working through a backlog keeps lagging until it applies recent events, and the lag grows while it is stuck.
+// Add the monitor Middleware to the projectors, and report the health in the SystemModule with
+// xhttpserver.NewHealthCheck("projections", monitor.CheckHealth).
+type ProjectionMonitor struct {
+	maxLag time.Duration
+	now    func() time.Time
+
+	projections map[projectionKey]*projection
+	lock        sync.RWMutex
+}
+
+type projectionKey struct {
+	handlerType   eh.EventHandlerType
+	aggregateType eh.AggregateType
+}
+
+type projection struct {
+	status   ProjectionStatus
+	inFlight []time.Time // The timestamps of the events being applied
+}
+
+// NewProjectionMonitor creates a new ProjectionMonitor reporting unhealthy the projectors with lag over maxLag
+func NewProjectionMonitor(maxLag time.Duration) *ProjectionMonitor {
+	return &ProjectionMonitor{
+		maxLag:      maxLag,
+		now:         time.Now,
+		projections: make(map[projectionKey]*projection),
+	}
+}
+
+// Middleware returns the middleware to track the events applied by the projectors
+func (m *ProjectionMonitor) Middleware() eh.EventHandlerMiddleware {
+	return func(handler eh.EventHandler) eh.EventHandler {
+		return &monitoredHandler{handler: handler, monitor: m}
+	}
+}
+
+// Statuses returns the status of all the projections, sorted by handler and aggregate type
+func (m *ProjectionMonitor) Statuses() []ProjectionStatus {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	now := m.now()
+	statuses := make([]ProjectionStatus, 0, len(m.projections))
+
+	for _, p := range m.projections {
+		status := p.status
+		status.InFlight = len(p.inFlight)
+		status.Lag = status.LastDeliveryLag
+
+		for _, eventAt := range p.inFlight {
+			if lag := now.Sub(eventAt); lag > status.Lag {
+				status.Lag = lag
+			}
+		}
+		status.Lagging = status.Lag > m.maxLag
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].HandlerType != statuses[j].HandlerType {
+			return statuses[i].HandlerType < statuses[j].HandlerType
+		}
+		return statuses[i].AggregateType < statuses[j].AggregateType
+	})
+
+	return statuses
+}
+
+// CheckHealth returns false if any projector is lagging, and the status of all the projections as details.
+// Use it with xhttpserver.NewHealthCheck.
+func (m *ProjectionMonitor) CheckHealth(context.Context) (bool, interface{}) {
+	statuses := m.Statuses()
+
+	healthy := true
+	for _, status := range statuses {
+		healthy = healthy && !status.Lagging
+	}
+
+	return healthy, statuses
+}
+
+func (m *ProjectionMonitor) started(handlerType eh.EventHandlerType, event eh.Event) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p := m.projection(handlerType, event.AggregateType())
+	p.inFlight = append(p.inFlight, event.Timestamp())
+}
+
+func (m *ProjectionMonitor) finished(handlerType eh.EventHandlerType, event eh.Event, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p := m.projection(handlerType, event.AggregateType())
+
+	for i, eventAt := range p.inFlight {
+		if eventAt.Equal(event.Timestamp()) {
+			p.inFlight = append(p.inFlight[:i], p.inFlight[i+1:]...)
+			break
+		}
+	}
+
+	if err != nil {
+		p.status.Failures++
+		return
+	}
+
+	p.status.LastVersion = event.Version()
+	p.status.LastEventAt = event.Timestamp()
+	p.status.LastAppliedAt = m.now()
+	p.status.LastDeliveryLag = p.status.LastAppliedAt.Sub(p.status.LastEventAt)
+}
+
+// projection returns the projection for the key, creating it if needed. Must be called with the lock held.
+func (m *ProjectionMonitor) projection(handlerType eh.EventHandlerType, aggregateType eh.AggregateType) *projection {
+	key := projectionKey{handlerType: handlerType, aggregateType: aggregateType}
+
+	p, found := m.projections[key]
+	if !found {
+		p = &projection{status: ProjectionStatus{HandlerType: handlerType, AggregateType: aggregateType}}
+		m.projections[key] = p
+	}
+
+	return p
+}
+
+type monitoredHandler struct {
+	handler eh.EventHandler
+	monitor *ProjectionMonitor
+}
+
+func (h *monitoredHandler) HandlerType() eh.EventHandlerType {
+	return h.handler.HandlerType()
+}
+
+func (h *monitoredHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.monitor.started(h.handler.HandlerType(), event)
+
+	err := h.handler.HandleEvent(ctx, event)
+
+	h.monitor.finished(h.handler.HandlerType(), event, err)
+
+	return err
+}
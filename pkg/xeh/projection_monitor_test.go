@@ -0,0 +1,101 @@
+package xeh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+)
+
+func newMonitoredEvent(version int, timestamp time.Time) eh.Event {
+	return eh.NewEvent("test-event", nil, timestamp, eh.ForAggregate(testAggType, ids.New(), version))
+}
+
+func TestProjectionMonitor_tracks_last_applied_event(t *testing.T) {
+	// GIVEN a monitored projector
+	now := time.Now()
+	monitor := NewProjectionMonitor(time.Minute)
+	monitor.now = func() time.Time { return now }
+
+	handler := monitor.Middleware()(&countingHandler{handlerType: "projector"})
+
+	// WHEN it applies an event created 10 seconds ago
+	eventAt := now.Add(-10 * time.Second)
+	require.NoError(t, handler.HandleEvent(context.Background(), newMonitoredEvent(3, eventAt)))
+
+	// THEN the last event is reported
+	statuses := monitor.Statuses()
+	require.Len(t, statuses, 1)
+	require.Equal(t, eh.EventHandlerType("projector"), statuses[0].HandlerType)
+	require.Equal(t, testAggType, statuses[0].AggregateType)
+	require.Equal(t, 3, statuses[0].LastVersion)
+	require.Equal(t, eventAt, statuses[0].LastEventAt)
+	require.Equal(t, now, statuses[0].LastAppliedAt)
+	require.Equal(t, 10*time.Second, statuses[0].LastDeliveryLag)
+
+	// AND its lag is the delivery lag of the last event, under the threshold
+	require.Equal(t, 10*time.Second, statuses[0].Lag)
+	healthy, _ := monitor.CheckHealth(context.Background())
+	require.True(t, healthy)
+}
+
+func TestProjectionMonitor_lags_until_it_applies_recent_events(t *testing.T) {
+	// GIVEN a monitored projector that applied an event two minutes after its creation
+	now := time.Now()
+	monitor := NewProjectionMonitor(time.Minute)
+	monitor.now = func() time.Time { return now }
+
+	handler := monitor.Middleware()(&countingHandler{handlerType: "projector"})
+	require.NoError(t, handler.HandleEvent(context.Background(), newMonitoredEvent(1, now.Add(-2*time.Minute))))
+
+	// WHEN the health is checked
+	healthy, details := monitor.CheckHealth(context.Background())
+
+	// THEN it is lagging, as it is working through a backlog
+	require.False(t, healthy)
+	require.True(t, details.([]ProjectionStatus)[0].Lagging)
+
+	// AND it recovers after applying a recent event
+	require.NoError(t, handler.HandleEvent(context.Background(), newMonitoredEvent(2, now.Add(-time.Second))))
+
+	healthy, details = monitor.CheckHealth(context.Background())
+	require.True(t, healthy)
+	require.Equal(t, time.Second, details.([]ProjectionStatus)[0].Lag)
+}
+
+func TestProjectionMonitor_detects_stuck_projectors(t *testing.T) {
+	// GIVEN a projector stuck applying an event
+	now := time.Now()
+	monitor := NewProjectionMonitor(time.Minute)
+	monitor.now = func() time.Time { return now }
+
+	statuses := make(chan []ProjectionStatus, 1)
+	health := make(chan bool, 1)
+	handler := monitor.Middleware()(eh.EventHandlerFunc(func(context.Context, eh.Event) error {
+		// WHEN the status is checked two minutes later
+		now = now.Add(2 * time.Minute)
+		statuses <- monitor.Statuses()
+		healthy, _ := monitor.CheckHealth(context.Background())
+		health <- healthy
+		return errors.New("failed")
+	}))
+
+	require.Error(t, handler.HandleEvent(context.Background(), newMonitoredEvent(1, now)))
+
+	// THEN it is lagging
+	stuck := <-statuses
+	require.Equal(t, 2*time.Minute, stuck[0].Lag)
+	require.Equal(t, 1, stuck[0].InFlight)
+	require.True(t, stuck[0].Lagging)
+	require.False(t, <-health)
+
+	// AND after it fails, the failure is counted and the lag cleared, as no event was applied
+	status := monitor.Statuses()[0]
+	require.Equal(t, 1, status.Failures)
+	require.Zero(t, status.Lag)
+	require.Zero(t, status.InFlight)
+}
@@ -0,0 +1,213 @@
+package pubsubbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/codec/json"
+	"go.uber.org/zap"
+)
+
+const (
+	busHandlerType     eh.EventHandlerType = "pubsub-bus"
+	errorsChannelSize                      = 100
+	defaultAckDeadline                     = 60 * time.Second
+)
+
+// EventBus is an eh.EventBus backed by Google Pub/Sub, as described in docs/EventBus.puml:
+//
+//   - HandleEvent publishes the event to the topic with the Publisher.
+//   - The SubscriptionAdapter receives the events from the subscription and sends them to the LocalBus.
+//   - The LocalBus delivers the events to the handlers added with AddHandler.
+//
+// All the instances of a service must share the same subscription, so each event is handled once by the service.
+// An event is redelivered to all the handlers when one of them fails, so handlers must be idempotent.
+type EventBus struct {
+	logger       *zap.Logger
+	client       *pubsub.Client
+	codec        eh.EventCodec
+	ackDeadline  time.Duration
+	publisher    *Publisher
+	local        *LocalBus
+	subscription *pubsub.Subscription
+	errors       chan error
+
+	startOnce sync.Once
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+var _ eh.EventBus = (*EventBus)(nil)
+
+// Option configures an EventBus
+type Option func(*EventBus)
+
+// WithCodec sets the codec used to encode the events in the messages. Default is the eventhorizon JSON codec.
+func WithCodec(codec eh.EventCodec) Option {
+	return func(b *EventBus) {
+		b.codec = codec
+	}
+}
+
+// WithAckDeadline sets the ack deadline used when the subscription is created. Default is 60 seconds.
+func WithAckDeadline(deadline time.Duration) Option {
+	return func(b *EventBus) {
+		b.ackDeadline = deadline
+	}
+}
+
+// NewEventBus creates a new EventBus publishing to the topic and receiving from the subscription.
+// The topic and the subscription are created if they do not exist. The subscription is created with message ordering.
+// Call Start after adding the handlers to begin receiving events.
+func NewEventBus(ctx context.Context, logger *zap.Logger, client *pubsub.Client, topicID, subscriptionID string, options ...Option) (*EventBus, error) {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(topicID, "topicID")
+	xerrors.EnsureNotEmpty(subscriptionID, "subscriptionID")
+
+	b := &EventBus{
+		logger:      logger.Named("pubsub bus"),
+		client:      client,
+		codec:       &json.EventCodec{},
+		ackDeadline: defaultAckDeadline,
+		local:       NewLocalBus(),
+		errors:      make(chan error, errorsChannelSize),
+		done:        make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(b)
+	}
+
+	topic, err := b.ensureTopic(ctx, topicID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.subscription, err = b.ensureSubscription(ctx, topic, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.publisher = NewPublisher(topic, b.codec)
+
+	return b, nil
+}
+
+func (b *EventBus) ensureTopic(ctx context.Context, topicID string) (*pubsub.Topic, error) {
+	topic := b.client.Topic(topicID)
+
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not check topic %s: %w", topicID, err)
+	}
+
+	if exists {
+		return topic, nil
+	}
+
+	b.logger.Info("creating topic", zap.String("topic", topicID))
+
+	if topic, err = b.client.CreateTopic(ctx, topicID); err != nil {
+		return nil, fmt.Errorf("could not create topic %s: %w", topicID, err)
+	}
+
+	return topic, nil
+}
+
+func (b *EventBus) ensureSubscription(ctx context.Context, topic *pubsub.Topic, subscriptionID string) (*pubsub.Subscription, error) {
+	subscription := b.client.Subscription(subscriptionID)
+
+	exists, err := subscription.Exists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not check subscription %s: %w", subscriptionID, err)
+	}
+
+	if exists {
+		return subscription, nil
+	}
+
+	b.logger.Info("creating subscription", zap.String("topic", topic.ID()), zap.String("subscription", subscriptionID))
+
+	subscription, err = b.client.CreateSubscription(ctx, subscriptionID, pubsub.SubscriptionConfig{
+		Topic:                 topic,
+		AckDeadline:           b.ackDeadline,
+		EnableMessageOrdering: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create subscription %s: %w", subscriptionID, err)
+	}
+
+	return subscription, nil
+}
+
+// Start begins receiving the events from the subscription in background, until the bus is closed.
+// Handlers added after starting the bus miss the events received before.
+func (b *EventBus) Start() {
+	b.startOnce.Do(func() {
+		var ctx context.Context
+		ctx, b.cancel = context.WithCancel(context.Background())
+
+		adapter := NewSubscriptionAdapter(b.subscription, b.codec, b.local, b.errors)
+
+		go func() {
+			defer close(b.done)
+
+			if err := adapter.Receive(ctx); err != nil {
+				b.logger.Error("stopped receiving events", zap.Error(err))
+				b.reportError(&eh.EventBusError{Err: err, Ctx: ctx})
+			}
+		}()
+	})
+}
+
+// HandlerType implements the HandlerType method of the eh.EventHandler interface.
+func (b *EventBus) HandlerType() eh.EventHandlerType {
+	return busHandlerType
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface.
+// The event is published to the topic, it is delivered to the handlers when received from the subscription.
+func (b *EventBus) HandleEvent(ctx context.Context, event eh.Event) error {
+	return b.publisher.Publish(ctx, event)
+}
+
+// AddHandler implements the AddHandler method of the eh.EventBus interface.
+func (b *EventBus) AddHandler(ctx context.Context, matcher eh.EventMatcher, handler eh.EventHandler) error {
+	return b.local.AddHandler(ctx, matcher, handler)
+}
+
+// Errors implements the Errors method of the eh.EventBus interface.
+func (b *EventBus) Errors() <-chan error {
+	return b.errors
+}
+
+// Close implements the Close method of the eh.EventBus interface.
+// It stops receiving events, waiting for the events being handled, and sends the pending events.
+func (b *EventBus) Close() error {
+	b.startOnce.Do(func() {
+		// Not started, there is nothing to wait for
+		close(b.done)
+	})
+
+	if b.cancel != nil {
+		b.cancel()
+	}
+	<-b.done
+
+	b.publisher.Stop()
+
+	return nil
+}
+
+func (b *EventBus) reportError(err error) {
+	select {
+	case b.errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,94 @@
+//go:build integration
+
+package pubsubbus
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/test/pubsubtest"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var emulator pubsubtest.LocalEmulator
+
+func TestMain(m *testing.M) {
+	emulator.Connect()
+	code := m.Run()
+	emulator.Disconnect()
+
+	os.Exit(code)
+}
+
+type receivedEvent struct {
+	event  eh.Event
+	tenant string
+}
+
+type recordingHandler struct {
+	lock     sync.Mutex
+	received []receivedEvent
+}
+
+func (h *recordingHandler) HandlerType() eh.EventHandlerType { return "recording" }
+
+func (h *recordingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	tenant, _ := xcontext.GetTenant(ctx)
+	h.received = append(h.received, receivedEvent{event: event, tenant: tenant})
+	return nil
+}
+
+func (h *recordingHandler) Received() []receivedEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return append([]receivedEvent(nil), h.received...)
+}
+
+func newTestBus(t *testing.T) *EventBus {
+	suffix := ids.New().String()
+
+	bus, err := NewEventBus(context.Background(), zap.NewNop(), emulator.Client(), "events-"+suffix, "service-"+suffix)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = bus.Close() })
+
+	return bus
+}
+
+func TestEventBus_delivers_published_events_in_order_with_tenant(t *testing.T) {
+	// GIVEN a started bus with a handler
+	bus := newTestBus(t)
+	handler := &recordingHandler{}
+	require.NoError(t, bus.AddHandler(context.Background(), eh.MatchEvents{"test-event"}, handler))
+	bus.Start()
+
+	// WHEN the events of an aggregate are published in a tenant
+	ctx := xcontext.WithTenant(context.Background(), "a-tenant")
+	aggregateId := ids.New()
+
+	for version := 1; version <= 5; version++ {
+		event := eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate("test-agg", aggregateId, version), xeh.WithTenant(ctx))
+		require.NoError(t, bus.HandleEvent(ctx, event))
+	}
+
+	// THEN the handler receives them in order, with the tenant in the context
+	require.Eventually(t, func() bool { return len(handler.Received()) >= 5 }, 10*time.Second, 50*time.Millisecond)
+
+	for i, received := range handler.Received() {
+		require.Equal(t, aggregateId, received.event.AggregateID())
+		require.Equal(t, i+1, received.event.Version())
+		require.Equal(t, "a-tenant", received.tenant)
+	}
+}
@@ -0,0 +1,78 @@
+package pubsubbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+const localBusHandlerType eh.EventHandlerType = "pubsub-local-bus"
+
+// LocalBus delivers the events to the handlers of this service, synchronously.
+// The event is sent to all the matching handlers even if some of them fail; the first error is returned.
+type LocalBus struct {
+	handlers     []matchedHandler
+	handlersLock sync.RWMutex
+}
+
+type matchedHandler struct {
+	matcher eh.EventMatcher
+	handler eh.EventHandler
+}
+
+var _ eh.EventHandler = (*LocalBus)(nil)
+
+// NewLocalBus creates a new LocalBus without handlers
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+// AddHandler adds a handler for the events matching the matcher. Only one handler of each type can be added.
+func (b *LocalBus) AddHandler(_ context.Context, matcher eh.EventMatcher, handler eh.EventHandler) error {
+	if matcher == nil {
+		return eh.ErrMissingMatcher
+	}
+	if handler == nil {
+		return eh.ErrMissingHandler
+	}
+
+	b.handlersLock.Lock()
+	defer b.handlersLock.Unlock()
+
+	for _, h := range b.handlers {
+		if h.handler.HandlerType() == handler.HandlerType() {
+			return eh.ErrHandlerAlreadyAdded
+		}
+	}
+
+	b.handlers = append(b.handlers, matchedHandler{matcher: matcher, handler: handler})
+
+	return nil
+}
+
+// HandlerType implements the HandlerType method of the eh.EventHandler interface.
+func (b *LocalBus) HandlerType() eh.EventHandlerType {
+	return localBusHandlerType
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface.
+func (b *LocalBus) HandleEvent(ctx context.Context, event eh.Event) error {
+	b.handlersLock.RLock()
+	defer b.handlersLock.RUnlock()
+
+	var firstErr error
+
+	for _, h := range b.handlers {
+		if !h.matcher.Match(event) {
+			continue
+		}
+
+		if err := h.handler.HandleEvent(ctx, event); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not handle event %s in %s: %w", event, h.handler.HandlerType(), err)
+		}
+	}
+
+	return firstErr
+}
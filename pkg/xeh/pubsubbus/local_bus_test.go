@@ -0,0 +1,60 @@
+package pubsubbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+)
+
+type handlerFake struct {
+	handlerType eh.EventHandlerType
+	err         error
+	received    []eh.Event
+}
+
+func (h *handlerFake) HandlerType() eh.EventHandlerType { return h.handlerType }
+
+func (h *handlerFake) HandleEvent(_ context.Context, event eh.Event) error {
+	h.received = append(h.received, event)
+	return h.err
+}
+
+func TestLocalBus_delivers_to_all_matching_handlers_even_if_one_fails(t *testing.T) {
+	// GIVEN a failing handler, a successful handler and a handler for other events
+	failing := &handlerFake{handlerType: "failing", err: errors.New("failed")}
+	successful := &handlerFake{handlerType: "successful"}
+	other := &handlerFake{handlerType: "other"}
+
+	bus := NewLocalBus()
+	require.NoError(t, bus.AddHandler(context.Background(), eh.MatchEvents{"test-event"}, failing))
+	require.NoError(t, bus.AddHandler(context.Background(), eh.MatchEvents{"test-event"}, successful))
+	require.NoError(t, bus.AddHandler(context.Background(), eh.MatchEvents{"other-event"}, other))
+
+	// WHEN an event is handled
+	err := bus.HandleEvent(context.Background(), eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate("test-agg", ids.New(), 1)))
+
+	// THEN the error is returned
+	require.ErrorIs(t, err, failing.err)
+
+	// AND all the matching handlers received the event
+	require.Len(t, failing.received, 1)
+	require.Len(t, successful.received, 1)
+	require.Empty(t, other.received)
+}
+
+func TestLocalBus_rejects_duplicated_handlers(t *testing.T) {
+	// GIVEN a bus with a handler
+	bus := NewLocalBus()
+	require.NoError(t, bus.AddHandler(context.Background(), eh.MatchEvents{"test-event"}, &handlerFake{handlerType: "handler"}))
+
+	// WHEN other handler of the same type is added
+	err := bus.AddHandler(context.Background(), eh.MatchEvents{"other-event"}, &handlerFake{handlerType: "handler"})
+
+	// THEN it is rejected
+	require.ErrorIs(t, err, eh.ErrHandlerAlreadyAdded)
+}
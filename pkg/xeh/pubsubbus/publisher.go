@@ -0,0 +1,69 @@
+package pubsubbus
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+)
+
+const (
+	eventTypeAttribute     = "eventType"
+	aggregateTypeAttribute = "aggregateType"
+	tenantAttribute        = "tenant"
+)
+
+// Publisher publishes the events to a Google Pub/Sub topic.
+// The events are published with the aggregate ID as ordering key, so the events of an aggregate are received in order.
+type Publisher struct {
+	topic *pubsub.Topic
+	codec eh.EventCodec
+}
+
+// NewPublisher creates a new Publisher to the topic, enabling the message ordering in it.
+func NewPublisher(topic *pubsub.Topic, codec eh.EventCodec) *Publisher {
+	xerrors.EnsureNotEmpty(topic, "topic")
+	xerrors.EnsureNotEmpty(codec, "codec")
+
+	topic.EnableMessageOrdering = true
+
+	return &Publisher{topic: topic, codec: codec}
+}
+
+// Publish sends the event to the topic and waits until the server accepts it.
+// The event tenant, added with xeh.WithTenant, is also sent as a message attribute to allow filtering subscriptions.
+func (p *Publisher) Publish(ctx context.Context, event eh.Event) error {
+	data, err := p.codec.MarshalEvent(ctx, event)
+	if err != nil {
+		return fmt.Errorf("could not encode event %s: %w", event, err)
+	}
+
+	orderingKey := event.AggregateID().String()
+
+	result := p.topic.Publish(ctx, &pubsub.Message{
+		Data:        data,
+		OrderingKey: orderingKey,
+		Attributes: map[string]string{
+			eventTypeAttribute:     event.EventType().String(),
+			aggregateTypeAttribute: event.AggregateType().String(),
+			tenantAttribute:        xeh.GetEventTenant(event),
+		},
+	})
+
+	if _, err := result.Get(ctx); err != nil {
+		// After a failure, the topic rejects the messages with the same ordering key until it is resumed
+		p.topic.ResumePublish(orderingKey)
+
+		return fmt.Errorf("could not publish event %s: %w", event, err)
+	}
+
+	return nil
+}
+
+// Stop sends the pending messages and stops the publishing goroutines
+func (p *Publisher) Stop() {
+	p.topic.Stop()
+}
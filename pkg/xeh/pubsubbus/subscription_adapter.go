@@ -0,0 +1,70 @@
+package pubsubbus
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// SubscriptionAdapter receives the events from a Google Pub/Sub subscription and sends them to the target handler.
+// The tenant, user and correlation ID of the event are set in the context given to the target.
+// Messages are acknowledged after the target handles the event. If it fails, the message is redelivered.
+type SubscriptionAdapter struct {
+	subscription *pubsub.Subscription
+	codec        eh.EventCodec
+	target       eh.EventHandler
+	errors       chan<- error
+}
+
+// NewSubscriptionAdapter creates a new SubscriptionAdapter sending the events to target.
+// The errors handling the messages are sent to the errors channel, if it is not full.
+func NewSubscriptionAdapter(subscription *pubsub.Subscription, codec eh.EventCodec, target eh.EventHandler, errors chan<- error) *SubscriptionAdapter {
+	xerrors.EnsureNotEmpty(subscription, "subscription")
+	xerrors.EnsureNotEmpty(codec, "codec")
+	xerrors.EnsureNotEmpty(target, "target")
+	xerrors.EnsureNotEmpty(errors, "errors")
+
+	return &SubscriptionAdapter{
+		subscription: subscription,
+		codec:        codec,
+		target:       target,
+		errors:       errors,
+	}
+}
+
+// Receive blocks receiving messages until the context is done or the subscription fails.
+func (a *SubscriptionAdapter) Receive(ctx context.Context) error {
+	return a.subscription.Receive(ctx, a.handleMessage)
+}
+
+func (a *SubscriptionAdapter) handleMessage(ctx context.Context, msg *pubsub.Message) {
+	event, ctx, err := a.codec.UnmarshalEvent(ctx, msg.Data)
+	if err != nil {
+		// Redelivering a message that cannot be decoded would block the following events of the aggregate forever
+		msg.Ack()
+		a.reportError(&eh.EventBusError{Err: fmt.Errorf("could not decode message %s: %w", msg.ID, err), Ctx: ctx})
+		return
+	}
+
+	ctx = xeh.ContextFromEvent(ctx, event)
+
+	if err := a.target.HandleEvent(ctx, event); err != nil {
+		msg.Nack()
+		a.reportError(&eh.EventBusError{Err: err, Ctx: ctx, Event: event})
+		return
+	}
+
+	msg.Ack()
+}
+
+func (a *SubscriptionAdapter) reportError(err error) {
+	select {
+	case a.errors <- err:
+	default:
+		// Nobody is reading the errors, they are dropped to not block the subscription
+	}
+}
@@ -0,0 +1,227 @@
+package xeh
+
+import (
+	"bytes"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operator compares a field of an entity with a value
+type Operator string
+
+const (
+	OpEq  Operator = "$eq"
+	OpNe  Operator = "$ne"
+	OpGt  Operator = "$gt"
+	OpGte Operator = "$gte"
+	OpLt  Operator = "$lt"
+	OpLte Operator = "$lte"
+	OpIn  Operator = "$in"
+)
+
+// Condition compares a field of the entity with a value.
+// Fields are named as in the entity bson tags, nested fields are separated by dots.
+type Condition struct {
+	Field    string
+	Operator Operator
+	Value    interface{}
+}
+
+// Filter selects the entities matching all its conditions. An empty filter matches all the entities.
+type Filter []Condition
+
+func Eq(field string, value interface{}) Condition  { return Condition{field, OpEq, value} }
+func Ne(field string, value interface{}) Condition  { return Condition{field, OpNe, value} }
+func Gt(field string, value interface{}) Condition  { return Condition{field, OpGt, value} }
+func Gte(field string, value interface{}) Condition { return Condition{field, OpGte, value} }
+func Lt(field string, value interface{}) Condition  { return Condition{field, OpLt, value} }
+func Lte(field string, value interface{}) Condition { return Condition{field, OpLte, value} }
+
+// In matches the entities with the field equal to any of the values
+func In(field string, values ...interface{}) Condition { return Condition{field, OpIn, values} }
+
+// Where returns a filter with the given conditions
+func Where(conditions ...Condition) Filter {
+	return conditions
+}
+
+// ToMongo translates the filter to a mongo query
+func (f Filter) ToMongo() bson.M {
+	query := bson.M{}
+
+	for _, condition := range f {
+		operators, found := query[condition.Field].(bson.M)
+		if !found {
+			operators = bson.M{}
+			query[condition.Field] = operators
+		}
+		operators[string(condition.Operator)] = condition.Value
+	}
+
+	return query
+}
+
+// matches returns true if the entity, encoded as a bson document, matches all the conditions
+func (f Filter) matches(document bson.M) bool {
+	for _, condition := range f {
+		if !condition.matches(fieldValue(document, condition.Field)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) matches(value interface{}) bool {
+	switch c.Operator {
+	case OpEq:
+		return compareValues(value, normalizeValue(c.Value)) == 0
+	case OpNe:
+		return compareValues(value, normalizeValue(c.Value)) != 0
+	case OpGt:
+		return compareValues(value, normalizeValue(c.Value)) > 0
+	case OpGte:
+		return compareValues(value, normalizeValue(c.Value)) >= 0
+	case OpLt:
+		return compareValues(value, normalizeValue(c.Value)) < 0
+	case OpLte:
+		return compareValues(value, normalizeValue(c.Value)) <= 0
+	case OpIn:
+		values, _ := c.Value.([]interface{})
+		for _, v := range values {
+			if compareValues(value, normalizeValue(v)) == 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// fieldValue returns the value of the field in the document, navigating the nested documents
+func fieldValue(document bson.M, field string) interface{} {
+	var value interface{} = document
+
+	for _, key := range strings.Split(field, ".") {
+		switch doc := value.(type) {
+		case bson.M:
+			value = doc[key]
+		case bson.D:
+			value = doc.Map()[key]
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+// normalizeValue encodes the value as bson, to compare it with the values of the encoded entities
+func normalizeValue(value interface{}) interface{} {
+	data, err := bson.Marshal(bson.M{"v": value})
+	if err != nil {
+		return value
+	}
+
+	var document bson.M
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return value
+	}
+
+	return document["v"]
+}
+
+// compareValues compares two bson values. Values of different kinds are ordered by kind, as mongo does.
+func compareValues(a, b interface{}) int {
+	if na, ok := toNumber(a); ok {
+		if nb, ok := toNumber(b); ok {
+			return compareOrdered(na, nb)
+		}
+	}
+
+	switch va := a.(type) {
+	case nil:
+		if b == nil {
+			return 0
+		}
+		return -1
+	case string:
+		if vb, ok := b.(string); ok {
+			return strings.Compare(va, vb)
+		}
+	case bool:
+		if vb, ok := b.(bool); ok {
+			return compareOrdered(boolToNumber(va), boolToNumber(vb))
+		}
+	case primitive.DateTime:
+		if vb, ok := b.(primitive.DateTime); ok {
+			return compareOrdered(int64(va), int64(vb))
+		}
+	case primitive.Binary:
+		if vb, ok := b.(primitive.Binary); ok {
+			return bytes.Compare(va.Data, vb.Data)
+		}
+	case primitive.ObjectID:
+		if vb, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(va[:], vb[:])
+		}
+	}
+
+	if b == nil {
+		return 1
+	}
+
+	return strings.Compare(bsonTypeName(a), bsonTypeName(b))
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func boolToNumber(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareOrdered[T int | int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func bsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case primitive.DateTime:
+		return "date"
+	case primitive.Binary:
+		return "binary"
+	case bson.M, bson.D:
+		return "document"
+	case bson.A:
+		return "array"
+	default:
+		return "other"
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/AltScore/gothic/v2/pkg/xerrors"
 
 	eh "github.com/looplab/eventhorizon"
-	localEventBus "github.com/looplab/eventhorizon/eventbus/local"
 	"github.com/looplab/eventhorizon/eventhandler/projector"
 	"github.com/looplab/eventhorizon/uuid"
 	"go.uber.org/zap"
@@ -35,18 +34,54 @@ func (r RegenerateReadModelsCmd) CommandType() eh.CommandType     { return Regen
 type ReadModelRegenerator struct {
 	logger     *zap.Logger
 	eventStore eh.EventStore
-	eventBus   eh.EventBus
+
+	handlersByType map[eh.AggregateType][]eh.EventHandler
 
 	readModelRepoByType map[eh.AggregateType]eh.ReadWriteRepo
+
+	aggregateLister AggregateLister
+
+	snapshotsByType map[eh.AggregateType]SnapshotStore
 }
 
+// RegeneratorOption configures a ReadModelRegenerator
+type RegeneratorOption func(*ReadModelRegenerator)
+
 // NewReadModelRegenerator creates a new ReadModelRegenerator that reads old events from the given event store
-func NewReadModelRegenerator(eventStore eh.EventStore, logger *zap.Logger) *ReadModelRegenerator {
-	return &ReadModelRegenerator{
+// If the event store implements AggregateLister, it is used to walk the aggregates in RegenerateAll.
+func NewReadModelRegenerator(eventStore eh.EventStore, logger *zap.Logger, options ...RegeneratorOption) *ReadModelRegenerator {
+	r := &ReadModelRegenerator{
 		logger:              logger,
 		eventStore:          eventStore,
-		eventBus:            localEventBus.NewEventBus(),
+		handlersByType:      make(map[eh.AggregateType][]eh.EventHandler),
 		readModelRepoByType: make(map[eh.AggregateType]eh.ReadWriteRepo),
+		snapshotsByType:     make(map[eh.AggregateType]SnapshotStore),
+	}
+
+	if lister, ok := eventStore.(AggregateLister); ok {
+		r.aggregateLister = lister
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	return r
+}
+
+// WithAggregateLister sets the AggregateLister used by RegenerateAll to walk all the aggregates of a type
+func WithAggregateLister(lister AggregateLister) RegeneratorOption {
+	return func(r *ReadModelRegenerator) {
+		r.aggregateLister = lister
+	}
+}
+
+// WithSnapshots configures the store with the read model snapshots of the aggregate type to use as starting point
+// to replay events.
+// Snapshots hold projected state, so they should be discarded when the projector changes.
+func WithSnapshots(aggType eh.AggregateType, snapshots SnapshotStore) RegeneratorOption {
+	return func(r *ReadModelRegenerator) {
+		r.snapshotsByType[aggType] = snapshots
 	}
 }
 
@@ -55,10 +90,11 @@ var _ eh.CommandHandler = (*ReadModelRegenerator)(nil)
 // Register registers a projector for a given aggregate type to allow the regeneration of its read models.
 // Multiple projectors of seam read model can be registered for the same aggregate type.
 // Also, multiple aggregate types can be registered.
-func (r *ReadModelRegenerator) Register(ctx context.Context, aggType eh.AggregateType, prj *projector.EventHandler, repo eh.ReadWriteRepo) error {
+func (r *ReadModelRegenerator) Register(_ context.Context, aggType eh.AggregateType, prj *projector.EventHandler, repo eh.ReadWriteRepo) error {
 	r.readModelRepoByType[aggType] = repo
+	r.handlersByType[aggType] = append(r.handlersByType[aggType], prj)
 
-	return r.eventBus.AddHandler(ctx, eh.MatchAggregates{aggType}, prj)
+	return nil
 }
 
 // Regenerate removes the read model and reapply all events to get a refreshed read model.
@@ -100,10 +136,16 @@ func (r *ReadModelRegenerator) removeReadModels(ctx context.Context, aggregateTy
 	return err
 }
 
-// replayEvents replays events for the given aggregate id from the first event
-// Events are not published outside the own event bus
+// replayEvents replays events for the given aggregate id from the latest snapshot, or the first event if there is none
+// Events are applied directly to the registered projectors, not through an event bus, so they are not published
+// and the projectors get the event data as loaded from the event store, i.e. upcasted by an UpcastingEventStore.
 func (r *ReadModelRegenerator) replayEvents(ctx context.Context, aggregateType eh.AggregateType, id uuid.UUID) error {
-	events, err := r.eventStore.Load(ctx, id)
+	fromVersion, err := restoreSnapshot(ctx, r.snapshotsByType[aggregateType], r.readModelRepoByType[aggregateType], aggregateType, id)
+	if err != nil {
+		return err
+	}
+
+	events, err := loadEventsAfter(ctx, r.eventStore, id, fromVersion)
 	if err != nil {
 		return err
 	}
@@ -117,8 +159,10 @@ func (r *ReadModelRegenerator) replayEvents(ctx context.Context, aggregateType e
 	}
 
 	for _, event := range events {
-		if err := r.eventBus.HandleEvent(ctx, event); err != nil {
-			return err
+		for _, handler := range r.handlersByType[aggregateType] {
+			if err := handler.HandleEvent(ctx, event); err != nil {
+				return err
+			}
 		}
 	}
 
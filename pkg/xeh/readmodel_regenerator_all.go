@@ -0,0 +1,194 @@
+package xeh
+
+import (
+	"context"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xsync"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRegenerationBatchSize   = 100
+	defaultRegenerationParallelism = 4
+)
+
+// AggregateLister lists the ids of the aggregates of a given type stored in the event store.
+// Ids should be returned in ascending order, starting after the given one (or from the first if it is empty),
+// and at most limit ids should be returned. An empty result indicates there are no more aggregates.
+type AggregateLister interface {
+	ListAggregateIDs(ctx context.Context, aggType eh.AggregateType, after uuid.UUID, limit int) ([]uuid.UUID, error)
+}
+
+// RegenerationProgress is the progress of a RegenerateAll execution.
+type RegenerationProgress struct {
+	AggregateType eh.AggregateType
+	Processed     int       // number of aggregates processed, including the failed ones
+	Failed        int       // number of aggregates that failed to regenerate
+	Checkpoint    uuid.UUID // last aggregate id completed, use it to resume the execution
+}
+
+// RegenerationFailure is the error found regenerating the read models of an aggregate
+type RegenerationFailure struct {
+	ID  uuid.UUID
+	Err error
+}
+
+// RegenerationResult is the result of a RegenerateAll execution
+type RegenerationResult struct {
+	RegenerationProgress
+	Failures []RegenerationFailure
+}
+
+type RegenerateAllOption func(*regenerateAllOptions)
+
+type regenerateAllOptions struct {
+	checkpoint  uuid.UUID
+	batchSize   int
+	parallelism int
+	onProgress  func(RegenerationProgress)
+}
+
+// FromCheckpoint resumes a previous execution, starting after the given aggregate id
+func FromCheckpoint(checkpoint uuid.UUID) RegenerateAllOption {
+	return func(o *regenerateAllOptions) {
+		o.checkpoint = checkpoint
+	}
+}
+
+// WithBatchSize configures how many aggregate ids are read from the event store at once.
+// The checkpoint is advanced after each batch is completed.
+func WithBatchSize(batchSize int) RegenerateAllOption {
+	return func(o *regenerateAllOptions) {
+		o.batchSize = batchSize
+	}
+}
+
+// WithParallelism configures the maximum number of aggregates regenerated in parallel.
+func WithParallelism(parallelism int) RegenerateAllOption {
+	return func(o *regenerateAllOptions) {
+		o.parallelism = parallelism
+	}
+}
+
+// WithProgress configures a function to be called after each batch is completed.
+func WithProgress(onProgress func(RegenerationProgress)) RegenerateAllOption {
+	return func(o *regenerateAllOptions) {
+		o.onProgress = onProgress
+	}
+}
+
+// RegenerateAll regenerates the read models of all the aggregates of the given type.
+// Aggregates are processed in batches, each one with bounded parallelism. A failure to regenerate an aggregate
+// does not stop the process, it is reported in the result.
+// If the context is canceled, the execution stops and the context error is returned, with a result that can be used
+// to resume it with FromCheckpoint. The checkpoint is not advanced past the aggregates interrupted by the
+// cancellation, so they are regenerated again when resumed.
+func (r *ReadModelRegenerator) RegenerateAll(ctx context.Context, aggType eh.AggregateType, options ...RegenerateAllOption) (RegenerationResult, error) {
+	opts := regenerateAllOptions{
+		checkpoint:  ids.Empty(),
+		batchSize:   defaultRegenerationBatchSize,
+		parallelism: defaultRegenerationParallelism,
+	}
+
+	for _, option := range options {
+		option(&opts)
+	}
+
+	result := RegenerationResult{
+		RegenerationProgress: RegenerationProgress{
+			AggregateType: aggType,
+			Checkpoint:    opts.checkpoint,
+		},
+	}
+
+	if r.aggregateLister == nil {
+		return result, xerrors.NewInvalidStateError("read model regenerator", "no aggregate lister configured to regenerate %s", aggType)
+	}
+
+	if _, found := r.readModelRepoByType[aggType]; !found {
+		return result, xerrors.NewNotFoundError("read mode repo", "not found for type %s", aggType)
+	}
+
+	r.logger.Info("Regenerating all read models", zap.String("agg_type", aggType.String()), zap.String("checkpoint", opts.checkpoint.String()))
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		batch, err := r.aggregateLister.ListAggregateIDs(ctx, aggType, result.Checkpoint, opts.batchSize)
+		if err != nil {
+			return result, err
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		if err := r.regenerateBatch(ctx, aggType, batch, opts.parallelism, &result); err != nil {
+			return result, err
+		}
+
+		if opts.onProgress != nil {
+			opts.onProgress(result.RegenerationProgress)
+		}
+	}
+
+	r.logger.Info(
+		"Regenerated all read models",
+		zap.String("agg_type", aggType.String()),
+		zap.Int("processed", result.Processed),
+		zap.Int("failed", result.Failed),
+	)
+
+	return result, nil
+}
+
+// regenerateBatch regenerates the read models of the given aggregates in parallel, and updates the result.
+func (r *ReadModelRegenerator) regenerateBatch(ctx context.Context, aggType eh.AggregateType, batch []uuid.UUID, parallelism int, result *RegenerationResult) error {
+	mapper := xsync.NewParallelMapper(func(id uuid.UUID) (struct{}, error) {
+		return struct{}{}, r.Regenerate(ctx, aggType, id)
+	}, xsync.WithMaxWorkers(parallelism))
+
+	if err := mapper.Map(batch); err != nil {
+		return err
+	}
+
+	errs := mapper.Errors()
+
+	if err := ctx.Err(); err != nil {
+		// The failures may be caused by the cancellation, so only the aggregates before the first one are completed
+		completed := 0
+		for completed < len(batch) && errs[completed] == nil {
+			completed++
+		}
+
+		if completed < len(batch) {
+			result.Processed += completed
+			if completed > 0 {
+				result.Checkpoint = batch[completed-1]
+			}
+			return err
+		}
+	}
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		r.logger.Warn("Failed to regenerate read models", zap.String("agg_type", aggType.String()), zap.String("agg_id", batch[i].String()), zap.Error(err))
+
+		result.Failed++
+		result.Failures = append(result.Failures, RegenerationFailure{ID: batch[i], Err: err})
+	}
+
+	result.Processed += len(batch)
+	result.Checkpoint = batch[len(batch)-1]
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package xeh
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const testAggType eh.AggregateType = "test-agg"
+
+type fakeAggregateLister struct {
+	ids []uuid.UUID
+}
+
+func (f *fakeAggregateLister) ListAggregateIDs(_ context.Context, _ eh.AggregateType, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	var found []uuid.UUID
+	for _, id := range f.ids {
+		if len(found) == limit {
+			break
+		}
+		if ids.IsEmpty(after) || ids.Compare(id, after) > 0 {
+			found = append(found, id)
+		}
+	}
+	return found, nil
+}
+
+type nopProjector struct{}
+
+func (nopProjector) ProjectorType() projector.Type { return "nop" }
+
+func (nopProjector) Project(_ context.Context, _ eh.Event, entity eh.Entity) (eh.Entity, error) {
+	return entity, nil
+}
+
+func newSortedIds(n int) []uuid.UUID {
+	aggIds := make([]uuid.UUID, n)
+	for i := range aggIds {
+		aggIds[i] = ids.New()
+	}
+	sort.Slice(aggIds, func(i, j int) bool { return ids.Compare(aggIds[i], aggIds[j]) < 0 })
+	return aggIds
+}
+
+func newTestRegenerator(t *testing.T, aggIds []uuid.UUID) (*ReadModelRegenerator, *ehmocks.EventStoreMock) {
+	eventStore := &ehmocks.EventStoreMock{}
+	repo := &ehmocks.ReadRepoMock{}
+	repo.On("Remove", mock.Anything, mock.Anything).Return(nil)
+
+	regenerator := NewReadModelRegenerator(eventStore, zap.NewNop(), WithAggregateLister(&fakeAggregateLister{ids: aggIds}))
+
+	require.NoError(t, regenerator.Register(context.Background(), testAggType, projector.NewEventHandler(nopProjector{}, repo), repo))
+
+	return regenerator, eventStore
+}
+
+func TestReadModelRegenerator_RegenerateAll_walks_all_aggregates(t *testing.T) {
+	// GIVEN an event store with 5 aggregates
+	aggIds := newSortedIds(5)
+	regenerator, eventStore := newTestRegenerator(t, aggIds)
+	eventStore.On("Load", mock.Anything, mock.Anything).Return(nil, nil)
+
+	// WHEN all read models are regenerated in batches of 2
+	var progress []RegenerationProgress
+	result, err := regenerator.RegenerateAll(context.Background(), testAggType, WithBatchSize(2), WithProgress(func(p RegenerationProgress) {
+		progress = append(progress, p)
+	}))
+
+	// THEN no error is returned
+	require.NoError(t, err)
+
+	// AND all aggregates were processed
+	require.Equal(t, 5, result.Processed)
+	require.Equal(t, 0, result.Failed)
+	require.Equal(t, aggIds[4], result.Checkpoint)
+	for _, id := range aggIds {
+		eventStore.AssertCalled(t, "Load", mock.Anything, id)
+	}
+
+	// AND the progress was reported after each batch
+	require.Len(t, progress, 3)
+	require.Equal(t, aggIds[1], progress[0].Checkpoint)
+	require.Equal(t, 4, progress[1].Processed)
+}
+
+func TestReadModelRegenerator_RegenerateAll_reports_failures(t *testing.T) {
+	// GIVEN an event store with 3 aggregates, where one cannot be loaded
+	aggIds := newSortedIds(3)
+	regenerator, eventStore := newTestRegenerator(t, aggIds)
+	loadErr := errors.New("cannot load")
+	eventStore.On("Load", mock.Anything, aggIds[1]).Return(nil, loadErr)
+	eventStore.On("Load", mock.Anything, mock.Anything).Return(nil, nil)
+
+	// WHEN all read models are regenerated
+	result, err := regenerator.RegenerateAll(context.Background(), testAggType)
+
+	// THEN the process is completed
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Processed)
+
+	// AND the failure is reported
+	require.Equal(t, 1, result.Failed)
+	require.Equal(t, []RegenerationFailure{{ID: aggIds[1], Err: loadErr}}, result.Failures)
+}
+
+func TestReadModelRegenerator_RegenerateAll_resumes_from_checkpoint(t *testing.T) {
+	// GIVEN an event store with 4 aggregates
+	aggIds := newSortedIds(4)
+	regenerator, eventStore := newTestRegenerator(t, aggIds)
+	eventStore.On("Load", mock.Anything, mock.Anything).Return(nil, nil)
+
+	// WHEN the regeneration is resumed after the second aggregate
+	result, err := regenerator.RegenerateAll(context.Background(), testAggType, FromCheckpoint(aggIds[1]), WithParallelism(1))
+
+	// THEN only the remaining aggregates are processed
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Processed)
+	eventStore.AssertNotCalled(t, "Load", mock.Anything, aggIds[0])
+	eventStore.AssertNotCalled(t, "Load", mock.Anything, aggIds[1])
+	eventStore.AssertCalled(t, "Load", mock.Anything, aggIds[3])
+}
+
+func TestReadModelRegenerator_RegenerateAll_does_not_skip_aggregates_when_canceled(t *testing.T) {
+	// GIVEN an event store with 3 aggregates, where the context is canceled loading the second one
+	aggIds := newSortedIds(3)
+	regenerator, eventStore := newTestRegenerator(t, aggIds)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventStore.On("Load", mock.Anything, aggIds[1]).Run(func(mock.Arguments) { cancel() }).Return(nil, context.Canceled)
+	eventStore.On("Load", mock.Anything, mock.Anything).Return(nil, nil)
+
+	// WHEN all read models are regenerated
+	result, err := regenerator.RegenerateAll(ctx, testAggType, WithParallelism(1))
+
+	// THEN the cancellation is returned
+	require.ErrorIs(t, err, context.Canceled)
+
+	// AND the checkpoint is not advanced past the interrupted aggregate
+	require.Equal(t, 1, result.Processed)
+	require.Equal(t, aggIds[0], result.Checkpoint)
+	require.Empty(t, result.Failures)
+}
+
+func TestReadModelRegenerator_RegenerateAll_fails_without_lister(t *testing.T) {
+	// GIVEN a regenerator without aggregate lister
+	regenerator := NewReadModelRegenerator(&ehmocks.EventStoreMock{}, zap.NewNop())
+
+	// WHEN all read models are regenerated
+	_, err := regenerator.RegenerateAll(context.Background(), testAggType)
+
+	// THEN an error is returned
+	require.Error(t, err)
+}
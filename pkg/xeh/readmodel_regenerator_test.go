@@ -0,0 +1,50 @@
+package xeh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+type recordingProjector struct {
+	data []eh.EventData
+}
+
+func (p *recordingProjector) ProjectorType() projector.Type { return "recording" }
+
+func (p *recordingProjector) Project(_ context.Context, event eh.Event, entity eh.Entity) (eh.Entity, error) {
+	p.data = append(p.data, event.Data())
+	return entity, nil
+}
+
+func TestReadModelRegenerator_Regenerate_projects_upcasted_events(t *testing.T) {
+	// GIVEN an upcasting event store with an event stored in v1
+	event := newRawBsonEvent(t, bson.M{"name": "John Doe"})
+
+	eventStore := &ehmocks.EventStoreMock{}
+	eventStore.On("Load", mock.Anything, event.AggregateID()).Return([]eh.Event{event}, nil)
+
+	repo := &ehmocks.ReadRepoMock{}
+	repo.On("Remove", mock.Anything, event.AggregateID()).Return(nil)
+	repo.On("Find", mock.Anything, event.AggregateID()).Return(&ehmocks.EntityFake{ID: event.AggregateID()}, nil)
+	repo.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	regenerator := NewReadModelRegenerator(NewUpcastingEventStore(eventStore, newClientUpcasterRegistry(t)), zap.NewNop())
+
+	prj := &recordingProjector{}
+	require.NoError(t, regenerator.Register(context.Background(), testAggType, projector.NewEventHandler(prj, repo), repo))
+
+	// WHEN the read model is regenerated
+	err := regenerator.Regenerate(context.Background(), testAggType, event.AggregateID())
+
+	// THEN the projector gets the upcasted event data
+	require.NoError(t, err)
+	require.Equal(t, []eh.EventData{&clientCreatedV3{FirstName: "John", LastName: "Doe", Country: "AR"}}, prj.data)
+}
@@ -0,0 +1,218 @@
+// Package saga runs process managers: event handlers that keep the state of a workflow across aggregates, and send
+// commands and schedule timeouts to move it forward.
+//
+// The state of each saga instance is kept in a StateStore keyed by its correlation id, instead of an eh.ReadWriteRepo:
+// the events of an instance come from many aggregates, so the store loads and saves the state with optimistic locking
+// on its own version, that a read repo does not provide. MongoStateStore keeps it in a mongo collection.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+)
+
+// Type is the type of saga, used to name its event handler and to route its timeouts
+type Type string
+
+func (t Type) String() string { return string(t) }
+
+// Saga coordinates a workflow across aggregates: it reacts to events, keeping the state of each saga instance,
+// and sends commands to move the workflow forward. Each instance is identified by a correlation id, usually the
+// one stored in the events with xeh.WithCorrelationId (see CorrelationIdFromEvent).
+//
+// The state S is persisted in a StateStore, keyed by the correlation id, so S must return it as its EntityID.
+type Saga[S eh.Entity] interface {
+	// SagaType returns the type of the saga
+	SagaType() Type
+	// CorrelationID returns the id of the saga instance the event belongs to, false if the saga ignores the event
+	CorrelationID(event eh.Event) (uuid.UUID, bool)
+	// NewState returns the state of a new saga instance with the given id
+	NewState(id uuid.UUID) S
+	// Handle reacts to the event, updating the state and using the actions to send commands and schedule timeouts.
+	// Timeouts are received as events of type TimeoutEventType, with TimeoutData.
+	Handle(ctx context.Context, event eh.Event, state S, actions *Actions) error
+}
+
+// Actions collects the commands and timeouts requested by a saga while handling an event.
+// They are executed only if the saga returns no error.
+type Actions struct {
+	commands  []eh.Command
+	schedule  map[string]time.Time
+	cancel    []string
+	completed bool
+}
+
+// Send sends the command to the command handler of the saga
+func (a *Actions) Send(cmd eh.Command) {
+	a.commands = append(a.commands, cmd)
+}
+
+// ScheduleTimeout schedules the timeout with the given name at the given time. It replaces a pending timeout
+// with the same name.
+func (a *Actions) ScheduleTimeout(name string, at time.Time) {
+	if a.schedule == nil {
+		a.schedule = make(map[string]time.Time)
+	}
+	a.schedule[name] = at
+}
+
+// CancelTimeout cancels the pending timeout with the given name, if any
+func (a *Actions) CancelTimeout(name string) {
+	delete(a.schedule, name)
+	a.cancel = append(a.cancel, name)
+}
+
+// Complete ends the saga instance: its state is removed and its pending timeouts are canceled.
+func (a *Actions) Complete() {
+	a.completed = true
+}
+
+// EventHandler runs a Saga as an eh.EventHandler. It loads the state of the saga instance from the store, handles the
+// event, sends the commands, saves the state and then schedules the timeouts.
+//
+// The state is saved only if no other event updated it since it was loaded, otherwise the handler fails with a
+// retriable xerrors.ErrWriteConflict, to handle the event again with the new state. The commands are sent before
+// saving the state, so they are sent at least once: when the event is handled again after a failure, they may be
+// sent again, and their handlers must be idempotent. The timeouts are updated after saving the state, so they are
+// not changed by an attempt that failed with a conflict.
+//
+// Add it to the event bus through an eventerrors.EventHandlerErrorRecorder to record the failures of the saga, and
+// give the TimeoutDispatcher the handler returned by the recorder Wrap method to record the failures of timeouts too.
+type EventHandler[S eh.Entity] struct {
+	saga           Saga[S]
+	states         StateStore[S]
+	commandHandler eh.CommandHandler
+	timeouts       TimeoutStore
+}
+
+var _ eh.EventHandler = (*EventHandler[eh.Entity])(nil)
+
+// NewEventHandler creates a new EventHandler for the saga, keeping its state in the states store and sending the
+// commands to commandHandler. The timeouts are stored in the timeouts store.
+func NewEventHandler[S eh.Entity](saga Saga[S], states StateStore[S], commandHandler eh.CommandHandler, timeouts TimeoutStore) *EventHandler[S] {
+	xerrors.EnsureNotEmpty(saga, "saga")
+	xerrors.EnsureNotEmpty(states, "states")
+	xerrors.EnsureNotEmpty(commandHandler, "commandHandler")
+	xerrors.EnsureNotEmpty(timeouts, "timeouts")
+
+	return &EventHandler[S]{
+		saga:           saga,
+		states:         states,
+		commandHandler: commandHandler,
+		timeouts:       timeouts,
+	}
+}
+
+// HandlerType implements the HandlerType method of the eh.EventHandler interface.
+func (h *EventHandler[S]) HandlerType() eh.EventHandlerType {
+	return eh.EventHandlerType("saga_" + h.saga.SagaType().String())
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface.
+func (h *EventHandler[S]) HandleEvent(ctx context.Context, event eh.Event) error {
+	id, found := h.correlationID(event)
+	if !found {
+		return nil
+	}
+
+	ctx = xeh.ContextFromEvent(ctx, event)
+
+	state, version, found, err := h.states.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		state = h.saga.NewState(id)
+	}
+
+	actions := &Actions{}
+
+	if err := h.saga.Handle(ctx, event, state, actions); err != nil {
+		return fmt.Errorf("saga %s failed to handle %s: %w", h.saga.SagaType(), event, err)
+	}
+
+	for _, cmd := range actions.commands {
+		if err := h.commandHandler.HandleCommand(ctx, cmd); err != nil {
+			return fmt.Errorf("saga %s failed to send %s: %w", h.saga.SagaType(), cmd.CommandType(), err)
+		}
+	}
+
+	if actions.completed {
+		return h.complete(ctx, id, version)
+	}
+
+	if err := h.states.Save(ctx, state, version); err != nil {
+		return err
+	}
+
+	return h.updateTimeouts(ctx, id, actions)
+}
+
+func (h *EventHandler[S]) correlationID(event eh.Event) (uuid.UUID, bool) {
+	if event.EventType() != TimeoutEventType {
+		return h.saga.CorrelationID(event)
+	}
+
+	data, ok := event.Data().(*TimeoutData)
+	if !ok || data.SagaType != h.saga.SagaType() {
+		return ids.Empty(), false
+	}
+
+	return data.CorrelationID, true
+}
+
+func (h *EventHandler[S]) updateTimeouts(ctx context.Context, id uuid.UUID, actions *Actions) error {
+	for _, name := range actions.cancel {
+		if err := h.timeouts.Cancel(ctx, h.saga.SagaType(), id, name); err != nil {
+			return err
+		}
+	}
+
+	for name, at := range actions.schedule {
+		timeout := Timeout{
+			SagaType:      h.saga.SagaType(),
+			CorrelationID: id,
+			Name:          name,
+			DueAt:         at,
+			Tenant:        xcontext.GetTenantOrDefault(ctx),
+		}
+
+		if err := h.timeouts.Schedule(ctx, timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *EventHandler[S]) complete(ctx context.Context, id uuid.UUID, version int) error {
+	if err := h.states.Remove(ctx, id, version); err != nil {
+		return err
+	}
+
+	return h.timeouts.CancelAll(ctx, h.saga.SagaType(), id)
+}
+
+// CorrelationIdFromEvent returns the correlation id stored in the event metadata, if it is a valid id.
+// Sagas can use it to implement CorrelationID.
+func CorrelationIdFromEvent(event eh.Event) (uuid.UUID, bool) {
+	correlationId, found := xeh.GetEventCorrelationId(event)
+	if !found {
+		return ids.Empty(), false
+	}
+
+	id, err := ids.Parse(correlationId)
+	if err != nil || ids.IsEmpty(id) {
+		return ids.Empty(), false
+	}
+
+	return id, true
+}
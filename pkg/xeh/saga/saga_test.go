@@ -0,0 +1,305 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	disbursedEvent    eh.EventType = "disbursed"
+	ledgerPostedEvent eh.EventType = "ledger-posted"
+	ledgerTimeout                  = "ledger"
+)
+
+type testCommand struct {
+	ID   uuid.UUID
+	Name string
+}
+
+func (c *testCommand) AggregateID() uuid.UUID          { return c.ID }
+func (c *testCommand) AggregateType() eh.AggregateType { return "test" }
+func (c *testCommand) CommandType() eh.CommandType     { return eh.CommandType(c.Name) }
+
+type disbursementState struct {
+	ID   uuid.UUID
+	Step string
+}
+
+func (s *disbursementState) EntityID() uuid.UUID { return s.ID }
+
+type disbursementSaga struct {
+	now time.Time
+}
+
+func (s disbursementSaga) SagaType() Type { return "disbursement" }
+
+func (s disbursementSaga) CorrelationID(event eh.Event) (uuid.UUID, bool) {
+	return CorrelationIdFromEvent(event)
+}
+
+func (s disbursementSaga) NewState(id uuid.UUID) *disbursementState {
+	return &disbursementState{ID: id}
+}
+
+func (s disbursementSaga) Handle(_ context.Context, event eh.Event, state *disbursementState, actions *Actions) error {
+	switch event.EventType() {
+	case disbursedEvent:
+		state.Step = "posting"
+		actions.Send(&testCommand{ID: state.ID, Name: "post-ledger"})
+		actions.ScheduleTimeout(ledgerTimeout, s.now.Add(time.Minute))
+	case ledgerPostedEvent:
+		actions.Send(&testCommand{ID: state.ID, Name: "notify"})
+		actions.Complete()
+	case TimeoutEventType:
+		state.Step = "reverting"
+		actions.Send(&testCommand{ID: state.ID, Name: "revert"})
+	}
+	return nil
+}
+
+type sagaFixture struct {
+	saga     disbursementSaga
+	states   *InMemoryStateStore[*disbursementState]
+	commands *ehmocks.CommandHandlerMock
+	timeouts *InMemoryTimeoutStore
+	handler  *EventHandler[*disbursementState]
+}
+
+func newSagaFixture() *sagaFixture {
+	f := &sagaFixture{
+		saga:     disbursementSaga{now: time.Now()},
+		states:   NewInMemoryStateStore[*disbursementState](),
+		commands: &ehmocks.CommandHandlerMock{},
+		timeouts: NewInMemoryTimeoutStore(),
+	}
+	f.handler = NewEventHandler[*disbursementState](f.saga, f.states, f.commands, f.timeouts)
+	return f
+}
+
+func newCorrelatedEvent(eventType eh.EventType, correlationID uuid.UUID) eh.Event {
+	ctx := xcontext.WithCorrelationId(xcontext.WithTenant(context.Background(), "a-tenant"), correlationID.String())
+	return eh.NewEvent(eventType, nil, time.Now(), eh.ForAggregate("loan", uuid.New(), 1), xeh.WithContext(ctx))
+}
+
+func isCommand(name string) interface{} {
+	return mock.MatchedBy(func(cmd eh.Command) bool { return cmd.CommandType() == eh.CommandType(name) })
+}
+
+func TestEventHandler_sends_commands_and_persists_state(t *testing.T) {
+	// GIVEN a saga
+	f := newSagaFixture()
+	f.commands.On("HandleCommand", mock.Anything, isCommand("post-ledger")).Return(nil)
+	id := uuid.New()
+
+	// WHEN the starting event is handled
+	err := f.handler.HandleEvent(context.Background(), newCorrelatedEvent(disbursedEvent, id))
+
+	// THEN the command is sent
+	require.NoError(t, err)
+	f.commands.AssertExpectations(t)
+
+	// AND the state is saved with the correlation id
+	state, version, found, err := f.states.Load(context.Background(), id)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 1, version)
+	require.Equal(t, "posting", state.Step)
+
+	// AND the timeout is scheduled for the tenant of the event
+	pending := f.timeouts.Pending()
+	require.Len(t, pending, 1)
+	require.Equal(t, ledgerTimeout, pending[0].Name)
+	require.Equal(t, id, pending[0].CorrelationID)
+	require.Equal(t, "a-tenant", pending[0].Tenant)
+}
+
+func TestEventHandler_completes_saga(t *testing.T) {
+	// GIVEN a started saga
+	f := newSagaFixture()
+	f.commands.On("HandleCommand", mock.Anything, mock.Anything).Return(nil)
+	id := uuid.New()
+	require.NoError(t, f.handler.HandleEvent(context.Background(), newCorrelatedEvent(disbursedEvent, id)))
+
+	// WHEN the final event is handled
+	err := f.handler.HandleEvent(context.Background(), newCorrelatedEvent(ledgerPostedEvent, id))
+
+	// THEN the state and the timeouts are removed
+	require.NoError(t, err)
+	_, _, found, err := f.states.Load(context.Background(), id)
+	require.NoError(t, err)
+	require.False(t, found)
+	require.Empty(t, f.timeouts.Pending())
+
+	// AND the final command is sent
+	f.commands.AssertCalled(t, "HandleCommand", mock.Anything, isCommand("notify"))
+}
+
+func TestEventHandler_ignores_events_without_correlation(t *testing.T) {
+	// GIVEN a saga
+	f := newSagaFixture()
+
+	// WHEN an event without correlation id is handled
+	err := f.handler.HandleEvent(context.Background(), eh.NewEvent(disbursedEvent, nil, time.Now()))
+
+	// THEN nothing is done
+	require.NoError(t, err)
+	f.commands.AssertNotCalled(t, "HandleCommand", mock.Anything, mock.Anything)
+}
+
+func TestEventHandler_returns_command_failures_without_saving_state(t *testing.T) {
+	// GIVEN a saga whose command fails
+	f := newSagaFixture()
+	f.commands.On("HandleCommand", mock.Anything, mock.Anything).Return(errors.New("ledger unavailable"))
+	id := uuid.New()
+
+	// WHEN the event is handled
+	err := f.handler.HandleEvent(context.Background(), newCorrelatedEvent(disbursedEvent, id))
+
+	// THEN the error is returned, to be recorded
+	require.ErrorContains(t, err, "ledger unavailable")
+
+	// AND the state is not saved
+	_, _, found, err := f.states.Load(context.Background(), id)
+	require.NoError(t, err)
+	require.False(t, found)
+	require.Empty(t, f.timeouts.Pending())
+}
+
+// concurrentStateStore simulates other event updating the state after it is loaded
+type concurrentStateStore struct {
+	*InMemoryStateStore[*disbursementState]
+	other *disbursementState
+}
+
+func (s *concurrentStateStore) Load(ctx context.Context, id uuid.UUID) (*disbursementState, int, bool, error) {
+	state, version, found, err := s.InMemoryStateStore.Load(ctx, id)
+
+	if s.other != nil {
+		_ = s.InMemoryStateStore.Save(ctx, s.other, version)
+		s.other = nil
+	}
+
+	return state, version, found, err
+}
+
+func TestEventHandler_fails_with_retriable_conflict_when_state_changed_concurrently(t *testing.T) {
+	// GIVEN a saga whose state is updated by other event while handling one
+	f := newSagaFixture()
+	f.commands.On("HandleCommand", mock.Anything, mock.Anything).Return(nil)
+	id := uuid.New()
+
+	states := &concurrentStateStore{InMemoryStateStore: f.states, other: &disbursementState{ID: id, Step: "other"}}
+	handler := NewEventHandler[*disbursementState](f.saga, states, f.commands, f.timeouts)
+
+	// WHEN the event is handled
+	err := handler.HandleEvent(context.Background(), newCorrelatedEvent(disbursedEvent, id))
+
+	// THEN a retriable conflict is returned
+	require.ErrorIs(t, err, xerrors.ErrWriteConflict)
+	require.True(t, xerrors.IsRetriable(err))
+
+	// AND the update of the other event is kept, without scheduling the timeouts
+	state, version, _, err := f.states.Load(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+	require.Equal(t, "other", state.Step)
+	require.Empty(t, f.timeouts.Pending())
+
+	// WHEN it is handled again
+	err = handler.HandleEvent(context.Background(), newCorrelatedEvent(disbursedEvent, id))
+
+	// THEN it is applied over the new state
+	require.NoError(t, err)
+	_, version, _, err = f.states.Load(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+}
+
+func TestTimeoutDispatcher_delivers_due_timeouts_to_saga(t *testing.T) {
+	// GIVEN a started saga with a scheduled timeout
+	f := newSagaFixture()
+	f.commands.On("HandleCommand", mock.Anything, mock.Anything).Return(nil)
+	id := uuid.New()
+	require.NoError(t, f.handler.HandleEvent(context.Background(), newCorrelatedEvent(disbursedEvent, id)))
+
+	dispatcher := NewTimeoutDispatcher(zap.NewNop(), f.timeouts)
+	dispatcher.AddHandler(f.saga.SagaType(), f.handler)
+
+	// WHEN the timeouts are dispatched before the due time
+	delivered, err := dispatcher.DispatchDue(context.Background())
+
+	// THEN nothing is delivered
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+
+	// WHEN the timeouts are dispatched after the due time
+	dispatcher.now = func() time.Time { return f.saga.now.Add(2 * time.Minute) }
+	delivered, err = dispatcher.DispatchDue(context.Background())
+
+	// THEN the timeout is delivered to the saga
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	f.commands.AssertCalled(t, "HandleCommand", mock.Anything, isCommand("revert"))
+
+	state, _, _, err := f.states.Load(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, "reverting", state.Step)
+
+	// AND the timeout is removed
+	require.Empty(t, f.timeouts.Pending())
+}
+
+func TestInMemoryTimeoutStore_keeps_timeout_scheduled_again_while_delivered(t *testing.T) {
+	// GIVEN a claimed timeout
+	store := NewInMemoryTimeoutStore()
+	now := time.Now()
+	timeout := Timeout{SagaType: "test", CorrelationID: uuid.New(), Name: "a-timeout", DueAt: now}
+	require.NoError(t, store.Schedule(context.Background(), timeout))
+
+	claimed, found, err := store.ClaimDue(context.Background(), now, time.Minute)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// WHEN it is scheduled again before it is done
+	timeout.DueAt = now.Add(time.Hour)
+	require.NoError(t, store.Schedule(context.Background(), timeout))
+	require.NoError(t, store.Done(context.Background(), claimed))
+
+	// THEN the new timeout is kept
+	pending := store.Pending()
+	require.Len(t, pending, 1)
+	require.Equal(t, timeout.DueAt, pending[0].DueAt)
+}
+
+func TestInMemoryStateStore_keeps_a_copy_of_the_state(t *testing.T) {
+	// GIVEN a saved state
+	ctx := context.Background()
+	store := NewInMemoryStateStore[*disbursementState]()
+	id := uuid.New()
+	state := &disbursementState{ID: id, Step: "posting"}
+	require.NoError(t, store.Save(ctx, state, 0))
+
+	// WHEN the saved and the loaded states are modified
+	state.Step = "saved"
+
+	loaded, _, _, err := store.Load(ctx, id)
+	require.NoError(t, err)
+	loaded.Step = "loaded"
+
+	// THEN the stored state is not modified
+	loaded, _, _, err = store.Load(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, &disbursementState{ID: id, Step: "posting"}, loaded)
+}
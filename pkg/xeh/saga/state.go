@@ -0,0 +1,105 @@
+package saga
+
+import (
+	"context"
+	"sync"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StateStore keeps the state of the saga instances, with optimistic locking on its version: the events of a saga
+// instance come from many aggregates without order, so they can be handled at the same time.
+type StateStore[S eh.Entity] interface {
+	// Load returns the state of the saga instance and its version, false if it does not exist
+	Load(ctx context.Context, id uuid.UUID) (S, int, bool, error)
+	// Save stores the state if the stored version is the given one, 0 for a new instance, incrementing it.
+	// Fails with xerrors.ErrWriteConflict if it was updated by other event.
+	Save(ctx context.Context, state S, version int) error
+	// Remove removes the state if the stored version is the given one.
+	// Fails with xerrors.ErrWriteConflict if it was updated by other event.
+	Remove(ctx context.Context, id uuid.UUID, version int) error
+}
+
+// InMemoryStateStore is a StateStore that keeps the states in memory, useful for tests.
+// The states are stored encoded as in MongoStateStore, so the loaded states are copies.
+type InMemoryStateStore[S eh.Entity] struct {
+	states map[uuid.UUID]bson.Raw
+	lock   sync.Mutex
+}
+
+var _ StateStore[eh.Entity] = (*InMemoryStateStore[eh.Entity])(nil)
+
+// NewInMemoryStateStore creates a new empty InMemoryStateStore
+func NewInMemoryStateStore[S eh.Entity]() *InMemoryStateStore[S] {
+	return &InMemoryStateStore[S]{states: make(map[uuid.UUID]bson.Raw)}
+}
+
+// Load implements the Load method of the StateStore interface.
+func (s *InMemoryStateStore[S]) Load(_ context.Context, id uuid.UUID) (S, int, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored, err := s.load(id)
+
+	return stored.State, stored.Version, stored.Version > 0, err
+}
+
+// Save implements the Save method of the StateStore interface.
+func (s *InMemoryStateStore[S]) Save(_ context.Context, state S, version int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := state.EntityID()
+
+	stored, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if stored.Version != version {
+		return xerrors.NewWriteConflictError("saga state", "%s version %d", id, version)
+	}
+
+	raw, err := bson.Marshal(stateDocument[S]{Id: id, Version: version + 1, State: state})
+	if err != nil {
+		return err
+	}
+
+	s.states[id] = raw
+
+	return nil
+}
+
+// Remove implements the Remove method of the StateStore interface.
+func (s *InMemoryStateStore[S]) Remove(_ context.Context, id uuid.UUID, version int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if stored.Version != version {
+		return xerrors.NewWriteConflictError("saga state", "%s version %d", id, version)
+	}
+
+	delete(s.states, id)
+
+	return nil
+}
+
+// load decodes the stored state, with version 0 if it does not exist. Must be called with the lock held.
+func (s *InMemoryStateStore[S]) load(id uuid.UUID) (stateDocument[S], error) {
+	var document stateDocument[S]
+
+	raw, found := s.states[id]
+	if !found {
+		return document, nil
+	}
+
+	err := bson.Unmarshal(raw, &document)
+
+	return document, err
+}
@@ -0,0 +1,107 @@
+package saga
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStateStore is a StateStore that keeps the states of a saga in a mongo collection
+type MongoStateStore[S eh.Entity] struct {
+	collection *mongo.Collection
+}
+
+type stateDocument[S eh.Entity] struct {
+	Id      uuid.UUID `bson:"_id"`
+	Version int       `bson:"version"`
+	State   S         `bson:"state"`
+}
+
+var _ StateStore[eh.Entity] = (*MongoStateStore[eh.Entity])(nil)
+
+// NewMongoStateStore creates a new MongoStateStore using the given database and collection
+func NewMongoStateStore[S eh.Entity](client *mongo.Client, databaseName, collectionName string) *MongoStateStore[S] {
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+
+	return &MongoStateStore[S]{
+		collection: client.Database(databaseName).Collection(collectionName),
+	}
+}
+
+// Load implements the Load method of the StateStore interface.
+func (s *MongoStateStore[S]) Load(ctx context.Context, id uuid.UUID) (S, int, bool, error) {
+	var document stateDocument[S]
+
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return document.State, 0, false, nil
+	}
+	if err != nil {
+		return document.State, 0, false, xmongo.ConvertMongoError(err, "saga state", "%s", id)
+	}
+
+	return document.State, document.Version, true, nil
+}
+
+// Save implements the Save method of the StateStore interface.
+func (s *MongoStateStore[S]) Save(ctx context.Context, state S, version int) error {
+	id := state.EntityID()
+
+	if version == 0 {
+		_, err := s.collection.InsertOne(ctx, stateDocument[S]{Id: id, Version: 1, State: state})
+
+		err = xmongo.ConvertMongoError(err, "saga state", "%s", id)
+		if errors.Is(err, xerrors.ErrDuplicate) {
+			return xerrors.NewWriteConflictError("saga state", "%s version %d", id, version)
+		}
+		return err
+	}
+
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "version": version},
+		bson.M{"$set": bson.M{"state": state, "version": version + 1}},
+	)
+	if err != nil {
+		return xmongo.ConvertMongoError(err, "saga state", "%s", id)
+	}
+
+	if result.MatchedCount == 0 {
+		return xerrors.NewWriteConflictError("saga state", "%s version %d", id, version)
+	}
+
+	return nil
+}
+
+// Remove implements the Remove method of the StateStore interface.
+func (s *MongoStateStore[S]) Remove(ctx context.Context, id uuid.UUID, version int) error {
+	if version == 0 {
+		// Never stored, unless other event created it in the meantime
+		count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return xmongo.ConvertMongoError(err, "saga state", "%s", id)
+		}
+		if count > 0 {
+			return xerrors.NewWriteConflictError("saga state", "%s version %d", id, version)
+		}
+		return nil
+	}
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "version": version})
+	if err != nil {
+		return xmongo.ConvertMongoError(err, "saga state", "%s", id)
+	}
+
+	if result.DeletedCount == 0 {
+		return xerrors.NewWriteConflictError("saga state", "%s version %d", id, version)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build integration
+
+package saga
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMongoStateStore(t *testing.T) *MongoStateStore[*disbursementState] {
+	store := NewMongoStateStore[*disbursementState](mongoInMemory.Client(), "test", "saga-states-"+ids.New().String())
+
+	t.Cleanup(func() { _ = store.collection.Drop(context.Background()) })
+
+	return store
+}
+
+func TestMongoStateStore_saves_states_with_optimistic_locking(t *testing.T) {
+	// GIVEN a saved state
+	ctx := context.Background()
+	store := newTestMongoStateStore(t)
+	id := uuid.New()
+	require.NoError(t, store.Save(ctx, &disbursementState{ID: id, Step: "posting"}, 0))
+
+	// WHEN it is saved again from the same version twice
+	first := store.Save(ctx, &disbursementState{ID: id, Step: "reverting"}, 1)
+	second := store.Save(ctx, &disbursementState{ID: id, Step: "other"}, 1)
+
+	// THEN only the first update is stored
+	require.NoError(t, first)
+	require.ErrorIs(t, second, xerrors.ErrWriteConflict)
+
+	state, version, found, err := store.Load(ctx, id)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 2, version)
+	require.Equal(t, "reverting", state.Step)
+
+	// AND a new instance cannot be created twice
+	require.ErrorIs(t, store.Save(ctx, &disbursementState{ID: id}, 0), xerrors.ErrWriteConflict)
+}
+
+func TestMongoStateStore_removes_states_in_the_loaded_version(t *testing.T) {
+	// GIVEN a saved state
+	ctx := context.Background()
+	store := newTestMongoStateStore(t)
+	id := uuid.New()
+	require.NoError(t, store.Save(ctx, &disbursementState{ID: id}, 0))
+
+	// WHEN it is removed from an old version
+	err := store.Remove(ctx, id, 0)
+
+	// THEN it fails
+	require.ErrorIs(t, err, xerrors.ErrWriteConflict)
+
+	// WHEN it is removed from the stored version
+	require.NoError(t, store.Remove(ctx, id, 1))
+
+	// THEN it does not exist anymore
+	_, _, found, err := store.Load(ctx, id)
+	require.NoError(t, err)
+	require.False(t, found)
+}
@@ -0,0 +1,179 @@
+package saga
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+)
+
+const (
+	// TimeoutEventType is the type of the events delivered to the sagas when a timeout is due
+	TimeoutEventType eh.EventType = "saga:timeout"
+	// TimeoutAggregateType is the aggregate type of the timeout events
+	TimeoutAggregateType eh.AggregateType = "saga:timeout"
+)
+
+func init() {
+	eh.RegisterEventData(TimeoutEventType, func() eh.EventData { return &TimeoutData{} })
+}
+
+// TimeoutData is the data of the timeout events
+type TimeoutData struct {
+	SagaType      Type      `json:"sagaType" bson:"sagaType"`
+	CorrelationID uuid.UUID `json:"correlationId" bson:"correlationId"`
+	Name          string    `json:"name" bson:"name"`
+}
+
+// Timeout is a timeout scheduled by a saga instance
+type Timeout struct {
+	Id            ids.Id     `bson:"_id"`
+	SagaType      Type       `bson:"sagaType"`
+	CorrelationID uuid.UUID  `bson:"correlationId"`
+	Name          string     `bson:"name"`
+	DueAt         time.Time  `bson:"dueAt"`
+	Tenant        string     `bson:"tenant,omitempty"`
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty"` // A dispatcher is delivering it until this time
+	Attempts      int        `bson:"attempts"`              // The number of times a dispatcher tried to deliver it
+}
+
+// TimeoutId returns the id of the timeout with the given name for a saga instance.
+// There is at most one pending timeout with the same name.
+func TimeoutId(sagaType Type, correlationID uuid.UUID, name string) ids.Id {
+	return ids.NewID(sagaType, correlationID, name)
+}
+
+// Event returns the event delivered to the saga when the timeout is due
+func (t Timeout) Event() eh.Event {
+	data := &TimeoutData{SagaType: t.SagaType, CorrelationID: t.CorrelationID, Name: t.Name}
+
+	return eh.NewEvent(TimeoutEventType, data, t.DueAt,
+		eh.ForAggregate(TimeoutAggregateType, t.Id, 1),
+		eh.WithMetadata(map[string]interface{}{xeh.TenantMetadataKey: t.Tenant}),
+	)
+}
+
+// TimeoutStore keeps the timeouts scheduled by the sagas until they are delivered by a TimeoutDispatcher
+type TimeoutStore interface {
+	// Schedule stores the timeout, replacing the pending one with the same name for the saga instance
+	Schedule(ctx context.Context, timeout Timeout) error
+	// Cancel removes the pending timeout with the given name for the saga instance, if any
+	Cancel(ctx context.Context, sagaType Type, correlationID uuid.UUID, name string) error
+	// CancelAll removes all the pending timeouts of the saga instance
+	CancelAll(ctx context.Context, sagaType Type, correlationID uuid.UUID) error
+	// ClaimDue locks the earliest due timeout not locked by other dispatcher until now plus lockDuration.
+	// Returns false if there is no timeout to deliver.
+	ClaimDue(ctx context.Context, now time.Time, lockDuration time.Duration) (Timeout, bool, error)
+	// Done removes the claimed timeout after delivering it, unless it was scheduled again in the meantime
+	Done(ctx context.Context, timeout Timeout) error
+}
+
+// InMemoryTimeoutStore is a TimeoutStore that keeps the timeouts in memory, useful for tests
+type InMemoryTimeoutStore struct {
+	timeouts map[ids.Id]Timeout
+	lock     sync.Mutex
+}
+
+var _ TimeoutStore = (*InMemoryTimeoutStore)(nil)
+
+// NewInMemoryTimeoutStore creates a new empty InMemoryTimeoutStore
+func NewInMemoryTimeoutStore() *InMemoryTimeoutStore {
+	return &InMemoryTimeoutStore{timeouts: make(map[ids.Id]Timeout)}
+}
+
+// Schedule implements the Schedule method of the TimeoutStore interface.
+func (s *InMemoryTimeoutStore) Schedule(_ context.Context, timeout Timeout) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	timeout.Id = TimeoutId(timeout.SagaType, timeout.CorrelationID, timeout.Name)
+	timeout.LockedUntil = nil
+	timeout.Attempts = 0
+
+	s.timeouts[timeout.Id] = timeout
+
+	return nil
+}
+
+// Cancel implements the Cancel method of the TimeoutStore interface.
+func (s *InMemoryTimeoutStore) Cancel(_ context.Context, sagaType Type, correlationID uuid.UUID, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.timeouts, TimeoutId(sagaType, correlationID, name))
+
+	return nil
+}
+
+// CancelAll implements the CancelAll method of the TimeoutStore interface.
+func (s *InMemoryTimeoutStore) CancelAll(_ context.Context, sagaType Type, correlationID uuid.UUID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, timeout := range s.timeouts {
+		if timeout.SagaType == sagaType && timeout.CorrelationID == correlationID {
+			delete(s.timeouts, id)
+		}
+	}
+
+	return nil
+}
+
+// ClaimDue implements the ClaimDue method of the TimeoutStore interface.
+func (s *InMemoryTimeoutStore) ClaimDue(_ context.Context, now time.Time, lockDuration time.Duration) (Timeout, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var due []Timeout
+	for _, timeout := range s.timeouts {
+		if !timeout.DueAt.After(now) && (timeout.LockedUntil == nil || timeout.LockedUntil.Before(now)) {
+			due = append(due, timeout)
+		}
+	}
+
+	if len(due) == 0 {
+		return Timeout{}, false, nil
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].DueAt.Before(due[j].DueAt) })
+
+	claimed := due[0]
+	lockedUntil := now.Add(lockDuration)
+	claimed.LockedUntil = &lockedUntil
+	claimed.Attempts++
+
+	s.timeouts[claimed.Id] = claimed
+
+	return claimed, true, nil
+}
+
+// Done implements the Done method of the TimeoutStore interface.
+func (s *InMemoryTimeoutStore) Done(_ context.Context, timeout Timeout) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stored, found := s.timeouts[timeout.Id]
+	if found && stored.LockedUntil != nil && timeout.LockedUntil != nil && stored.LockedUntil.Equal(*timeout.LockedUntil) {
+		delete(s.timeouts, timeout.Id)
+	}
+
+	return nil
+}
+
+// Pending returns the timeouts not delivered yet
+func (s *InMemoryTimeoutStore) Pending() []Timeout {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pending := make([]Timeout, 0, len(s.timeouts))
+	for _, timeout := range s.timeouts {
+		pending = append(pending, timeout)
+	}
+
+	return pending
+}
@@ -0,0 +1,142 @@
+package saga
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultLockDuration = 30 * time.Second
+)
+
+// TimeoutDispatcher delivers the due timeouts to the event handlers of the sagas that scheduled them, as events of
+// type TimeoutEventType. A timeout is removed after the handler accepts it; if the handler fails, it is delivered
+// again after the lock duration. Many dispatchers can run on the same store.
+type TimeoutDispatcher struct {
+	logger       *zap.Logger
+	store        TimeoutStore
+	pollInterval time.Duration
+	lockDuration time.Duration
+	now          func() time.Time
+
+	handlers     map[Type]eh.EventHandler
+	handlersLock sync.RWMutex
+}
+
+// DispatcherOption configures a TimeoutDispatcher
+type DispatcherOption func(*TimeoutDispatcher)
+
+// WithPollInterval sets how often the store is checked for due timeouts. Default is 1 second.
+func WithPollInterval(interval time.Duration) DispatcherOption {
+	return func(d *TimeoutDispatcher) {
+		d.pollInterval = interval
+	}
+}
+
+// WithLockDuration sets how long a timeout is locked while delivered, before other dispatcher can take it.
+// It must be longer than the time to handle the timeout. Default is 30 seconds.
+func WithLockDuration(duration time.Duration) DispatcherOption {
+	return func(d *TimeoutDispatcher) {
+		d.lockDuration = duration
+	}
+}
+
+// NewTimeoutDispatcher creates a new TimeoutDispatcher delivering the timeouts in the store
+func NewTimeoutDispatcher(logger *zap.Logger, store TimeoutStore, options ...DispatcherOption) *TimeoutDispatcher {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(store, "store")
+
+	d := &TimeoutDispatcher{
+		logger:       logger.Named("saga timeout dispatcher"),
+		store:        store,
+		pollInterval: defaultPollInterval,
+		lockDuration: defaultLockDuration,
+		now:          time.Now,
+		handlers:     make(map[Type]eh.EventHandler),
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	return d
+}
+
+// AddHandler sets the handler receiving the timeouts of the given saga type, usually its EventHandler
+// wrapped by an eventerrors.EventHandlerErrorRecorder.
+func (d *TimeoutDispatcher) AddHandler(sagaType Type, handler eh.EventHandler) {
+	xerrors.EnsureNotEmpty(handler, "handler")
+
+	d.handlersLock.Lock()
+	defer d.handlersLock.Unlock()
+
+	d.handlers[sagaType] = handler
+}
+
+// Run delivers the due timeouts every poll interval, until ctx is done.
+func (d *TimeoutDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil && ctx.Err() == nil {
+			d.logger.Warn("could not dispatch saga timeouts", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue delivers the due timeouts, earliest first, and returns the number of delivered timeouts.
+// Timeouts failing are left locked, to be retried when the lock expires.
+func (d *TimeoutDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	delivered := 0
+
+	for ctx.Err() == nil {
+		timeout, found, err := d.store.ClaimDue(ctx, d.now(), d.lockDuration)
+		if err != nil || !found {
+			return delivered, err
+		}
+
+		if err := d.dispatch(ctx, timeout); err != nil {
+			d.logger.Warn("could not deliver saga timeout",
+				zap.String("saga", timeout.SagaType.String()),
+				zap.String("correlation_id", timeout.CorrelationID.String()),
+				zap.String("name", timeout.Name),
+				zap.Int("attempts", timeout.Attempts),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		delivered++
+	}
+
+	return delivered, ctx.Err()
+}
+
+func (d *TimeoutDispatcher) dispatch(ctx context.Context, timeout Timeout) error {
+	d.handlersLock.RLock()
+	handler, found := d.handlers[timeout.SagaType]
+	d.handlersLock.RUnlock()
+
+	if !found {
+		return xerrors.NewNotFoundError("saga handler", "%s", timeout.SagaType)
+	}
+
+	if err := handler.HandleEvent(ctx, timeout.Event()); err != nil {
+		return err
+	}
+
+	return d.store.Done(ctx, timeout)
+}
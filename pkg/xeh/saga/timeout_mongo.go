@@ -0,0 +1,95 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MongoTimeoutStore is a TimeoutStore that keeps the timeouts in a mongo collection.
+// Many dispatchers can claim timeouts from the same collection.
+type MongoTimeoutStore struct {
+	collection *mongo.Collection
+	lease      *xmongo.Lease
+}
+
+var _ TimeoutStore = (*MongoTimeoutStore)(nil)
+
+// NewMongoTimeoutStore creates a new MongoTimeoutStore using the given database and collection
+func NewMongoTimeoutStore(client *mongo.Client, databaseName, collectionName string) *MongoTimeoutStore {
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+
+	collection := client.Database(databaseName).Collection(collectionName)
+
+	return &MongoTimeoutStore{
+		collection: collection,
+		lease:      xmongo.NewLease(collection, bson.D{{Key: "dueAt", Value: 1}}),
+	}
+}
+
+// CreateIndexes creates the indexes used to find the due timeouts and the timeouts of a saga instance
+func (s *MongoTimeoutStore) CreateIndexes(logger *zap.Logger) {
+	xmongo.CreateIndexes(logger, s.collection,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "dueAt", Value: 1}},
+			Options: options.Index().SetName("saga_timeout_due"),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "sagaType", Value: 1}, {Key: "correlationId", Value: 1}},
+			Options: options.Index().SetName("saga_timeout_instance"),
+		},
+	)
+}
+
+// Schedule implements the Schedule method of the TimeoutStore interface.
+func (s *MongoTimeoutStore) Schedule(ctx context.Context, timeout Timeout) error {
+	timeout.Id = TimeoutId(timeout.SagaType, timeout.CorrelationID, timeout.Name)
+	timeout.LockedUntil = nil
+	timeout.Attempts = 0
+
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": timeout.Id}, timeout, options.Replace().SetUpsert(true))
+
+	return xmongo.ConvertMongoError(err, "saga timeout", "%s", timeout.Id)
+}
+
+// Cancel implements the Cancel method of the TimeoutStore interface.
+func (s *MongoTimeoutStore) Cancel(ctx context.Context, sagaType Type, correlationID uuid.UUID, name string) error {
+	id := TimeoutId(sagaType, correlationID, name)
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+
+	return xmongo.ConvertMongoError(err, "saga timeout", "%s", id)
+}
+
+// CancelAll implements the CancelAll method of the TimeoutStore interface.
+func (s *MongoTimeoutStore) CancelAll(ctx context.Context, sagaType Type, correlationID uuid.UUID) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"sagaType": sagaType, "correlationId": correlationID})
+
+	return xmongo.ConvertMongoError(err, "saga timeout", "%s %s", sagaType, correlationID)
+}
+
+// ClaimDue implements the ClaimDue method of the TimeoutStore interface.
+func (s *MongoTimeoutStore) ClaimDue(ctx context.Context, now time.Time, lockDuration time.Duration) (Timeout, bool, error) {
+	var timeout Timeout
+
+	found, err := s.lease.ClaimNext(ctx, bson.M{"dueAt": bson.M{"$lte": now}}, now, lockDuration, &timeout)
+
+	return timeout, found, err
+}
+
+// Done implements the Done method of the TimeoutStore interface.
+func (s *MongoTimeoutStore) Done(ctx context.Context, timeout Timeout) error {
+	// If the timeout was scheduled again, the lock was removed and the new one is kept
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": timeout.Id, xmongo.LeaseUntilField: timeout.LockedUntil})
+
+	return xmongo.ConvertMongoError(err, "saga timeout", "%s", timeout.Id)
+}
@@ -0,0 +1,87 @@
+//go:build integration
+
+package saga
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect()
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+func newTestMongoTimeoutStore(t *testing.T) *MongoTimeoutStore {
+	store := NewMongoTimeoutStore(mongoInMemory.Client(), "test", "saga-timeouts-"+ids.New().String())
+	store.CreateIndexes(zap.NewNop())
+
+	t.Cleanup(func() { _ = store.collection.Drop(context.Background()) })
+
+	return store
+}
+
+func TestMongoTimeoutStore_claims_due_timeouts_once(t *testing.T) {
+	// GIVEN a due timeout and a future one
+	ctx := context.Background()
+	store := newTestMongoTimeoutStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	due := Timeout{SagaType: "test", CorrelationID: uuid.New(), Name: "due", DueAt: now.Add(-time.Second)}
+	future := Timeout{SagaType: "test", CorrelationID: uuid.New(), Name: "future", DueAt: now.Add(time.Hour)}
+	require.NoError(t, store.Schedule(ctx, due))
+	require.NoError(t, store.Schedule(ctx, future))
+
+	// WHEN due timeouts are claimed twice
+	claimed, found, err := store.ClaimDue(ctx, now, time.Minute)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	_, foundAgain, err := store.ClaimDue(ctx, now, time.Minute)
+	require.NoError(t, err)
+
+	// THEN only the due timeout is claimed, and only once
+	require.Equal(t, "due", claimed.Name)
+	require.Equal(t, 1, claimed.Attempts)
+	require.False(t, foundAgain)
+
+	// WHEN it is done
+	require.NoError(t, store.Done(ctx, claimed))
+
+	// THEN it is removed
+	count, err := store.collection.CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func TestMongoTimeoutStore_cancels_all_timeouts_of_saga_instance(t *testing.T) {
+	// GIVEN two timeouts of a saga instance
+	ctx := context.Background()
+	store := newTestMongoTimeoutStore(t)
+	id := uuid.New()
+
+	require.NoError(t, store.Schedule(ctx, Timeout{SagaType: "test", CorrelationID: id, Name: "a", DueAt: time.Now()}))
+	require.NoError(t, store.Schedule(ctx, Timeout{SagaType: "test", CorrelationID: id, Name: "b", DueAt: time.Now()}))
+
+	// WHEN all are canceled
+	require.NoError(t, store.CancelAll(ctx, "test", id))
+
+	// THEN none is left
+	_, found, err := store.ClaimDue(ctx, time.Now().Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.False(t, found)
+}
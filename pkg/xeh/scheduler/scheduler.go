@@ -0,0 +1,388 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xbson"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPollInterval  = time.Second
+	defaultLeaseDuration = 30 * time.Second
+	defaultRetryInterval = time.Minute
+	defaultMaxAttempts   = 5
+	defaultRetention     = 7 * 24 * time.Hour
+)
+
+// Status is the delivery status of a ScheduledCommand
+type Status string
+
+const (
+	StatusPending  Status = "pending"  // The command waits to be delivered
+	StatusDone     Status = "done"     // The command was handled
+	StatusCanceled Status = "canceled" // The command was canceled before being delivered
+	StatusFailed   Status = "failed"   // The command failed after the max attempts
+)
+
+// ScheduledCommand is a command stored to be delivered at a due time
+type ScheduledCommand struct {
+	Id            ids.Id         `bson:"_id"`
+	CommandType   eh.CommandType `bson:"commandType"`
+	Command       bson.Raw       `bson:"command"` // The command encoded with the xbson registry
+	DueAt         time.Time      `bson:"dueAt"`   // When to deliver it, moved forward after a failed attempt
+	CreatedAt     time.Time      `bson:"createdAt"`
+	Tenant        string         `bson:"tenant,omitempty"`
+	CorrelationId string         `bson:"correlationId,omitempty"`
+	Status        Status         `bson:"status"`
+	Attempts      int            `bson:"attempts"`              // The number of times a scheduler tried to deliver it
+	LockedUntil   *time.Time     `bson:"lockedUntil,omitempty"` // The end of the lease of the scheduler delivering it
+	LockedBy      string         `bson:"lockedBy,omitempty"`    // The scheduler holding the lease
+	LastError     string         `bson:"lastError,omitempty"`   // The error of the last failed attempt
+	FinishedAt    *time.Time     `bson:"finishedAt,omitempty"`  // When it was done, canceled or failed
+}
+
+// Scheduler stores commands in a mongo collection and delivers them to a command handler when they are due.
+// Many schedulers, one for each replica of the service, can deliver the commands of the same collection: a
+// scheduler claims a command with a lease, and other schedulers take it only if the lease expires.
+// Delivery is at-least-once, if a scheduler stops after handling a command and before marking it as done, the
+// command is delivered again when the lease expires.
+//
+// Commands must be registered with eh.RegisterCommand to be decoded.
+type Scheduler struct {
+	logger        *zap.Logger
+	collection    *mongo.Collection
+	target        eh.CommandHandler
+	registry      *bsoncodec.Registry
+	owner         string
+	lease         *xmongo.Lease
+	pollInterval  time.Duration
+	leaseDuration time.Duration
+	retryInterval time.Duration
+	maxAttempts   int
+	retention     time.Duration
+	now           func() time.Time
+}
+
+// Option configures a Scheduler
+type Option func(*Scheduler)
+
+// WithPollInterval sets how often the collection is checked for due commands. Default is 1 second.
+func WithPollInterval(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		s.pollInterval = interval
+	}
+}
+
+// WithLeaseDuration sets how long a command is claimed while delivered, before other scheduler can take it.
+// It must be longer than the time to handle the command. Default is 30 seconds.
+func WithLeaseDuration(duration time.Duration) Option {
+	return func(s *Scheduler) {
+		s.leaseDuration = duration
+	}
+}
+
+// WithRetryInterval sets how long to wait to deliver again a command that failed. Default is 1 minute.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		s.retryInterval = interval
+	}
+}
+
+// WithMaxAttempts sets how many times a failing command is delivered before marking it as failed. Default is 5.
+func WithMaxAttempts(maxAttempts int) Option {
+	return func(s *Scheduler) {
+		s.maxAttempts = maxAttempts
+	}
+}
+
+// WithRetention sets how long the finished commands are kept before mongo deletes them. Default is 7 days.
+func WithRetention(retention time.Duration) Option {
+	return func(s *Scheduler) {
+		s.retention = retention
+	}
+}
+
+// WithRegistry sets the registry used to encode and decode the commands. Default is the one built by
+// xbson.BuildRegistry when the scheduler is created.
+func WithRegistry(registry *bsoncodec.Registry) Option {
+	return func(s *Scheduler) {
+		s.registry = registry
+	}
+}
+
+// NewScheduler creates a new Scheduler storing the commands in the given database and collection, and delivering
+// them to the target command handler.
+func NewScheduler(logger *zap.Logger, client *mongo.Client, databaseName, collectionName string, target eh.CommandHandler, options ...Option) *Scheduler {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+	xerrors.EnsureNotEmpty(target, "target")
+
+	s := &Scheduler{
+		logger:        logger.Named("command scheduler"),
+		collection:    client.Database(databaseName).Collection(collectionName),
+		target:        target,
+		owner:         newOwner(),
+		pollInterval:  defaultPollInterval,
+		leaseDuration: defaultLeaseDuration,
+		retryInterval: defaultRetryInterval,
+		maxAttempts:   defaultMaxAttempts,
+		retention:     defaultRetention,
+		now:           time.Now,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if s.registry == nil {
+		s.registry = xbson.BuildRegistry()
+	}
+
+	s.lease = xmongo.NewLease(s.collection, bson.D{{Key: "dueAt", Value: 1}}, xmongo.WithLeaseOwner(s.owner))
+
+	return s
+}
+
+// newOwner returns a unique name for this scheduler, to identify the leases it holds
+func newOwner() string {
+	host, _ := os.Hostname()
+	return host + "/" + ids.New().String()
+}
+
+// CreateIndexes creates the indexes used to find the due commands, and to delete the finished ones after the
+// retention period.
+func (s *Scheduler) CreateIndexes() {
+	xmongo.CreateIndexes(s.logger, s.collection,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "dueAt", Value: 1}},
+			Options: options.Index().SetName("scheduled_command_due"),
+		},
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "finishedAt", Value: 1}},
+			Options: options.Index().
+				SetName("scheduled_command_ttl").
+				SetExpireAfterSeconds(int32(s.retention.Seconds())),
+		},
+	)
+}
+
+// Schedule stores the command to be delivered at the given time, and returns the id to cancel it.
+// The tenant and correlation id in ctx are set in the context used to deliver it.
+func (s *Scheduler) Schedule(ctx context.Context, cmd eh.Command, at time.Time) (ids.Id, error) {
+	encoded, err := xbson.MarshalWithRegistry(s.registry, cmd)
+	if err != nil {
+		return ids.Empty(), xerrors.NewInvalidArgumentError("scheduled command", "cannot encode %s: %s", cmd.CommandType(), err)
+	}
+
+	correlationId, _ := xcontext.GetCorrelationId(ctx)
+
+	scheduled := ScheduledCommand{
+		Id:            ids.New(),
+		CommandType:   cmd.CommandType(),
+		Command:       encoded,
+		DueAt:         at,
+		CreatedAt:     s.now(),
+		Tenant:        xcontext.GetTenantOrDefault(ctx),
+		CorrelationId: correlationId,
+		Status:        StatusPending,
+	}
+
+	if _, err := s.collection.InsertOne(ctx, scheduled); err != nil {
+		return ids.Empty(), xmongo.ConvertMongoError(err, "scheduled command", "%s", cmd.CommandType())
+	}
+
+	return scheduled.Id, nil
+}
+
+// Cancel cancels the pending command with the given id. Returns a not found error if there is no such command,
+// and an invalid state error if it was already delivered, or it is being delivered.
+func (s *Scheduler) Cancel(ctx context.Context, id ids.Id) error {
+	now := s.now()
+
+	filter := s.lease.Available(now)
+	filter["_id"] = id
+	filter["status"] = StatusPending
+
+	update := bson.M{
+		"$set":   bson.M{"status": StatusCanceled, "finishedAt": now},
+		"$unset": s.lease.Released(),
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return xmongo.ConvertMongoError(err, "scheduled command", "%s", id)
+	}
+
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	scheduled, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if scheduled.Status == StatusPending {
+		return xerrors.NewInvalidStateError("scheduled command", "%s is being delivered", id)
+	}
+
+	return xerrors.NewInvalidStateError("scheduled command", "%s is already %s", id, scheduled.Status)
+}
+
+// Get returns the scheduled command with the given id
+func (s *Scheduler) Get(ctx context.Context, id ids.Id) (ScheduledCommand, error) {
+	var scheduled ScheduledCommand
+
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&scheduled)
+
+	return scheduled, xmongo.ConvertMongoError(err, "scheduled command", "%s", id)
+}
+
+// Run delivers the due commands every poll interval, until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.DispatchDue(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn("could not dispatch scheduled commands", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue delivers the due commands, earliest first, and returns the number of handled commands.
+// Commands failing are retried after the retry interval, until the max attempts.
+func (s *Scheduler) DispatchDue(ctx context.Context) (int, error) {
+	handled := 0
+
+	for ctx.Err() == nil {
+		scheduled, found, err := s.claimNext(ctx)
+		if err != nil || !found {
+			return handled, err
+		}
+
+		if s.deliver(ctx, scheduled) {
+			handled++
+		}
+	}
+
+	return handled, ctx.Err()
+}
+
+// claimNext finds the earliest due command not claimed by other scheduler, and claims it
+func (s *Scheduler) claimNext(ctx context.Context) (ScheduledCommand, bool, error) {
+	now := s.now()
+
+	filter := bson.M{
+		"status": StatusPending,
+		"dueAt":  bson.M{"$lte": now},
+	}
+
+	var scheduled ScheduledCommand
+
+	found, err := s.lease.ClaimNext(ctx, filter, now, s.leaseDuration, &scheduled)
+
+	return scheduled, found, err
+}
+
+// deliver sends the claimed command to the target and records the result. Returns true if it was handled.
+func (s *Scheduler) deliver(ctx context.Context, scheduled ScheduledCommand) bool {
+	cmd, err := s.decode(scheduled)
+	if err == nil {
+		err = s.target.HandleCommand(s.commandContext(ctx, scheduled), cmd)
+	}
+
+	if err != nil {
+		s.logger.Warn("could not deliver scheduled command",
+			zap.String("id", scheduled.Id.String()),
+			zap.String("command", scheduled.CommandType.String()),
+			zap.Int("attempts", scheduled.Attempts),
+			zap.Error(err),
+		)
+
+		s.recordFailure(ctx, scheduled, err)
+		return false
+	}
+
+	s.finish(ctx, scheduled, bson.M{"status": StatusDone})
+
+	return true
+}
+
+func (s *Scheduler) decode(scheduled ScheduledCommand) (eh.Command, error) {
+	cmd, err := eh.CreateCommand(scheduled.CommandType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bson.UnmarshalWithRegistry(s.registry, scheduled.Command, cmd); err != nil {
+		return nil, xerrors.NewInvalidArgumentError("scheduled command", "cannot decode %s: %s", scheduled.CommandType, err)
+	}
+
+	return cmd, nil
+}
+
+func (s *Scheduler) commandContext(ctx context.Context, scheduled ScheduledCommand) context.Context {
+	if scheduled.Tenant != "" {
+		ctx = xcontext.WithTenant(ctx, scheduled.Tenant)
+	}
+	if scheduled.CorrelationId != "" {
+		ctx = xcontext.WithCorrelationId(ctx, scheduled.CorrelationId)
+	}
+	return ctx
+}
+
+func (s *Scheduler) recordFailure(ctx context.Context, scheduled ScheduledCommand, err error) {
+	if scheduled.Attempts >= s.maxAttempts {
+		s.finish(ctx, scheduled, bson.M{"status": StatusFailed, "lastError": err.Error()})
+		return
+	}
+
+	// The lease is released, and the command is due again after the retry interval
+	s.update(ctx, scheduled, bson.M{
+		"$set":   bson.M{"lastError": err.Error(), "dueAt": s.now().Add(s.retryInterval)},
+		"$unset": s.lease.Released(),
+	})
+}
+
+func (s *Scheduler) finish(ctx context.Context, scheduled ScheduledCommand, set bson.M) {
+	set["finishedAt"] = s.now()
+
+	s.update(ctx, scheduled, bson.M{
+		"$set":   set,
+		"$unset": s.lease.Released(),
+	})
+}
+
+// update updates the claimed command if this scheduler still holds the lease
+func (s *Scheduler) update(ctx context.Context, scheduled ScheduledCommand, update bson.M) {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": scheduled.Id, xmongo.LeaseOwnerField: s.owner, xmongo.LeaseAttemptsField: scheduled.Attempts}, update)
+	if err != nil {
+		s.logger.Error("could not update scheduled command", zap.String("id", scheduled.Id.String()), zap.Error(err))
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		s.logger.Warn("lease of scheduled command was lost", zap.String("id", scheduled.Id.String()))
+	}
+}
@@ -0,0 +1,138 @@
+//go:build integration
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect()
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+type commandHandlerFake struct {
+	handled  []eh.Command
+	failures int
+}
+
+func (h *commandHandlerFake) HandleCommand(_ context.Context, cmd eh.Command) error {
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("handler not available")
+	}
+	h.handled = append(h.handled, cmd)
+	return nil
+}
+
+func newTestScheduler(t *testing.T, target eh.CommandHandler, options ...Option) *Scheduler {
+	s := NewScheduler(zap.NewNop(), mongoInMemory.Client(), "test", "scheduled-"+ids.New().String(), target, options...)
+	s.CreateIndexes()
+
+	t.Cleanup(func() { _ = s.collection.Drop(context.Background()) })
+
+	return s
+}
+
+func TestScheduler_delivers_due_commands(t *testing.T) {
+	// GIVEN a command due now and one due tomorrow
+	ctx := context.Background()
+	target := &commandHandlerFake{}
+	s := newTestScheduler(t, target)
+
+	due := &expireOffer{OfferID: ids.New(), Reason: "due"}
+	_, err := s.Schedule(ctx, due, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	_, err = s.Schedule(ctx, &expireOffer{OfferID: ids.New()}, time.Now().Add(24*time.Hour))
+	require.NoError(t, err)
+
+	// WHEN due commands are dispatched
+	handled, err := s.DispatchDue(ctx)
+
+	// THEN only the due command is delivered
+	require.NoError(t, err)
+	require.Equal(t, 1, handled)
+	require.Equal(t, []eh.Command{due}, target.handled)
+}
+
+func TestScheduler_claims_command_once_between_replicas(t *testing.T) {
+	// GIVEN a due command and two schedulers on the same collection
+	ctx := context.Background()
+	s := newTestScheduler(t, &commandHandlerFake{})
+	other := NewScheduler(zap.NewNop(), mongoInMemory.Client(), "test", s.collection.Name(), &commandHandlerFake{})
+
+	_, err := s.Schedule(ctx, &expireOffer{OfferID: ids.New()}, time.Now())
+	require.NoError(t, err)
+
+	// WHEN both claim it
+	_, found, err := s.claimNext(ctx)
+	require.NoError(t, err)
+	_, foundByOther, err := other.claimNext(ctx)
+	require.NoError(t, err)
+
+	// THEN only the first one gets it
+	require.True(t, found)
+	require.False(t, foundByOther)
+}
+
+func TestScheduler_retries_failed_commands_until_max_attempts(t *testing.T) {
+	// GIVEN a command whose handler always fails
+	ctx := context.Background()
+	s := newTestScheduler(t, &commandHandlerFake{failures: 10}, WithRetryInterval(0), WithMaxAttempts(2))
+
+	id, err := s.Schedule(ctx, &expireOffer{OfferID: ids.New()}, time.Now())
+	require.NoError(t, err)
+
+	// WHEN due commands are dispatched
+	handled, err := s.DispatchDue(ctx)
+
+	// THEN it is delivered max attempts times and marked as failed
+	require.NoError(t, err)
+	require.Equal(t, 0, handled)
+
+	scheduled, err := s.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, scheduled.Status)
+	require.Equal(t, 2, scheduled.Attempts)
+	require.Equal(t, "handler not available", scheduled.LastError)
+}
+
+func TestScheduler_cancels_pending_commands(t *testing.T) {
+	// GIVEN a scheduled command
+	ctx := context.Background()
+	target := &commandHandlerFake{}
+	s := newTestScheduler(t, target)
+
+	id, err := s.Schedule(ctx, &expireOffer{OfferID: ids.New()}, time.Now())
+	require.NoError(t, err)
+
+	// WHEN it is canceled
+	require.NoError(t, s.Cancel(ctx, id))
+
+	// THEN it is not delivered
+	handled, err := s.DispatchDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, handled)
+
+	// AND it cannot be canceled again
+	require.ErrorIs(t, s.Cancel(ctx, id), xerrors.ErrInvalidState)
+
+	// AND unknown commands are not found
+	require.ErrorIs(t, s.Cancel(ctx, ids.New()), xerrors.ErrNotFound)
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xbson"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const expireOfferType = eh.CommandType("expire-offer")
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &expireOffer{} })
+}
+
+type expireOffer struct {
+	OfferID uuid.UUID `json:"offerId"`
+	Reason  string    `json:"reason"`
+}
+
+func (c *expireOffer) AggregateID() uuid.UUID          { return c.OfferID }
+func (c *expireOffer) AggregateType() eh.AggregateType { return "offer" }
+func (c *expireOffer) CommandType() eh.CommandType     { return expireOfferType }
+
+func TestScheduler_decodes_command_encoded_with_registry(t *testing.T) {
+	// GIVEN a command encoded with the registry
+	s := &Scheduler{registry: xbson.BuildRegistry()}
+	cmd := &expireOffer{OfferID: ids.New(), Reason: "timeout"}
+
+	encoded, err := xbson.MarshalWithRegistry(s.registry, cmd)
+	require.NoError(t, err)
+
+	// WHEN it is decoded
+	decoded, err := s.decode(ScheduledCommand{CommandType: expireOfferType, Command: encoded})
+
+	// THEN the same command is returned
+	require.NoError(t, err)
+	require.Equal(t, cmd, decoded)
+}
+
+func TestScheduler_fails_to_decode_unregistered_command(t *testing.T) {
+	// GIVEN a scheduler
+	s := &Scheduler{registry: xbson.BuildRegistry()}
+
+	// WHEN a command not registered is decoded
+	_, err := s.decode(ScheduledCommand{CommandType: "unknown"})
+
+	// THEN an error is returned
+	require.Error(t, err)
+}
+
+func TestScheduler_delivers_command_with_scheduling_tenant_and_correlation_id(t *testing.T) {
+	// GIVEN a command scheduled with tenant and correlation id
+	s := &Scheduler{now: time.Now}
+	scheduled := ScheduledCommand{Tenant: "a-tenant", CorrelationId: "a-correlation"}
+
+	// WHEN the context to deliver it is built
+	ctx := s.commandContext(context.Background(), scheduled)
+
+	// THEN it has the tenant and correlation id
+	tenant, _ := xcontext.GetTenant(ctx)
+	correlationId, _ := xcontext.GetCorrelationId(ctx)
+	require.Equal(t, "a-tenant", tenant)
+	require.Equal(t, "a-correlation", correlationId)
+}
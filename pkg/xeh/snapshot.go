@@ -0,0 +1,150 @@
+package xeh
+
+import (
+	"context"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.uber.org/zap"
+)
+
+// Snapshot is the state of a read model of an aggregate after applying the events up to Version.
+// Replaying events for the aggregate can start from the snapshot instead of from the first event.
+type Snapshot struct {
+	AggregateID   uuid.UUID
+	AggregateType eh.AggregateType
+	Version       int
+	Timestamp     time.Time
+	State         eh.Entity
+}
+
+// SnapshotStore stores the latest snapshot of each aggregate.
+// Use a different store (or collection) for each read model.
+type SnapshotStore interface {
+	// LoadSnapshot returns the latest snapshot of the aggregate, or nil if there is none.
+	LoadSnapshot(ctx context.Context, id uuid.UUID) (*Snapshot, error)
+
+	// SaveSnapshot saves the snapshot, replacing the previous one of the same aggregate.
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+}
+
+// SnapshotPolicy decides when a snapshot should be taken
+type SnapshotPolicy interface {
+	// ShouldTakeSnapshot returns true if a snapshot should be taken after handling the event
+	ShouldTakeSnapshot(event eh.Event) bool
+}
+
+type everyNEventsPolicy int
+
+// EveryNEvents returns a SnapshotPolicy that takes a snapshot every n events of an aggregate.
+func EveryNEvents(n int) SnapshotPolicy {
+	if n <= 0 {
+		n = 1
+	}
+	return everyNEventsPolicy(n)
+}
+
+func (n everyNEventsPolicy) ShouldTakeSnapshot(event eh.Event) bool {
+	return event.Version()%int(n) == 0
+}
+
+// SnapshotHandler is an event handler that wraps a projector event handler to take snapshots of the read model
+// after handling an event, following the configured policy.
+// Failures taking snapshots are logged but not returned, the event was already handled.
+type SnapshotHandler struct {
+	eh.EventHandler
+
+	logger *zap.Logger
+	repo   eh.ReadRepo
+	store  SnapshotStore
+	policy SnapshotPolicy
+}
+
+var _ eh.EventHandler = (*SnapshotHandler)(nil)
+
+// NewSnapshotHandler creates a new SnapshotHandler that saves into store the entities of repo projected by handler.
+func NewSnapshotHandler(logger *zap.Logger, handler eh.EventHandler, repo eh.ReadRepo, store SnapshotStore, policy SnapshotPolicy) *SnapshotHandler {
+	return &SnapshotHandler{
+		EventHandler: handler,
+		logger:       logger,
+		repo:         repo,
+		store:        store,
+		policy:       policy,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface.
+func (h *SnapshotHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	if err := h.EventHandler.HandleEvent(ctx, event); err != nil {
+		return err
+	}
+
+	if !h.policy.ShouldTakeSnapshot(event) {
+		return nil
+	}
+
+	if err := h.takeSnapshot(ctx, event); err != nil {
+		h.logger.Warn(
+			"Failed to take snapshot",
+			zap.String("agg_type", event.AggregateType().String()),
+			zap.String("agg_id", event.AggregateID().String()),
+			zap.Int("agg_version", event.Version()),
+			zap.Error(err),
+		)
+	}
+
+	return nil
+}
+
+func (h *SnapshotHandler) takeSnapshot(ctx context.Context, event eh.Event) error {
+	entity, err := h.repo.Find(ctx, event.AggregateID())
+	if err != nil {
+		return err
+	}
+
+	version := event.Version()
+	if versionable, ok := entity.(eh.Versionable); ok {
+		version = versionable.AggregateVersion()
+	}
+
+	return h.store.SaveSnapshot(ctx, Snapshot{
+		AggregateID:   event.AggregateID(),
+		AggregateType: event.AggregateType(),
+		Version:       version,
+		Timestamp:     event.Timestamp(),
+		State:         entity,
+	})
+}
+
+// restoreSnapshot saves in the repo the state of the latest snapshot of the aggregate.
+// Returns the version of the restored snapshot, or 0 if there is none.
+func restoreSnapshot(ctx context.Context, store SnapshotStore, repo eh.WriteRepo, aggregateType eh.AggregateType, id uuid.UUID) (int, error) {
+	if store == nil {
+		return 0, nil
+	}
+
+	snapshot, err := store.LoadSnapshot(ctx, id)
+	if err != nil || snapshot == nil {
+		return 0, err
+	}
+
+	if snapshot.AggregateType != aggregateType {
+		return 0, eh.ErrMismatchedEventAggregateTypes
+	}
+
+	if err := repo.Save(ctx, snapshot.State); err != nil {
+		return 0, err
+	}
+
+	return snapshot.Version, nil
+}
+
+// loadEventsAfter loads the events of the aggregate with version greater than the given one.
+func loadEventsAfter(ctx context.Context, eventStore eh.EventStore, id uuid.UUID, version int) ([]eh.Event, error) {
+	if version == 0 {
+		return eventStore.Load(ctx, id)
+	}
+
+	return eventStore.LoadFrom(ctx, id, version+1)
+}
@@ -0,0 +1,81 @@
+package xeh
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/AltScore/gothic/v2/pkg/xrepo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// InMemorySnapshotStore is a SnapshotStore that keeps the snapshots in memory. Useful for tests.
+// As the MongoSnapshotStore, it keeps a copy of the states, so they can be modified after saving or loading them.
+type InMemorySnapshotStore struct {
+	snapshots *xrepo.InMemoryRepo[Snapshot]
+}
+
+var _ SnapshotStore = (*InMemorySnapshotStore)(nil)
+
+// NewInMemorySnapshotStore creates a new empty InMemorySnapshotStore
+func NewInMemorySnapshotStore() *InMemorySnapshotStore {
+	return &InMemorySnapshotStore{
+		snapshots: xrepo.NewInMemoryRepo(func(s Snapshot) string { return s.AggregateID.String() }),
+	}
+}
+
+// LoadSnapshot implements the LoadSnapshot method of the SnapshotStore interface.
+func (s *InMemorySnapshotStore) LoadSnapshot(_ context.Context, id uuid.UUID) (*Snapshot, error) {
+	snapshot, found := s.snapshots.FindByKey(id.String())
+	if !found {
+		return nil, nil
+	}
+
+	state, err := copyState(snapshot.State)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.State = state
+	return &snapshot, nil
+}
+
+// SaveSnapshot implements the SaveSnapshot method of the SnapshotStore interface.
+func (s *InMemorySnapshotStore) SaveSnapshot(_ context.Context, snapshot Snapshot) error {
+	state, err := copyState(snapshot.State)
+	if err != nil {
+		return err
+	}
+
+	snapshot.State = state
+	s.snapshots.Store(snapshot)
+	return nil
+}
+
+// copyState returns a deep copy of the state, encoding and decoding it with bson as the MongoSnapshotStore does
+func copyState(state eh.Entity) (eh.Entity, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	raw, err := bson.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	stateType := reflect.TypeOf(state)
+	if stateType.Kind() != reflect.Ptr {
+		copied := reflect.New(stateType)
+		if err := bson.Unmarshal(raw, copied.Interface()); err != nil {
+			return nil, err
+		}
+		return copied.Elem().Interface().(eh.Entity), nil
+	}
+
+	copied := reflect.New(stateType.Elem())
+	if err := bson.Unmarshal(raw, copied.Interface()); err != nil {
+		return nil, err
+	}
+	return copied.Interface().(eh.Entity), nil
+}
@@ -0,0 +1,91 @@
+package xeh
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoSnapshotStore is a SnapshotStore that keeps the latest snapshot of each aggregate in a mongo collection.
+type MongoSnapshotStore struct {
+	collection    *mongo.Collection
+	entityFactory func() eh.Entity
+}
+
+var _ SnapshotStore = (*MongoSnapshotStore)(nil)
+
+type snapshotDocument struct {
+	AggregateID   uuid.UUID        `bson:"_id"`
+	AggregateType eh.AggregateType `bson:"aggregate_type"`
+	Version       int              `bson:"version"`
+	Timestamp     time.Time        `bson:"timestamp"`
+	State         bson.Raw         `bson:"state"`
+}
+
+// NewMongoSnapshotStore creates a new MongoSnapshotStore using the given database and collection.
+// The entity factory is used to create the entities to decode the stored states.
+func NewMongoSnapshotStore(client *mongo.Client, databaseName, collectionName string, entityFactory func() eh.Entity) *MongoSnapshotStore {
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+	xerrors.EnsureNotEmpty(collectionName, "collectionName")
+	xerrors.EnsureNotEmpty(entityFactory, "entityFactory")
+
+	return &MongoSnapshotStore{
+		collection:    client.Database(databaseName).Collection(collectionName),
+		entityFactory: entityFactory,
+	}
+}
+
+// LoadSnapshot implements the LoadSnapshot method of the SnapshotStore interface.
+func (s *MongoSnapshotStore) LoadSnapshot(ctx context.Context, id uuid.UUID) (*Snapshot, error) {
+	var doc snapshotDocument
+
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xmongo.ConvertMongoError(err, "snapshot", "%s", id)
+	}
+
+	state := s.entityFactory()
+	if err := bson.Unmarshal(doc.State, state); err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		AggregateID:   doc.AggregateID,
+		AggregateType: doc.AggregateType,
+		Version:       doc.Version,
+		Timestamp:     doc.Timestamp,
+		State:         state,
+	}, nil
+}
+
+// SaveSnapshot implements the SaveSnapshot method of the SnapshotStore interface.
+func (s *MongoSnapshotStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	state, err := bson.Marshal(snapshot.State)
+	if err != nil {
+		return err
+	}
+
+	doc := snapshotDocument{
+		AggregateID:   snapshot.AggregateID,
+		AggregateType: snapshot.AggregateType,
+		Version:       snapshot.Version,
+		Timestamp:     snapshot.Timestamp,
+		State:         state,
+	}
+
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": snapshot.AggregateID}, doc, options.Replace().SetUpsert(true))
+
+	return xmongo.ConvertMongoError(err, "snapshot", "%s", snapshot.AggregateID)
+}
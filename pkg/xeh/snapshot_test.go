@@ -0,0 +1,126 @@
+package xeh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEveryNEvents(t *testing.T) {
+	policy := EveryNEvents(3)
+	aggID := ids.New()
+
+	var taken []int
+	for v := 1; v <= 7; v++ {
+		if policy.ShouldTakeSnapshot(eh.NewEvent("test", nil, time.Now(), eh.ForAggregate(testAggType, aggID, v))) {
+			taken = append(taken, v)
+		}
+	}
+
+	require.Equal(t, []int{3, 6}, taken)
+}
+
+func TestInMemorySnapshotStore_returns_latest_snapshot(t *testing.T) {
+	// GIVEN a store with two snapshots of the same aggregate
+	store := NewInMemorySnapshotStore()
+	aggID := ids.New()
+
+	require.NoError(t, store.SaveSnapshot(context.Background(), Snapshot{AggregateID: aggID, Version: 3}))
+	require.NoError(t, store.SaveSnapshot(context.Background(), Snapshot{AggregateID: aggID, Version: 6}))
+
+	// WHEN the snapshot is loaded
+	snapshot, err := store.LoadSnapshot(context.Background(), aggID)
+
+	// THEN the latest one is returned
+	require.NoError(t, err)
+	require.Equal(t, 6, snapshot.Version)
+
+	// AND there is no snapshot for other aggregates
+	snapshot, err = store.LoadSnapshot(context.Background(), ids.New())
+	require.NoError(t, err)
+	require.Nil(t, snapshot)
+}
+
+func TestInMemorySnapshotStore_keeps_a_copy_of_the_state(t *testing.T) {
+	// GIVEN a saved snapshot
+	store := NewInMemorySnapshotStore()
+	aggID := ids.New()
+	state := &ehmocks.EntityFake{ID: aggID}
+
+	require.NoError(t, store.SaveSnapshot(context.Background(), Snapshot{AggregateID: aggID, Version: 1, State: state}))
+
+	// WHEN the saved and the loaded states are modified
+	state.ID = ids.New()
+
+	snapshot, err := store.LoadSnapshot(context.Background(), aggID)
+	require.NoError(t, err)
+	snapshot.State.(*ehmocks.EntityFake).ID = ids.New()
+
+	// THEN the stored snapshot is not modified
+	snapshot, err = store.LoadSnapshot(context.Background(), aggID)
+	require.NoError(t, err)
+	require.Equal(t, &ehmocks.EntityFake{ID: aggID}, snapshot.State)
+}
+
+func TestSnapshotHandler_takes_snapshot_following_policy(t *testing.T) {
+	// GIVEN a snapshot handler taking snapshots every 2 events
+	aggID := ids.New()
+	entity := &ehmocks.EntityFake{ID: aggID}
+
+	inner := &ehmocks.ReadRepoMock{}
+	inner.On("Find", mock.Anything, aggID).Return(entity, nil)
+
+	store := NewInMemorySnapshotStore()
+	handler := NewSnapshotHandler(zap.NewNop(), eh.EventHandlerFunc(func(context.Context, eh.Event) error { return nil }), inner, store, EveryNEvents(2))
+
+	// WHEN the first event is handled
+	require.NoError(t, handler.HandleEvent(context.Background(), eh.NewEvent("test", nil, time.Now(), eh.ForAggregate(testAggType, aggID, 1))))
+
+	// THEN no snapshot is taken
+	snapshot, _ := store.LoadSnapshot(context.Background(), aggID)
+	require.Nil(t, snapshot)
+
+	// WHEN the second event is handled
+	require.NoError(t, handler.HandleEvent(context.Background(), eh.NewEvent("test", nil, time.Now(), eh.ForAggregate(testAggType, aggID, 2))))
+
+	// THEN the snapshot is taken with the read model state
+	snapshot, _ = store.LoadSnapshot(context.Background(), aggID)
+	require.NotNil(t, snapshot)
+	require.Equal(t, 2, snapshot.Version)
+	require.Equal(t, entity, snapshot.State)
+}
+
+func TestEntityHealer_replays_events_after_snapshot(t *testing.T) {
+	// GIVEN a snapshot at version 5
+	aggID := ids.New()
+	entity := &ehmocks.EntityFake{ID: aggID}
+
+	store := NewInMemorySnapshotStore()
+	require.NoError(t, store.SaveSnapshot(context.Background(), Snapshot{AggregateID: aggID, AggregateType: testAggType, Version: 5, State: entity}))
+
+	repo := &ehmocks.ReadRepoMock{}
+	repo.On("Save", mock.Anything, entity).Return(nil)
+
+	eventStore := &ehmocks.EventStoreMock{}
+	eventStore.On("LoadFrom", mock.Anything, aggID, 6).Return(nil, nil)
+
+	healer := NewEntityHealerWithSnapshots(zap.NewNop(), eventStore, nopProjector{}, repo, store)
+
+	// WHEN the events are replayed
+	err := healer.replayEvents(context.Background(), testAggType, aggID)
+
+	// THEN the snapshot is restored in the read model
+	require.NoError(t, err)
+	repo.AssertCalled(t, "Save", mock.Anything, entity)
+
+	// AND only the events after the snapshot are loaded
+	eventStore.AssertCalled(t, "LoadFrom", mock.Anything, aggID, 6)
+	eventStore.AssertNotCalled(t, "Load", mock.Anything, aggID)
+}
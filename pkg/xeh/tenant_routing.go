@@ -0,0 +1,118 @@
+package xeh
+
+import (
+	"context"
+	"sync"
+
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// MatchTenants matches the events of any of the tenants, as added by WithTenant.
+type MatchTenants []string
+
+var _ eh.EventMatcher = MatchTenants{}
+
+// Match implements the Match method of the eh.EventMatcher interface.
+func (m MatchTenants) Match(event eh.Event) bool {
+	if event == nil {
+		return false
+	}
+
+	tenant := GetEventTenant(event)
+	for _, t := range m {
+		if t == tenant {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TenantHandlerFactory creates the event handler for a tenant, i.e. a projector writing to the tenant collection.
+type TenantHandlerFactory func(ctx context.Context, tenant string) (eh.EventHandler, error)
+
+// TenantRouter is an event handler that dispatches each event to the handler of its tenant.
+// The handler runs with the tenant in the context, as set by xcontext.WithTenant.
+// Handlers are the ones added for a tenant, or else the ones created by the factory on the first event of the tenant.
+type TenantRouter struct {
+	handlerType eh.EventHandlerType
+	factory     TenantHandlerFactory
+
+	handlers     map[string]eh.EventHandler
+	handlersLock sync.RWMutex
+}
+
+var _ eh.EventHandler = (*TenantRouter)(nil)
+
+// NewTenantRouter creates a new TenantRouter. The factory is optional, without it only the added handlers are used.
+func NewTenantRouter(handlerType eh.EventHandlerType, factory TenantHandlerFactory) *TenantRouter {
+	xerrors.EnsureNotEmpty(handlerType, "handlerType")
+
+	return &TenantRouter{
+		handlerType: handlerType,
+		factory:     factory,
+		handlers:    make(map[string]eh.EventHandler),
+	}
+}
+
+// AddHandler sets the handler for the events of the tenant
+func (r *TenantRouter) AddHandler(tenant string, handler eh.EventHandler) {
+	xerrors.EnsureNotEmpty(handler, "handler")
+
+	r.handlersLock.Lock()
+	defer r.handlersLock.Unlock()
+
+	r.handlers[tenant] = handler
+}
+
+// HandlerType implements the HandlerType method of the eh.EventHandler interface.
+func (r *TenantRouter) HandlerType() eh.EventHandlerType {
+	return r.handlerType
+}
+
+// HandleEvent implements the HandleEvent method of the eh.EventHandler interface.
+// It fails with a not found error if there is no handler for the event tenant.
+func (r *TenantRouter) HandleEvent(ctx context.Context, event eh.Event) error {
+	tenant := GetEventTenant(event)
+	ctx = xcontext.WithTenant(ctx, tenant)
+
+	handler, err := r.handlerFor(ctx, tenant)
+	if err != nil {
+		return err
+	}
+
+	return handler.HandleEvent(ctx, event)
+}
+
+func (r *TenantRouter) handlerFor(ctx context.Context, tenant string) (eh.EventHandler, error) {
+	r.handlersLock.RLock()
+	handler, found := r.handlers[tenant]
+	r.handlersLock.RUnlock()
+
+	if found {
+		return handler, nil
+	}
+
+	if r.factory == nil {
+		return nil, xerrors.NewNotFoundError("tenant event handler", "%s for %s", r.handlerType, tenant)
+	}
+
+	r.handlersLock.Lock()
+	defer r.handlersLock.Unlock()
+
+	// Other event could have created it while waiting for the lock
+	if handler, found := r.handlers[tenant]; found {
+		return handler, nil
+	}
+
+	handler, err := r.factory(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	r.handlers[tenant] = handler
+
+	return handler, nil
+}
@@ -0,0 +1,73 @@
+package xeh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantRecordingHandler struct {
+	tenants []string
+}
+
+func (h *tenantRecordingHandler) HandlerType() eh.EventHandlerType { return "tenant-recording" }
+
+func (h *tenantRecordingHandler) HandleEvent(ctx context.Context, _ eh.Event) error {
+	tenant, _ := xcontext.GetTenant(ctx)
+	h.tenants = append(h.tenants, tenant)
+	return nil
+}
+
+func newTenantEvent(tenant string) eh.Event {
+	ctx := xcontext.WithTenant(context.Background(), tenant)
+	return eh.NewEvent("test-event", nil, time.Now(), eh.ForAggregate(testAggType, ids.New(), 1), WithTenant(ctx))
+}
+
+func TestMatchTenants_matches_events_of_the_tenants(t *testing.T) {
+	matcher := MatchTenants{"tenant-a", "tenant-b"}
+
+	require.True(t, matcher.Match(newTenantEvent("tenant-a")))
+	require.True(t, matcher.Match(newTenantEvent("tenant-b")))
+	require.False(t, matcher.Match(newTenantEvent("tenant-c")))
+	require.False(t, matcher.Match(nil))
+}
+
+func TestTenantRouter_dispatches_to_tenant_handler_with_tenant_in_context(t *testing.T) {
+	// GIVEN a router with a handler for a tenant and a factory for the others
+	added := &tenantRecordingHandler{}
+	created := map[string]*tenantRecordingHandler{}
+
+	router := NewTenantRouter("router", func(_ context.Context, tenant string) (eh.EventHandler, error) {
+		created[tenant] = &tenantRecordingHandler{}
+		return created[tenant], nil
+	})
+	router.AddHandler("tenant-a", added)
+
+	// WHEN events of several tenants are handled
+	require.NoError(t, router.HandleEvent(context.Background(), newTenantEvent("tenant-a")))
+	require.NoError(t, router.HandleEvent(context.Background(), newTenantEvent("tenant-b")))
+	require.NoError(t, router.HandleEvent(context.Background(), newTenantEvent("tenant-b")))
+
+	// THEN each event reaches the handler of its tenant, with the tenant in the context
+	require.Equal(t, []string{"tenant-a"}, added.tenants)
+	require.Len(t, created, 1)
+	require.Equal(t, []string{"tenant-b", "tenant-b"}, created["tenant-b"].tenants)
+}
+
+func TestTenantRouter_fails_without_handler_for_tenant(t *testing.T) {
+	// GIVEN a router without factory
+	router := NewTenantRouter("router", nil)
+	router.AddHandler("tenant-a", &tenantRecordingHandler{})
+
+	// WHEN an event of other tenant is handled
+	err := router.HandleEvent(context.Background(), newTenantEvent("tenant-b"))
+
+	// THEN a not found error is returned
+	require.ErrorIs(t, err, xerrors.ErrNotFound)
+}
@@ -0,0 +1,159 @@
+package xeh
+
+import (
+	"context"
+	"sort"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// QueryableReadRepo is a typed ReadRepo that can find and count the entities matching a filter.
+type QueryableReadRepo[Entity eh.Entity] interface {
+	ReadRepo[Entity]
+
+	// FindWhere returns the page of entities matching the filter, sorted by the sort options.
+	FindWhere(ctx context.Context, filter Filter, sort xpaging.SortOptions, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[Entity], error)
+
+	// Count returns the number of entities matching the filter.
+	Count(ctx context.Context, filter Filter) (int64, error)
+}
+
+// TypedReadRepo is a QueryableReadRepo wrapping any eh.ReadRepo.
+// Filters and sorts are applied in memory over all the entities, encoded as bson to find the fields.
+// Use MongoReadRepo for mongo repositories, to run the queries in the database.
+type TypedReadRepo[Entity eh.Entity] struct {
+	repo eh.ReadRepo
+}
+
+var _ QueryableReadRepo[eh.Entity] = (*TypedReadRepo[eh.Entity])(nil)
+
+// NewTypedReadRepo creates a new TypedReadRepo wrapping the repo
+func NewTypedReadRepo[Entity eh.Entity](repo eh.ReadRepo) *TypedReadRepo[Entity] {
+	xerrors.EnsureNotEmpty(repo, "repo")
+
+	return &TypedReadRepo[Entity]{repo: repo}
+}
+
+// InnerRepo implements the InnerRepo method of the ReadRepo interface.
+func (r *TypedReadRepo[Entity]) InnerRepo(context.Context) eh.ReadRepo {
+	return r.repo
+}
+
+// Find implements the Find method of the ReadRepo interface.
+func (r *TypedReadRepo[Entity]) Find(ctx context.Context, id uuid.UUID) (Entity, error) {
+	entity, err := r.repo.Find(ctx, id)
+	if err != nil {
+		var empty Entity
+		return empty, err
+	}
+
+	return castEntity[Entity](entity)
+}
+
+// FindAll implements the FindAll method of the ReadRepo interface.
+func (r *TypedReadRepo[Entity]) FindAll(ctx context.Context) ([]Entity, error) {
+	entities, err := r.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make([]Entity, 0, len(entities))
+	for _, entity := range entities {
+		t, err := castEntity[Entity](entity)
+		if err != nil {
+			return nil, err
+		}
+		typed = append(typed, t)
+	}
+
+	return typed, nil
+}
+
+// FindWhere implements the FindWhere method of the QueryableReadRepo interface.
+// Without sort options, entities are sorted by ID.
+func (r *TypedReadRepo[Entity]) FindWhere(ctx context.Context, filter Filter, sortOptions xpaging.SortOptions, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[Entity], error) {
+	paging = paging.Normalized()
+	response := xpaging.PaginatedResponse[Entity]{Items: []Entity{}, PagingOptions: paging}
+
+	matching, err := r.findMatching(ctx, filter)
+	if err != nil {
+		return response, err
+	}
+
+	if sortOptions.IsEmpty() {
+		sortOptions = xpaging.SortOptions{xpaging.NewSortEntry("_id", xpaging.DirectionAsc)}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		for _, entry := range sortOptions {
+			c := compareValues(fieldValue(matching[i].document, entry.FieldName), fieldValue(matching[j].document, entry.FieldName))
+			if c != 0 {
+				return c*int(entry.Direction) < 0
+			}
+		}
+		return false
+	})
+
+	response.Total = int64(len(matching))
+
+	for i := paging.Offset; i < response.Total && i < paging.Offset+paging.Limit; i++ {
+		response.Items = append(response.Items, matching[i].entity)
+	}
+
+	return response, nil
+}
+
+// Count implements the Count method of the QueryableReadRepo interface.
+func (r *TypedReadRepo[Entity]) Count(ctx context.Context, filter Filter) (int64, error) {
+	matching, err := r.findMatching(ctx, filter)
+	return int64(len(matching)), err
+}
+
+// Close implements the Close method of the ReadRepo interface.
+func (r *TypedReadRepo[Entity]) Close() error {
+	return r.repo.Close()
+}
+
+type encodedEntity[Entity eh.Entity] struct {
+	entity   Entity
+	document bson.M
+}
+
+func (r *TypedReadRepo[Entity]) findMatching(ctx context.Context, filter Filter) ([]encodedEntity[Entity], error) {
+	entities, err := r.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]encodedEntity[Entity], 0, len(entities))
+
+	for _, entity := range entities {
+		data, err := bson.Marshal(entity)
+		if err != nil {
+			return nil, err
+		}
+
+		var document bson.M
+		if err := bson.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+
+		if filter.matches(document) {
+			matching = append(matching, encodedEntity[Entity]{entity: entity, document: document})
+		}
+	}
+
+	return matching, nil
+}
+
+func castEntity[Entity eh.Entity](entity eh.Entity) (Entity, error) {
+	typed, ok := entity.(Entity)
+	if !ok {
+		return typed, xerrors.NewTypeAssertionError("entity", "%v is %T, not %T", entity.EntityID(), entity, typed)
+	}
+	return typed, nil
+}
@@ -0,0 +1,98 @@
+package xeh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type clientModel struct {
+	ID        uuid.UUID `bson:"_id"`
+	Name      string    `bson:"name"`
+	Country   string    `bson:"country"`
+	Score     int       `bson:"score"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+func (c *clientModel) EntityID() uuid.UUID { return c.ID }
+
+func newClientsRepo(clients ...*clientModel) *TypedReadRepo[*clientModel] {
+	entities := make([]eh.Entity, 0, len(clients))
+	for _, c := range clients {
+		entities = append(entities, c)
+	}
+
+	inner := &ehmocks.ReadRepoMock{}
+	inner.On("FindAll", mock.Anything).Return(entities, nil)
+
+	return NewTypedReadRepo[*clientModel](inner)
+}
+
+func newClient(name, country string, score int) *clientModel {
+	return &clientModel{ID: ids.New(), Name: name, Country: country, Score: score, CreatedAt: time.Now()}
+}
+
+func TestTypedReadRepo_FindWhere_filters_sorts_and_pages(t *testing.T) {
+	// GIVEN clients of several countries
+	ana, bob, carl, dan := newClient("ana", "AR", 10), newClient("bob", "AR", 30), newClient("carl", "AR", 20), newClient("dan", "UY", 40)
+	repo := newClientsRepo(ana, bob, carl, dan)
+
+	// WHEN the second page of argentinian clients is requested, by score descending
+	page, err := repo.FindWhere(
+		context.Background(),
+		Where(Eq("country", "AR"), Gte("score", 10)),
+		xpaging.SortOptions{xpaging.NewSortEntry("score", xpaging.DirectionDesc)},
+		xpaging.PagingOptions{Offset: 1, Limit: 1},
+	)
+
+	// THEN the page has the second client by score
+	require.NoError(t, err)
+	require.Equal(t, int64(3), page.Total)
+	require.Equal(t, []*clientModel{carl}, page.Items)
+}
+
+func TestTypedReadRepo_Count_with_in_filter(t *testing.T) {
+	// GIVEN clients of several countries
+	repo := newClientsRepo(newClient("ana", "AR", 10), newClient("bob", "UY", 30), newClient("carl", "CL", 20))
+
+	// WHEN the clients of two countries are counted
+	count, err := repo.Count(context.Background(), Where(In("country", "AR", "UY")))
+
+	// THEN they are counted
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
+
+func TestTypedReadRepo_Find_fails_with_other_entity_type(t *testing.T) {
+	// GIVEN a repo with an entity of other type
+	id := ids.New()
+	inner := &ehmocks.ReadRepoMock{}
+	inner.On("Find", mock.Anything, id).Return(&ehmocks.EntityFake{ID: id}, nil)
+
+	repo := NewTypedReadRepo[*clientModel](inner)
+
+	// WHEN it is found
+	_, err := repo.Find(context.Background(), id)
+
+	// THEN a type assertion error is returned
+	require.ErrorIs(t, err, xerrors.ErrTypeAssertion)
+}
+
+func TestFilter_ToMongo_groups_conditions_by_field(t *testing.T) {
+	filter := Where(Eq("country", "AR"), Gte("score", 10), Lt("score", 20))
+
+	require.Equal(t, bson.M{
+		"country": bson.M{"$eq": "AR"},
+		"score":   bson.M{"$gte": 10, "$lt": 20},
+	}, filter.ToMongo())
+}
@@ -0,0 +1,378 @@
+package xeh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SchemaVersionMetadataKey is the key of the event metadata with the schema version of the event data.
+// Events without it are in schema version 1.
+const SchemaVersionMetadataKey = "schema_version"
+
+// Upcaster transforms the raw data of an event from a schema version to the next one.
+// Values in data are the ones decoded from the stored format: BSON for the event store, JSON for other transports.
+type Upcaster func(data map[string]interface{}) (map[string]interface{}, error)
+
+// UpcasterRegistry transforms the data of the stored events from old schema versions into the current one.
+//
+// The event types registered here are registered in eventhorizon to load their data raw, so the upcasters can read
+// the old shapes. Do not register them with eh.RegisterEventData.
+//
+// As the data is loaded raw, the UpcastingEventStore is mandatory for every user of the event store: the aggregate
+// store of the write side, the EntityHealer, the ReadModelRegenerator and any other reader. Without it, they get
+// the events with the raw data instead of the current shape. It also stamps the current schema version in the saved
+// events. Use the UpcastingMiddleware for the handlers of events received from other transports.
+type UpcasterRegistry struct {
+	chains map[eh.EventType]*upcasterChain
+	lock   sync.RWMutex
+}
+
+type upcasterChain struct {
+	currentVersion int
+	factory        func() eh.EventData
+	upcasters      map[int]Upcaster // by the version they upcast from
+}
+
+// NewUpcasterRegistry creates a new empty UpcasterRegistry
+func NewUpcasterRegistry() *UpcasterRegistry {
+	return &UpcasterRegistry{chains: make(map[eh.EventType]*upcasterChain)}
+}
+
+// RegisterEventData registers the factory of the current schema version of the event data.
+func (r *UpcasterRegistry) RegisterEventData(eventType eh.EventType, currentVersion int, factory func() eh.EventData) {
+	xerrors.EnsureNotEmpty(factory, "factory")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, found := r.chains[eventType]; found {
+		panic(fmt.Sprintf("event data for %s already registered", eventType))
+	}
+
+	r.chains[eventType] = &upcasterChain{
+		currentVersion: currentVersion,
+		factory:        factory,
+		upcasters:      make(map[int]Upcaster),
+	}
+
+	eh.RegisterEventData(eventType, func() eh.EventData { return &rawEventData{} })
+}
+
+// RegisterUpcaster registers the upcaster of the event data from the given version to the next one.
+// The event data must be registered first.
+func (r *UpcasterRegistry) RegisterUpcaster(eventType eh.EventType, fromVersion int, upcaster Upcaster) {
+	xerrors.EnsureNotEmpty(upcaster, "upcaster")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	chain, found := r.chains[eventType]
+	if !found {
+		panic(fmt.Sprintf("event data for %s not registered", eventType))
+	}
+
+	chain.upcasters[fromVersion] = upcaster
+}
+
+// SchemaVersion returns the option to add the current schema version of the event type to a new event.
+func (r *UpcasterRegistry) SchemaVersion(eventType eh.EventType) eh.EventOption {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	version := 1
+	if chain, found := r.chains[eventType]; found {
+		version = chain.currentVersion
+	}
+
+	return eh.WithMetadata(map[string]interface{}{SchemaVersionMetadataKey: version})
+}
+
+// Validate checks that every registered event type has the upcasters from version 1 up to its current version.
+func (r *UpcasterRegistry) Validate() error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var missing []string
+
+	for eventType, chain := range r.chains {
+		for version := 1; version < chain.currentVersion; version++ {
+			if _, found := chain.upcasters[version]; !found {
+				missing = append(missing, fmt.Sprintf("%s v%d to v%d", eventType, version, version+1))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return xerrors.NewInvalidStateError("upcaster", "missing %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Upcast returns the event with its data transformed to the current schema version.
+// Events of types not registered, or already decoded, are returned unchanged.
+func (r *UpcasterRegistry) Upcast(event eh.Event) (eh.Event, error) {
+	raw, ok := event.Data().(*rawEventData)
+	if !ok {
+		return event, nil
+	}
+
+	r.lock.RLock()
+	chain, found := r.chains[event.EventType()]
+	r.lock.RUnlock()
+
+	if !found {
+		return nil, xerrors.NewNotFoundError("event data", "%s", event.EventType())
+	}
+
+	data, err := raw.decodeMap()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", event, err)
+	}
+
+	version := eventSchemaVersion(event)
+
+	for ; version < chain.currentVersion; version++ {
+		upcaster, found := chain.upcasters[version]
+		if !found {
+			return nil, xerrors.NewNotFoundError("upcaster", "%s v%d", event.EventType(), version)
+		}
+
+		if data, err = upcaster(data); err != nil {
+			return nil, fmt.Errorf("could not upcast %s from v%d: %w", event, version, err)
+		}
+	}
+
+	eventData := chain.factory()
+	if err := raw.encodeInto(data, eventData); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", event, err)
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata())+1)
+	for key, value := range event.Metadata() {
+		metadata[key] = value
+	}
+	metadata[SchemaVersionMetadataKey] = chain.currentVersion
+
+	return eh.NewEvent(
+		event.EventType(),
+		eventData,
+		event.Timestamp(),
+		eh.ForAggregate(event.AggregateType(), event.AggregateID(), event.Version()),
+		eh.WithMetadata(metadata),
+	), nil
+}
+
+// UpcastAll upcasts all the events
+func (r *UpcasterRegistry) UpcastAll(events []eh.Event) ([]eh.Event, error) {
+	upcasted := make([]eh.Event, 0, len(events))
+
+	for _, event := range events {
+		e, err := r.Upcast(event)
+		if err != nil {
+			return nil, err
+		}
+		upcasted = append(upcasted, e)
+	}
+
+	return upcasted, nil
+}
+
+func eventSchemaVersion(event eh.Event) int {
+	switch version := event.Metadata()[SchemaVersionMetadataKey].(type) {
+	case int:
+		return version
+	case int32:
+		return int(version)
+	case int64:
+		return int(version)
+	case float64:
+		return int(version)
+	default:
+		return 1
+	}
+}
+
+// rawEventData keeps the stored data of an event to upcast it
+type rawEventData struct {
+	bson []byte
+	json []byte
+}
+
+// UnmarshalBSON implements the bson.Unmarshaler interface
+func (d *rawEventData) UnmarshalBSON(data []byte) error {
+	d.bson = append([]byte(nil), data...)
+	return nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *rawEventData) UnmarshalJSON(data []byte) error {
+	d.json = append([]byte(nil), data...)
+	return nil
+}
+
+// MarshalBSON implements the bson.Marshaler interface, keeping the stored data when the event is stored again,
+// i.e. in an outbox or an event error record
+func (d *rawEventData) MarshalBSON() ([]byte, error) {
+	if d.bson != nil {
+		return d.bson, nil
+	}
+
+	data, err := d.decodeMap()
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(data)
+}
+
+// MarshalJSON implements the json.Marshaler interface, keeping the stored data when the event is sent to other
+// transport
+func (d *rawEventData) MarshalJSON() ([]byte, error) {
+	if d.json != nil {
+		return d.json, nil
+	}
+
+	data, err := d.decodeMap()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+func (d *rawEventData) decodeMap() (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	switch {
+	case d.bson != nil:
+		return data, bson.Unmarshal(d.bson, &data)
+	case d.json != nil:
+		return data, json.Unmarshal(d.json, &data)
+	default:
+		return data, nil
+	}
+}
+
+func (d *rawEventData) encodeInto(data map[string]interface{}, target eh.EventData) error {
+	if d.json != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(encoded, target)
+	}
+
+	encoded, err := bson.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(encoded, target)
+}
+
+// stampAll returns the events of the registered types with the current schema version in the metadata
+func (r *UpcasterRegistry) stampAll(events []eh.Event) []eh.Event {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	stamped := make([]eh.Event, 0, len(events))
+
+	for _, event := range events {
+		chain, found := r.chains[event.EventType()]
+		if !found || event.Metadata()[SchemaVersionMetadataKey] == chain.currentVersion {
+			stamped = append(stamped, event)
+			continue
+		}
+
+		metadata := make(map[string]interface{}, len(event.Metadata())+1)
+		for key, value := range event.Metadata() {
+			metadata[key] = value
+		}
+		metadata[SchemaVersionMetadataKey] = chain.currentVersion
+
+		stamped = append(stamped, eh.NewEvent(
+			event.EventType(),
+			event.Data(),
+			event.Timestamp(),
+			eh.ForAggregate(event.AggregateType(), event.AggregateID(), event.Version()),
+			eh.WithMetadata(metadata),
+		))
+	}
+
+	return stamped
+}
+
+// UpcastingEventStore is an eh.EventStore decorator that upcasts the loaded events, and stamps the current schema
+// version in the saved ones. See UpcasterRegistry.
+type UpcastingEventStore struct {
+	eh.EventStore
+	registry *UpcasterRegistry
+}
+
+var _ eh.EventStore = (*UpcastingEventStore)(nil)
+
+// NewUpcastingEventStore creates a new UpcastingEventStore decorating the event store
+func NewUpcastingEventStore(eventStore eh.EventStore, registry *UpcasterRegistry) *UpcastingEventStore {
+	xerrors.EnsureNotEmpty(eventStore, "eventStore")
+	xerrors.EnsureNotEmpty(registry, "registry")
+
+	return &UpcastingEventStore{EventStore: eventStore, registry: registry}
+}
+
+// Save implements the Save method of the eh.EventStore interface.
+// New events are in the current shape, so the current schema version of their type is added to the metadata, to not
+// upcast them when loaded.
+func (s *UpcastingEventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	return s.EventStore.Save(ctx, s.registry.stampAll(events), originalVersion)
+}
+
+// Load implements the Load method of the eh.EventStore interface.
+func (s *UpcastingEventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error) {
+	events, err := s.EventStore.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.registry.UpcastAll(events)
+}
+
+// LoadFrom implements the LoadFrom method of the eh.EventStore interface.
+func (s *UpcastingEventStore) LoadFrom(ctx context.Context, id uuid.UUID, version int) ([]eh.Event, error) {
+	events, err := s.EventStore.LoadFrom(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.registry.UpcastAll(events)
+}
+
+// UpcastingMiddleware returns a middleware that upcasts the events before sending them to the handlers.
+// Use it for handlers receiving events from transports that decode the stored data, like a remote event bus.
+func UpcastingMiddleware(registry *UpcasterRegistry) eh.EventHandlerMiddleware {
+	return func(handler eh.EventHandler) eh.EventHandler {
+		return &upcastingHandler{handler: handler, registry: registry}
+	}
+}
+
+type upcastingHandler struct {
+	handler  eh.EventHandler
+	registry *UpcasterRegistry
+}
+
+func (h *upcastingHandler) HandlerType() eh.EventHandlerType {
+	return h.handler.HandlerType()
+}
+
+func (h *upcastingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	upcasted, err := h.registry.Upcast(event)
+	if err != nil {
+		return err
+	}
+	return h.handler.HandleEvent(ctx, upcasted)
+}
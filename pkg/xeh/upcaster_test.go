@@ -0,0 +1,181 @@
+package xeh
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const clientCreatedEvent eh.EventType = "ClientCreated"
+
+// clientCreatedV3 is the current shape: v1 had "name", v2 split it in "first" and "last", v3 added "country"
+type clientCreatedV3 struct {
+	FirstName string `bson:"first" json:"first"`
+	LastName  string `bson:"last" json:"last"`
+	Country   string `bson:"country" json:"country"`
+}
+
+func newClientUpcasterRegistry(t *testing.T) *UpcasterRegistry {
+	registry := NewUpcasterRegistry()
+	t.Cleanup(func() { eh.UnregisterEventData(clientCreatedEvent) })
+
+	registry.RegisterEventData(clientCreatedEvent, 3, func() eh.EventData { return &clientCreatedV3{} })
+
+	registry.RegisterUpcaster(clientCreatedEvent, 1, func(data map[string]interface{}) (map[string]interface{}, error) {
+		first, last := splitName(data["name"].(string))
+		return map[string]interface{}{"first": first, "last": last}, nil
+	})
+	registry.RegisterUpcaster(clientCreatedEvent, 2, func(data map[string]interface{}) (map[string]interface{}, error) {
+		data["country"] = "AR"
+		return data, nil
+	})
+
+	return registry
+}
+
+func splitName(name string) (string, string) {
+	for i, c := range name {
+		if c == ' ' {
+			return name[:i], name[i+1:]
+		}
+	}
+	return name, ""
+}
+
+func newRawBsonEvent(t *testing.T, data interface{}, options ...eh.EventOption) eh.Event {
+	encoded, err := bson.Marshal(data)
+	require.NoError(t, err)
+
+	raw := &rawEventData{}
+	require.NoError(t, bson.Unmarshal(encoded, raw))
+
+	options = append(options, eh.ForAggregate(testAggType, ids.New(), 1))
+
+	return eh.NewEvent(clientCreatedEvent, raw, time.Now(), options...)
+}
+
+func TestUpcasterRegistry_upcasts_stored_data_to_current_version(t *testing.T) {
+	// GIVEN a registry with upcasters from v1 to v3
+	registry := newClientUpcasterRegistry(t)
+
+	// AND an event stored in v1
+	event := newRawBsonEvent(t, bson.M{"name": "John Doe"})
+
+	// WHEN it is upcasted
+	upcasted, err := registry.Upcast(event)
+
+	// THEN the data is in the current shape
+	require.NoError(t, err)
+	require.Equal(t, &clientCreatedV3{FirstName: "John", LastName: "Doe", Country: "AR"}, upcasted.Data())
+	require.Equal(t, 3, upcasted.Metadata()[SchemaVersionMetadataKey])
+	require.Equal(t, event.AggregateID(), upcasted.AggregateID())
+}
+
+func TestUpcasterRegistry_starts_from_stored_schema_version(t *testing.T) {
+	// GIVEN a registry with upcasters from v1 to v3
+	registry := newClientUpcasterRegistry(t)
+
+	// AND an event stored in v2
+	event := newRawBsonEvent(t, bson.M{"first": "John", "last": "Doe"}, eh.WithMetadata(map[string]interface{}{SchemaVersionMetadataKey: int32(2)}))
+
+	// WHEN it is upcasted
+	upcasted, err := registry.Upcast(event)
+
+	// THEN only the upcaster from v2 is applied
+	require.NoError(t, err)
+	require.Equal(t, &clientCreatedV3{FirstName: "John", LastName: "Doe", Country: "AR"}, upcasted.Data())
+}
+
+func TestUpcasterRegistry_upcasts_json_data(t *testing.T) {
+	// GIVEN a registry with upcasters from v1 to v3
+	registry := newClientUpcasterRegistry(t)
+
+	// AND an event in v1 decoded from JSON
+	raw := &rawEventData{}
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"John Doe"}`), raw))
+	event := eh.NewEvent(clientCreatedEvent, raw, time.Now(), eh.ForAggregate(testAggType, ids.New(), 1))
+
+	// WHEN it is upcasted
+	upcasted, err := registry.Upcast(event)
+
+	// THEN the data is in the current shape
+	require.NoError(t, err)
+	require.Equal(t, &clientCreatedV3{FirstName: "John", LastName: "Doe", Country: "AR"}, upcasted.Data())
+}
+
+func TestUpcasterRegistry_Validate_reports_missing_upcasters(t *testing.T) {
+	// GIVEN a registry missing the upcaster from v2 to v3
+	registry := NewUpcasterRegistry()
+	t.Cleanup(func() { eh.UnregisterEventData(clientCreatedEvent) })
+	registry.RegisterEventData(clientCreatedEvent, 3, func() eh.EventData { return &clientCreatedV3{} })
+	registry.RegisterUpcaster(clientCreatedEvent, 1, func(data map[string]interface{}) (map[string]interface{}, error) { return data, nil })
+
+	// WHEN it is validated
+	err := registry.Validate()
+
+	// THEN the missing upcaster is reported
+	require.ErrorIs(t, err, xerrors.ErrInvalidState)
+	require.Contains(t, err.Error(), "ClientCreated v2 to v3")
+}
+
+func TestUpcastingEventStore_upcasts_loaded_events(t *testing.T) {
+	// GIVEN an event store with an event stored in v1
+	event := newRawBsonEvent(t, bson.M{"name": "John Doe"})
+
+	eventStore := &ehmocks.EventStoreMock{}
+	eventStore.On("LoadFrom", context.Background(), event.AggregateID(), 1).Return([]eh.Event{event}, nil)
+
+	store := NewUpcastingEventStore(eventStore, newClientUpcasterRegistry(t))
+
+	// WHEN the events are loaded
+	events, err := store.LoadFrom(context.Background(), event.AggregateID(), 1)
+
+	// THEN they are upcasted
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, &clientCreatedV3{FirstName: "John", LastName: "Doe", Country: "AR"}, events[0].Data())
+}
+
+func TestUpcastingEventStore_stamps_the_current_schema_version_in_saved_events(t *testing.T) {
+	// GIVEN an event in the current shape created without schema version
+	event := eh.NewEvent(clientCreatedEvent, &clientCreatedV3{FirstName: "John"}, time.Now(), eh.ForAggregate(testAggType, ids.New(), 1))
+
+	var saved []eh.Event
+	eventStore := &ehmocks.EventStoreMock{}
+	eventStore.On("Save", context.Background(), mock.Anything, 0).Run(func(args mock.Arguments) {
+		saved = args.Get(1).([]eh.Event)
+	}).Return(nil)
+
+	store := NewUpcastingEventStore(eventStore, newClientUpcasterRegistry(t))
+
+	// WHEN it is saved
+	err := store.Save(context.Background(), []eh.Event{event}, 0)
+
+	// THEN it is saved with the current schema version, so it is not upcasted when loaded
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	require.Equal(t, 3, saved[0].Metadata()[SchemaVersionMetadataKey])
+	require.Equal(t, event.Data(), saved[0].Data())
+	require.Equal(t, event.AggregateID(), saved[0].AggregateID())
+}
+
+func TestRawEventData_keeps_the_stored_data_when_encoded_again(t *testing.T) {
+	// GIVEN an event loaded raw
+	event := newRawBsonEvent(t, bson.M{"name": "John Doe"})
+
+	// WHEN its data is encoded again, i.e. to store it in an outbox
+	encoded, err := bson.Marshal(event.Data())
+
+	// THEN the stored data is kept
+	require.NoError(t, err)
+	require.Equal(t, "John Doe", bson.Raw(encoded).Lookup("name").StringValue())
+}
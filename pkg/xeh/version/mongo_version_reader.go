@@ -0,0 +1,45 @@
+package version
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/looplab/eventhorizon/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoLatestVersionReader reads the latest version of the aggregates stored by the Event Horizon mongo event stores.
+// It reads the collection with one document per aggregate: "streams" for mongodb_v2 and "events" for mongodb.
+// Both keep the version of the last event of the aggregate in the version field of the document.
+type MongoLatestVersionReader struct {
+	collection *mongo.Collection
+}
+
+var _ LatestVersionReader = (*MongoLatestVersionReader)(nil)
+
+// NewMongoLatestVersionReader creates a new MongoLatestVersionReader reading the given database and collection.
+func NewMongoLatestVersionReader(client *mongo.Client, databaseName, collectionName string) *MongoLatestVersionReader {
+	return &MongoLatestVersionReader{
+		collection: client.Database(databaseName).Collection(collectionName),
+	}
+}
+
+// LatestVersion implements the LatestVersionReader interface.
+func (r *MongoLatestVersionReader) LatestVersion(ctx context.Context, id uuid.UUID) (int, error) {
+	var doc struct {
+		Version int `bson:"version"`
+	}
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"version": 1})).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, xmongo.ConvertMongoError(err, "aggregate", "%s", id)
+	}
+
+	return doc.Version, nil
+}
@@ -0,0 +1,57 @@
+//go:build integration
+
+package version
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect()
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+func TestMongoLatestVersionReader_reads_the_version_of_both_event_stores(t *testing.T) {
+	// GIVEN a mongodb_v2 stream and a mongodb aggregate in the same collection
+	ctx := context.Background()
+	collectionName := "aggregates-" + ids.New().String()
+	collection := mongoInMemory.Client().Database("test").Collection(collectionName)
+	t.Cleanup(func() { _ = collection.Drop(ctx) })
+
+	stream := ids.New()
+	aggregate := ids.New()
+	_, err := collection.InsertOne(ctx, bson.M{"_id": stream, "aggregate_type": "test", "position": 7, "version": 3})
+	require.NoError(t, err)
+	_, err = collection.InsertOne(ctx, bson.M{"_id": aggregate, "version": 2, "events": bson.A{
+		bson.M{"aggregate_type": "test", "version": 1},
+		bson.M{"aggregate_type": "test", "version": 2},
+	}})
+	require.NoError(t, err)
+
+	reader := NewMongoLatestVersionReader(mongoInMemory.Client(), "test", collectionName)
+
+	// WHEN their latest versions are read
+	streamVersion, err := reader.LatestVersion(ctx, stream)
+	require.NoError(t, err)
+	aggregateVersion, err := reader.LatestVersion(ctx, aggregate)
+	require.NoError(t, err)
+	missingVersion, err := reader.LatestVersion(ctx, ids.New())
+	require.NoError(t, err)
+
+	// THEN both are found, and missing aggregates have version 0
+	require.Equal(t, 3, streamVersion)
+	require.Equal(t, 2, aggregateVersion)
+	require.Equal(t, 0, missingVersion)
+}
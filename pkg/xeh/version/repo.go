@@ -2,7 +2,10 @@ package version
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/AltScore/gothic/v2/pkg/xeh"
 	"github.com/looplab/eventhorizon/repo/version"
 
 	eh "github.com/looplab/eventhorizon"
@@ -13,26 +16,113 @@ type EventStoreReader interface {
 	// LoadFrom loads all events from version for the aggregate id from the store.
 	LoadFrom(ctx context.Context, id uuid.UUID, version int) ([]eh.Event, error)
 }
+
+// LatestVersionReader returns the latest version of an aggregate without loading its events.
+// If the event store given to NewRepo implements it, it is used instead of loading the events.
+type LatestVersionReader interface {
+	// LatestVersion returns the version of the last event of the aggregate, or 0 if there are no events.
+	LatestVersion(ctx context.Context, id uuid.UUID) (int, error)
+}
+
 type MinVersionFunc = func(ctx context.Context, uuid2 uuid.UUID) (int, bool)
 
+// StalePolicy is what Find does when the read model does not reach the expected version in time
+type StalePolicy int
+
+const (
+	// WaitInInnerRepo passes the expected version to the inner repo, that waits for it until the deadline of the
+	// context, and returns its result. It is the default.
+	WaitInInnerRepo StalePolicy = iota
+	// FailOnStale waits up to the max wait, and returns a StaleReadError
+	FailOnStale
+	// ReturnStale waits up to the max wait, and returns the read model in the version found, if it exists
+	ReturnStale
+)
+
+const (
+	defaultMaxWait      = time.Second
+	defaultPollInterval = 50 * time.Millisecond
+)
+
 // Repo is a middleware that adds version checking to a read repository.
 type Repo struct {
 	eh.ReadWriteRepo
-	eventStore EventStoreReader
+	eventStore    EventStoreReader
+	versionReader LatestVersionReader
+	snapshots     xeh.SnapshotStore
+	maxWait       time.Duration
+	pollInterval  time.Duration
+	stalePolicy   StalePolicy
 }
 
 var _ eh.ReadRepo = (*Repo)(nil)
 
+// Option configures a Repo
+type Option func(*Repo)
+
 // NewRepo creates a new Repo.
-// Uses the supplied event store to find the min version number of a given stream/aggregate
-func NewRepo(repo eh.ReadWriteRepo, eventStore EventStoreReader) *Repo {
+// Uses the supplied event store to find the min version number of a given stream/aggregate.
+// By default, the inner repo waits for the read model to reach the version, see WaitInInnerRepo.
+// With the FailOnStale or ReturnStale policies, it waits up to 1 second, checking every 50 milliseconds.
+func NewRepo(repo eh.ReadWriteRepo, eventStore EventStoreReader, options ...Option) *Repo {
 	r := &Repo{
 		ReadWriteRepo: repo,
 		eventStore:    eventStore,
+		maxWait:       defaultMaxWait,
+		pollInterval:  defaultPollInterval,
+		stalePolicy:   WaitInInnerRepo,
 	}
+
+	if reader, ok := eventStore.(LatestVersionReader); ok {
+		r.versionReader = reader
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
 	return r
 }
 
+// WithSnapshots configures a snapshot store to skip the events already included in the latest snapshot
+// when looking for the min version number.
+func WithSnapshots(snapshots xeh.SnapshotStore) Option {
+	return func(r *Repo) {
+		r.snapshots = snapshots
+	}
+}
+
+// WithMaxWait sets how long Find waits for the read model to reach the expected version, with the FailOnStale and
+// ReturnStale policies. The wait is also limited by the deadline of the context.
+func WithMaxWait(maxWait time.Duration) Option {
+	return func(r *Repo) {
+		r.maxWait = maxWait
+	}
+}
+
+// WithPollInterval sets how often Find checks the read model version while waiting, with the FailOnStale and
+// ReturnStale policies.
+func WithPollInterval(interval time.Duration) Option {
+	return func(r *Repo) {
+		r.pollInterval = interval
+	}
+}
+
+// WithStalePolicy sets what Find does when the read model does not reach the expected version in time.
+func WithStalePolicy(policy StalePolicy) Option {
+	return func(r *Repo) {
+		r.stalePolicy = policy
+	}
+}
+
+// WithLatestVersionReader sets the reader used to get the latest version of the aggregates, instead of
+// loading their events from the event store.
+func WithLatestVersionReader(reader LatestVersionReader) Option {
+	return func(r *Repo) {
+		r.versionReader = reader
+	}
+}
+
 // InnerRepo implements the InnerRepo method of the eventhorizon.ReadRepo interface.
 func (r *Repo) InnerRepo(_ context.Context) eh.ReadRepo {
 	return r.ReadWriteRepo
@@ -53,10 +143,8 @@ func IntoRepo(ctx context.Context, repo eh.ReadRepo) *Repo {
 }
 
 // Find implements the Find method of the eventhorizon.ReadModel interface.
-// If the context contains a min version set by WithMinVersion it will only
-// return an item if its version is at least min version. If a timeout or
-// deadline is set on the context it will repeatedly try to get the item until
-// either the version matches or the deadline is reached.
+// It finds the current version of the aggregate in the event store, or uses the min version in the context set by
+// WithMinVersion if it is greater, and waits until the read model reaches that version as set by the stale policy.
 func (r *Repo) Find(ctx context.Context, id uuid.UUID) (eh.Entity, error) {
 	minVersion, ok := r.findMinVersionNumber(ctx, id)
 
@@ -64,16 +152,102 @@ func (r *Repo) Find(ctx context.Context, id uuid.UUID) (eh.Entity, error) {
 		return r.ReadWriteRepo.Find(ctx, id)
 	}
 
-	ctx, cancel := version.NewContextWithMinVersionWait(ctx, minVersion)
+	if r.stalePolicy == WaitInInnerRepo {
+		ctx, cancel := version.NewContextWithMinVersionWait(ctx, minVersion)
+		defer cancel()
+
+		return r.ReadWriteRepo.Find(ctx, id)
+	}
+
+	deadline := time.Now().Add(r.maxWait)
+
+	for {
+		entity, err := r.findVersion(ctx, id, minVersion)
+		if err == nil || !isNotUpToDate(err) {
+			return entity, err
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if !time.Now().Before(deadline) {
+			return r.staleRead(ctx, id, minVersion)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// findVersion finds the entity with at least the given version, failing if it is not found or is older.
+// The inner repo may wait for the version too, but no longer than the poll interval.
+func (r *Repo) findVersion(ctx context.Context, id uuid.UUID, minVersion int) (eh.Entity, error) {
+	ctx, cancel := context.WithTimeout(version.NewContextWithMinVersion(ctx, minVersion), r.pollInterval)
 	defer cancel()
 
-	return r.ReadWriteRepo.Find(ctx, id)
+	entity, err := r.ReadWriteRepo.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if versionable, ok := entity.(eh.Versionable); ok && versionable.AggregateVersion() < minVersion {
+		return nil, eh.ErrIncorrectEntityVersion
+	}
+
+	return entity, nil
+}
+
+// isNotUpToDate returns true if the error is because the entity was not found or is older than expected
+func isNotUpToDate(err error) bool {
+	return errors.Is(err, eh.ErrIncorrectEntityVersion) ||
+		errors.Is(err, eh.ErrEntityNotFound) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// staleRead applies the stale policy when the entity did not reach the version in time
+func (r *Repo) staleRead(ctx context.Context, id uuid.UUID, minVersion int) (eh.Entity, error) {
+	entity, err := r.ReadWriteRepo.Find(version.NewContextWithMinVersion(ctx, 0), id)
+	if err != nil && !errors.Is(err, eh.ErrEntityNotFound) {
+		return nil, err
+	}
+
+	if entity == nil {
+		return nil, &StaleReadError{AggregateID: id, MinVersion: minVersion}
+	}
+
+	versionable, ok := entity.(eh.Versionable)
+	if !ok || versionable.AggregateVersion() >= minVersion || r.stalePolicy == ReturnStale {
+		// Without version, it is up to date as soon as it exists, as in findVersion
+		return entity, nil
+	}
+
+	return nil, &StaleReadError{AggregateID: id, MinVersion: minVersion, Version: versionable.AggregateVersion()}
 }
 
 // findMinVersionNumber returns the min version number for the given aggregate as given by the event store
 func (r *Repo) findMinVersionNumber(ctx context.Context, id uuid.UUID) (int, bool) {
 	lastKnown, _ := version.MinVersionFromContext(ctx)
 
+	if snapshotVersion := r.snapshotVersion(ctx, id); snapshotVersion > lastKnown {
+		lastKnown = snapshotVersion
+	}
+
+	if r.versionReader != nil {
+		latest, err := r.versionReader.LatestVersion(ctx, id)
+		if err != nil {
+			return lastKnown, false
+		}
+
+		if latest > lastKnown {
+			lastKnown = latest
+		}
+		return lastKnown, true
+	}
+
 	events, err := r.eventStore.LoadFrom(ctx, id, lastKnown)
 
 	if err != nil {
@@ -90,3 +264,17 @@ func (r *Repo) findMinVersionNumber(ctx context.Context, id uuid.UUID) (int, boo
 
 	return lastKnown, true
 }
+
+// snapshotVersion returns the version of the latest snapshot of the aggregate, or 0 if there is none
+func (r *Repo) snapshotVersion(ctx context.Context, id uuid.UUID) int {
+	if r.snapshots == nil {
+		return 0
+	}
+
+	snapshot, err := r.snapshots.LoadSnapshot(ctx, id)
+	if err != nil || snapshot == nil {
+		return 0
+	}
+
+	return snapshot.Version
+}
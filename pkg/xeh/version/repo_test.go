@@ -2,7 +2,9 @@ package version
 
 import (
 	"context"
+	"github.com/AltScore/gothic/v2/pkg/xeh"
 	"github.com/AltScore/gothic/v2/pkg/xeh/ehmocks"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
 	"testing"
 	"time"
 
@@ -95,3 +97,148 @@ func (s *RepoTestSuite) Test_find_returns_error_if_underling_repo_returns_error(
 	// THEN the error is returned
 	s.Error(err)
 }
+
+func (s *RepoTestSuite) Test_uses_snapshot_version_as_starting_point() {
+	// GIVEN a snapshot at version 1
+	id := uuid.New()
+	snapshots := xeh.NewInMemorySnapshotStore()
+	s.NoError(snapshots.SaveSnapshot(context.TODO(), xeh.Snapshot{AggregateID: id, Version: 1}))
+
+	s.repo = NewRepo(s.inner, s.eventStore, WithSnapshots(snapshots))
+
+	s.inner.On("Find", mock.Anything, id).Return(&ehmocks.EntityFake{ID: id}, nil)
+	s.eventStore.On("LoadFrom", mock.Anything, id, 1).Return([]eh.Event{s.ev1, s.ev2}, nil)
+
+	// WHEN we call find
+	_, _ = s.repo.Find(context.TODO(), id)
+
+	// THEN the event store is called from the snapshot version
+	s.eventStore.AssertCalled(s.T(), "LoadFrom", mock.Anything, id, 1)
+}
+
+type latestVersionReaderFake map[uuid.UUID]int
+
+func (f latestVersionReaderFake) LatestVersion(_ context.Context, id uuid.UUID) (int, error) {
+	return f[id], nil
+}
+
+func newVersionedEntity(id uuid.UUID, version int) *ehmocks.VersionedEntityMock {
+	entity := &ehmocks.VersionedEntityMock{}
+	entity.On("EntityID").Return(id)
+	entity.On("AggregateVersion").Return(version)
+	return entity
+}
+
+func (s *RepoTestSuite) Test_uses_latest_version_reader_instead_of_loading_events() {
+	// GIVEN a reader with the latest version of the aggregate
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore, WithLatestVersionReader(latestVersionReaderFake{id: 2}))
+
+	s.inner.On("Find", mock.Anything, id).Return(newVersionedEntity(id, 2), nil)
+
+	// WHEN we call find
+	_, err := s.repo.Find(context.TODO(), id)
+
+	// THEN the entity is found without loading the events
+	s.NoError(err)
+	s.eventStore.AssertNotCalled(s.T(), "LoadFrom", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *RepoTestSuite) Test_waits_until_read_model_reaches_the_version() {
+	// GIVEN a read model that is updated to the last version after the first find
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore, WithLatestVersionReader(latestVersionReaderFake{id: 2}), WithPollInterval(time.Millisecond), WithStalePolicy(FailOnStale))
+
+	s.inner.On("Find", mock.Anything, id).Return(newVersionedEntity(id, 1), nil).Once()
+	s.inner.On("Find", mock.Anything, id).Return(newVersionedEntity(id, 2), nil)
+
+	// WHEN we call find
+	e, err := s.repo.Find(context.TODO(), id)
+
+	// THEN the updated entity is returned
+	s.NoError(err)
+	s.Equal(2, e.(eh.Versionable).AggregateVersion())
+}
+
+func (s *RepoTestSuite) Test_fails_with_stale_read_error_after_max_wait() {
+	// GIVEN a read model that stays in an old version
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore, WithLatestVersionReader(latestVersionReaderFake{id: 2}), WithMaxWait(10*time.Millisecond), WithPollInterval(time.Millisecond), WithStalePolicy(FailOnStale))
+
+	s.inner.On("Find", mock.Anything, id).Return(newVersionedEntity(id, 1), nil)
+
+	// WHEN we call find
+	_, err := s.repo.Find(context.TODO(), id)
+
+	// THEN a stale read error is returned
+	var staleErr *StaleReadError
+	s.ErrorAs(err, &staleErr)
+	s.Equal(2, staleErr.MinVersion)
+	s.Equal(1, staleErr.Version)
+	s.ErrorIs(err, xerrors.ErrStaleRead)
+}
+
+func (s *RepoTestSuite) Test_returns_stale_read_model_when_configured() {
+	// GIVEN a read model that stays in an old version, and a repo returning stale read models
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore,
+		WithLatestVersionReader(latestVersionReaderFake{id: 2}),
+		WithMaxWait(10*time.Millisecond),
+		WithPollInterval(time.Millisecond),
+		WithStalePolicy(ReturnStale),
+	)
+
+	s.inner.On("Find", mock.Anything, id).Return(newVersionedEntity(id, 1), nil)
+
+	// WHEN we call find
+	e, err := s.repo.Find(context.TODO(), id)
+
+	// THEN the old read model is returned
+	s.NoError(err)
+	s.Equal(1, e.(eh.Versionable).AggregateVersion())
+}
+
+func (s *RepoTestSuite) Test_stale_read_error_is_unavailable_when_read_model_does_not_exist() {
+	// GIVEN a read model not projected yet
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore, WithLatestVersionReader(latestVersionReaderFake{id: 1}), WithMaxWait(10*time.Millisecond), WithPollInterval(time.Millisecond), WithStalePolicy(FailOnStale))
+
+	s.inner.On("Find", mock.Anything, id).Return(nil, &eh.RepoError{Err: eh.ErrEntityNotFound})
+
+	// WHEN we call find
+	_, err := s.repo.Find(context.TODO(), id)
+
+	// THEN the error maps to service unavailable
+	s.ErrorIs(err, xerrors.ErrUnavailable)
+}
+
+func (s *RepoTestSuite) Test_returns_the_inner_repo_result_by_default() {
+	// GIVEN a read model that stays in an old version, and an inner repo failing to find the version
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore, WithLatestVersionReader(latestVersionReaderFake{id: 2}))
+
+	s.inner.On("Find", mock.Anything, id).Return(nil, eh.ErrIncorrectEntityVersion).Once()
+
+	// WHEN we call find
+	_, err := s.repo.Find(context.TODO(), id)
+
+	// THEN the inner repo is called once, and its error is returned
+	s.ErrorIs(err, eh.ErrIncorrectEntityVersion)
+	s.inner.AssertNumberOfCalls(s.T(), "Find", 1)
+}
+
+func (s *RepoTestSuite) Test_returns_read_model_without_version_found_after_max_wait() {
+	// GIVEN a read model without version projected after the last poll
+	id := uuid.New()
+	s.repo = NewRepo(s.inner, s.eventStore, WithLatestVersionReader(latestVersionReaderFake{id: 1}), WithMaxWait(0), WithStalePolicy(FailOnStale))
+
+	s.inner.On("Find", mock.Anything, id).Return(nil, &eh.RepoError{Err: eh.ErrEntityNotFound}).Once()
+	s.inner.On("Find", mock.Anything, id).Return(&ehmocks.EntityFake{ID: id}, nil)
+
+	// WHEN we call find
+	e, err := s.repo.Find(context.TODO(), id)
+
+	// THEN it is returned, as it cannot be older than expected
+	s.NoError(err)
+	s.Equal(&ehmocks.EntityFake{ID: id}, e)
+}
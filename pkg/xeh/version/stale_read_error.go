@@ -0,0 +1,32 @@
+package version
+
+import (
+	"fmt"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/looplab/eventhorizon/uuid"
+)
+
+// StaleReadError is returned when the read model does not reach the expected version in time.
+// It maps to HTTP 409 Conflict if the read model exists in an older version, or to 503 Service Unavailable if it
+// was not projected yet.
+type StaleReadError struct {
+	AggregateID uuid.UUID
+	MinVersion  int // The version expected
+	Version     int // The version found, 0 if the read model was not found
+}
+
+func (e *StaleReadError) Error() string {
+	if e.Version == 0 {
+		return fmt.Sprintf("read model %s not found, expected version %d", e.AggregateID, e.MinVersion)
+	}
+	return fmt.Sprintf("read model %s is in version %d, expected version %d", e.AggregateID, e.Version, e.MinVersion)
+}
+
+// Unwrap returns xerrors.ErrUnavailable if the read model was not found, or xerrors.ErrStaleRead if it is old.
+func (e *StaleReadError) Unwrap() error {
+	if e.Version == 0 {
+		return xerrors.ErrUnavailable
+	}
+	return xerrors.ErrStaleRead
+}
@@ -10,6 +10,7 @@ type HttpError struct {
 	code       string
 	msg        string
 	httpStatus int
+	retriable  bool
 }
 
 func New(code string, msg string, httpStatus int) error {
@@ -20,6 +21,16 @@ func New(code string, msg string, httpStatus int) error {
 	}
 }
 
+// NewRetriable creates an error kind for failures that could succeed if the operation is retried
+func NewRetriable(code string, msg string, httpStatus int) error {
+	return HttpError{
+		code:       code,
+		msg:        msg,
+		httpStatus: httpStatus,
+		retriable:  true,
+	}
+}
+
 func (e HttpError) Code() string {
 	return e.code
 }
@@ -32,6 +43,11 @@ func (e HttpError) HTTPStatus() int {
 	return e.httpStatus
 }
 
+// IsRetriable returns true if the operation failing with this error can be retried
+func (e HttpError) IsRetriable() bool {
+	return e.retriable
+}
+
 func (e HttpError) Unwrap() error {
 	return nil
 }
@@ -51,6 +67,11 @@ var (
 	ErrForbidden        = New("forbidden", "user is not allowed to perform operation", http.StatusForbidden) // Not enough permissions
 	ErrInvalidEventType = New("invalid-event-type", "invalid event type", http.StatusInternalServerError)
 	ErrConditionNotMet  = New("condition-not-met", "condition not met", http.StatusPreconditionFailed)
+	ErrStaleRead        = New("stale-read", "data is not up to date", http.StatusConflict)
+	ErrUnavailable      = New("unavailable", "service unavailable", http.StatusServiceUnavailable)
+
+	ErrWriteConflict        = NewRetriable("write-conflict", "write conflict", http.StatusConflict)                               // Concurrent write of the same document
+	ErrTransientTransaction = NewRetriable("transient-transaction", "transient transaction error", http.StatusServiceUnavailable) // The whole transaction can be retried
 )
 
 func FromHttpStatus(status int) error {
@@ -71,6 +92,8 @@ func FromHttpStatus(status int) error {
 		return ErrForbidden
 	case http.StatusGatewayTimeout:
 		return ErrTimeout
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
 	default:
 		return ErrUnknown
 	}
@@ -128,6 +151,18 @@ func NewForbiddenError(entity string, keyFmt string, args ...interface{}) error
 	return fmt.Errorf("%w: %s: %s", ErrForbidden, entity, fmt.Sprintf(keyFmt, args...))
 }
 
+func NewUnavailableError(entity string, details string, keyFmt string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s: %s", ErrUnavailable, entity, fmt.Sprintf(keyFmt, args...), details)
+}
+
+func NewWriteConflictError(entity string, keyFmt string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s", ErrWriteConflict, entity, fmt.Sprintf(keyFmt, args...))
+}
+
+func NewTransientTransactionError(entity string, details string, keyFmt string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s: %s", ErrTransientTransaction, entity, fmt.Sprintf(keyFmt, args...), details)
+}
+
 func NewUnauthorized(keyFmt string, args ...interface{}) error {
 	return fmt.Errorf("%w: %s", ErrUnauthorized, fmt.Sprintf(keyFmt, args...))
 }
@@ -139,3 +174,9 @@ func IsNotFound(err error) bool {
 
 	return errors.Is(err, ErrNotFound)
 }
+
+// IsRetriable returns true if the error, or any error it wraps, is a retriable error kind
+func IsRetriable(err error) bool {
+	var httpError HttpError
+	return errors.As(err, &httpError) && httpError.IsRetriable()
+}
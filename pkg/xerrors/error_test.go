@@ -34,3 +34,39 @@ func TestIsNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "write conflict",
+			err:  NewWriteConflictError("entity", "keyFmt %s", "args"),
+			want: true,
+		},
+		{
+			name: "transient transaction",
+			err:  NewTransientTransactionError("entity", "details", "keyFmt %s", "args"),
+			want: true,
+		},
+		{
+			name: "other error",
+			err:  NewConditionNotMetError("entity", "keyFmt %s", "args"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetriable(tt.err); got != tt.want {
+				t.Errorf("IsRetriable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package xhttpserver
+
+import "context"
+
+// HealthCheck reports the health of a subsystem in the /health endpoint of the SystemModule
+type HealthCheck interface {
+	CheckHealth(ctx context.Context) HealthReport
+}
+
+// HealthReport is the health of a subsystem
+type HealthReport struct {
+	Name    string      `json:"name"`
+	Healthy bool        `json:"healthy"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// NewHealthCheck creates a HealthCheck with the given name from a function returning if the subsystem is healthy, and
+// the details to report. It allows other packages to report their health without depending on xhttpserver.
+func NewHealthCheck(name string, check func(ctx context.Context) (bool, interface{})) HealthCheck {
+	return healthCheckFunc{name: name, check: check}
+}
+
+type healthCheckFunc struct {
+	name  string
+	check func(ctx context.Context) (bool, interface{})
+}
+
+func (f healthCheckFunc) CheckHealth(ctx context.Context) HealthReport {
+	healthy, details := f.check(ctx)
+
+	return HealthReport{
+		Name:    f.name,
+		Healthy: healthy,
+		Details: details,
+	}
+}
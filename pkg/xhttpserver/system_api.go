@@ -11,8 +11,9 @@ import (
 )
 
 type SystemModule struct {
-	version string
-	commit  string
+	version      string
+	commit       string
+	healthChecks []HealthCheck
 }
 
 func NewSystemApi(logger *zap.Logger, version string, commit string) *SystemModule {
@@ -23,17 +24,43 @@ func NewSystemApi(logger *zap.Logger, version string, commit string) *SystemModu
 	}
 }
 
+// AddHealthCheck adds a check to the /health endpoint.
+// If any check is not healthy, the endpoint responds with status 503 Service Unavailable.
+func (s *SystemModule) AddHealthCheck(check HealthCheck) {
+	s.healthChecks = append(s.healthChecks, check)
+}
+
 func (s *SystemModule) RegisterHandlers(router xopenapi.EchoRouter) {
 	router.GET("/health", s.health)
 	router.GET("/routes", s.routes)
 }
 
 func (s *SystemModule) health(c echo.Context) error {
-	return c.JSON(200, map[string]string{
+	response := map[string]interface{}{
 		"version": s.version,
 		"commit":  s.commit,
 		"status:": "OK",
-	})
+	}
+
+	if len(s.healthChecks) == 0 {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	code := http.StatusOK
+	reports := make([]HealthReport, 0, len(s.healthChecks))
+
+	for _, check := range s.healthChecks {
+		report := check.CheckHealth(c.Request().Context())
+		if !report.Healthy {
+			code = http.StatusServiceUnavailable
+			response["status:"] = "UNHEALTHY"
+		}
+		reports = append(reports, report)
+	}
+
+	response["checks"] = reports
+
+	return c.JSON(code, response)
 }
 
 func (s *SystemModule) routes(c echo.Context) error {
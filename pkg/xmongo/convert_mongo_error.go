@@ -1,55 +1,105 @@
 package xmongo
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/AltScore/gothic/v2/pkg/xerrors"
 	"regexp"
 	"strings"
 
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
 )
 
+// Server error codes and labels, see https://www.mongodb.com/docs/manual/reference/error-codes/
+const (
+	codeWriteConflict = 112
+
+	labelTransientTransaction     = "TransientTransactionError"
+	labelUnknownTransactionCommit = "UnknownTransactionCommitResult"
+)
+
+// DuplicateKeyError is the error returned by ConvertMongoError for duplicate key errors, with the violated index
+// and the duplicated key. It wraps a xerrors.ErrDuplicate error.
+type DuplicateKeyError struct {
+	err        error
+	Collection string // The collection of the index, empty if unknown
+	Index      string // The name of the unique index, empty if unknown
+	Key        bson.M // The duplicated key by field, nil if the server does not report it
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.err
+}
+
+// ConvertMongoError converts an error returned by the mongo driver to a xerrors error of the entity with the key.
+// It classifies the errors by the server error codes and labels and the driver errors:
+//   - mongo.ErrNoDocuments is a not found error
+//   - "invalid key" errors are not found errors, and "wants one but found many" errors are found many errors
+//   - duplicate key errors are DuplicateKeyError wrapping a duplicate error
+//   - write conflicts are retriable write conflict errors
+//   - errors labeled as transient transaction or unknown commit result are retriable transient transaction errors
+//   - timeouts are timeout errors, and cancellations are cancellation errors
+//   - network errors are unavailable errors
+//
+// Other errors are unknown errors.
 func ConvertMongoError(err error, entity string, keyFmt string, args ...interface{}) error {
 	if err == nil {
 		return nil
 	}
 
-	message := err.Error()
-	if strings.Contains(message, "not found") {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
 		return xerrors.NewNotFoundError(entity, keyFmt, args...)
-	}
 
-	if strings.Contains(message, "no documents in result") {
+	case strings.Contains(err.Error(), "invalid key"):
+		logUnexpectedError(err)
 		return xerrors.NewNotFoundError(entity, keyFmt, args...)
-	}
 
-	if strings.Contains(message, "duplicate key") {
+	case strings.Contains(err.Error(), "wants one but found many"):
 		logUnexpectedError(err)
+		return xerrors.NewFoundManyError(entity, keyFmt, args...)
+
+	case mongo.IsDuplicateKeyError(err):
 		return convertDuplicateKey(err, entity, keyFmt, args...)
-	}
 
-	if strings.Contains(message, "invalid key") {
-		logUnexpectedError(err)
-		return xerrors.NewNotFoundError(entity, keyFmt, args...)
-	}
+	case hasErrorLabel(err, labelTransientTransaction) || hasErrorLabel(err, labelUnknownTransactionCommit):
+		return xerrors.NewTransientTransactionError(entity, cleanMongoErrorMessage(err), keyFmt, args...)
 
-	if strings.Contains(message, "wants one but found many") {
-		logUnexpectedError(err)
-		return xerrors.NewFoundManyError(entity, keyFmt, args...)
-	}
+	case hasErrorCode(err, codeWriteConflict):
+		return xerrors.NewWriteConflictError(entity, keyFmt, args...)
+
+	case errors.Is(err, context.Canceled):
+		return xerrors.NewCancellationError(entity, keyFmt, args...)
 
-	if strings.Contains(message, "context deadline exceeded") {
+	case mongo.IsTimeout(err):
 		return xerrors.NewTimeoutError(entity, keyFmt, args...)
-	}
 
-	if strings.Contains(message, "context canceled") {
-		return xerrors.NewCancellationError(entity, keyFmt, args...)
+	case mongo.IsNetworkError(err):
+		logUnexpectedError(err)
+		return xerrors.NewUnavailableError(entity, cleanMongoErrorMessage(err), keyFmt, args...)
 	}
 
 	logUnexpectedError(err)
 	return xerrors.NewUnknownError(entity, cleanMongoErrorMessage(err), keyFmt, args...)
 }
 
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
+func hasErrorCode(err error, code int) bool {
+	var serverError mongo.ServerError
+	return errors.As(err, &serverError) && serverError.HasErrorCode(code)
+}
+
 func logUnexpectedError(err error) {
 	zap.L().Error("unexpected mongo error", zap.Error(err))
 }
@@ -58,20 +108,61 @@ func cleanMongoErrorMessage(err error) string {
 	return strings.ReplaceAll(err.Error(), "mongo: ", "")
 }
 
-var duplicateMsgRegex = regexp.MustCompile(`duplicate key error collection: (\w+)\.(\w+) index: (\w+) dup key: \{ ([^}]+) }`)
+var duplicateMsgRegex = regexp.MustCompile(`collection: (\w+)\.(\S+) index: (\S+) dup key: \{ ([^}]+) }`)
 
 func convertDuplicateKey(err error, entity string, keyFmt string, args ...interface{}) error {
 	// Sample error format
 	// E11000 duplicate key error collection: credits_staging.clients index: partnerId_externalId_index dup key: { partnerId: "62d6c5b7bfc4940dc844c610", externalId: "charly-id-000001" }
 
-	matches := duplicateMsgRegex.FindStringSubmatch(err.Error())
+	message, raw := duplicateKeyServerError(err)
+
+	duplicate := &DuplicateKeyError{}
 
 	var details string
-	if len(matches) < 5 {
+	if matches := duplicateMsgRegex.FindStringSubmatch(message); len(matches) < 5 {
 		details = err.Error()
 	} else {
+		duplicate.Collection = matches[2]
+		duplicate.Index = matches[3]
 		details = fmt.Sprintf("duplicate key %s on %s", strings.ReplaceAll(matches[4], `"`, "'"), matches[2])
 	}
 
-	return xerrors.NewDuplicateError(entity, details, keyFmt, args...)
+	if keyValue, ok := raw.Lookup("keyValue").DocumentOK(); ok {
+		duplicate.Key = bson.M{}
+		if err := bson.Unmarshal(keyValue, &duplicate.Key); err != nil {
+			duplicate.Key = nil
+		}
+	}
+
+	duplicate.err = xerrors.NewDuplicateError(entity, details, keyFmt, args...)
+
+	return duplicate
+}
+
+// duplicateKeyServerError returns the message and the raw server document of the duplicate key error
+func duplicateKeyServerError(err error) (string, bson.Raw) {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeError := range writeException.WriteErrors {
+			if mongo.IsDuplicateKeyError(writeError) {
+				return writeError.Message, writeError.Raw
+			}
+		}
+	}
+
+	var bulkWriteException mongo.BulkWriteException
+	if errors.As(err, &bulkWriteException) {
+		for _, writeError := range bulkWriteException.WriteErrors {
+			if mongo.IsDuplicateKeyError(writeError.WriteError) {
+				return writeError.Message, writeError.Raw
+			}
+		}
+	}
+
+	var commandError mongo.CommandError
+	if errors.As(err, &commandError) {
+		return commandError.Message, commandError.Raw
+	}
+
+	return err.Error(), nil
 }
@@ -0,0 +1,130 @@
+package xmongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const duplicateMessage = `E11000 duplicate key error collection: credits.clients index: partnerId_externalId_index dup key: { partnerId: "p-1", externalId: "e-1" }`
+
+func TestConvertMongoError_classifies_by_driver_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		want      error
+		retriable bool
+	}{
+		{
+			name: "no documents",
+			err:  mongo.ErrNoDocuments,
+			want: xerrors.ErrNotFound,
+		},
+		{
+			name: "invalid key",
+			err:  errors.New("invalid key: not-an-id"),
+			want: xerrors.ErrNotFound,
+		},
+		{
+			name: "found many",
+			err:  errors.New("find one: wants one but found many"),
+			want: xerrors.ErrFoundMany,
+		},
+		{
+			name: "duplicate key in command",
+			err:  mongo.CommandError{Code: 11000, Message: duplicateMessage},
+			want: xerrors.ErrDuplicate,
+		},
+		{
+			name:      "write conflict",
+			err:       mongo.CommandError{Code: 112, Name: "WriteConflict"},
+			want:      xerrors.ErrWriteConflict,
+			retriable: true,
+		},
+		{
+			name:      "transient transaction",
+			err:       mongo.CommandError{Code: 251, Labels: []string{"TransientTransactionError"}},
+			want:      xerrors.ErrTransientTransaction,
+			retriable: true,
+		},
+		{
+			name:      "unknown commit result",
+			err:       mongo.WriteException{Labels: []string{"UnknownTransactionCommitResult"}},
+			want:      xerrors.ErrTransientTransaction,
+			retriable: true,
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("finding: %w", context.DeadlineExceeded),
+			want: xerrors.ErrTimeout,
+		},
+		{
+			name: "canceled",
+			err:  fmt.Errorf("finding: %w", context.Canceled),
+			want: xerrors.ErrClientCanceled,
+		},
+		{
+			name: "network error",
+			err:  mongo.CommandError{Labels: []string{"NetworkError"}, Message: "connection reset"},
+			want: xerrors.ErrUnavailable,
+		},
+		{
+			name: "message not classified by content",
+			err:  errors.New("user not found in cache"),
+			want: xerrors.ErrUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ConvertMongoError(tt.err, "client", "%s", "an-id")
+
+			require.ErrorIs(t, err, tt.want)
+			require.Equal(t, tt.retriable, xerrors.IsRetriable(err))
+		})
+	}
+}
+
+func TestConvertMongoError_returns_duplicate_index_and_key(t *testing.T) {
+	// GIVEN a duplicate key write error reporting the key value
+	raw, err := bson.Marshal(bson.D{
+		{Key: "code", Value: 11000},
+		{Key: "keyValue", Value: bson.D{{Key: "partnerId", Value: "p-1"}, {Key: "externalId", Value: "e-1"}}},
+	})
+	require.NoError(t, err)
+
+	writeErr := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: duplicateMessage, Raw: raw}}}
+
+	// WHEN it is converted
+	converted := ConvertMongoError(writeErr, "client", "%s", "an-id")
+
+	// THEN the index and key are returned
+	var duplicate *DuplicateKeyError
+	require.ErrorAs(t, converted, &duplicate)
+	require.Equal(t, "clients", duplicate.Collection)
+	require.Equal(t, "partnerId_externalId_index", duplicate.Index)
+	require.Equal(t, bson.M{"partnerId": "p-1", "externalId": "e-1"}, duplicate.Key)
+
+	// AND it is a duplicate error with the key in the message
+	require.ErrorIs(t, converted, xerrors.ErrDuplicate)
+	require.Contains(t, converted.Error(), "duplicate key partnerId: 'p-1', externalId: 'e-1' on clients")
+}
+
+func TestConvertMongoError_duplicate_without_details(t *testing.T) {
+	// GIVEN a duplicate key error without the standard message
+	writeErr := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000"}}}
+
+	// WHEN it is converted
+	converted := ConvertMongoError(writeErr, "client", "%s", "an-id")
+
+	// THEN it is a duplicate error without index or key
+	var duplicate *DuplicateKeyError
+	require.ErrorAs(t, converted, &duplicate)
+	require.Empty(t, duplicate.Index)
+	require.Nil(t, duplicate.Key)
+}
@@ -0,0 +1,294 @@
+package xmongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// cursorPosition is the payload of a cursor token: the values of the sort keys of the first or last item of a page
+type cursorPosition struct {
+	Sort     string          `bson:"s"` // The sort of the listing, a cursor is only valid for the same sort
+	Values   []bson.RawValue `bson:"v"` // The values of the sort keys, in the order of the sort
+	Backward bool            `bson:"b"` // True if the page is before the position, for the PrevCursor
+}
+
+// KeysetQuery is the query of a page of a keyset paginated listing.
+// Instead of skipping the items of the previous pages, the filter selects the items after the values of the sort
+// keys in the cursor, so the cost of a page does not grow with its position and no count is needed.
+//
+// The sort always ends with _id, to have a unique position for each item.
+type KeysetQuery struct {
+	Filter bson.D // The filter of the listing, restricted to the items after (or before) the cursor
+	Sort   bson.D // The sort of the listing, reversed to read the items before the cursor
+	Limit  int64  // One more than the page size, to know if there are more items
+
+	signer   *xpaging.CursorSigner
+	sort     xpaging.SortOptions
+	backward bool
+	first    bool
+}
+
+// NewKeysetQuery builds the query of the page of the listing after the cursor in the options, or the first page if
+// it has no cursor. Returns an invalid argument error if the cursor is invalid, or it was created for other sort.
+func NewKeysetQuery(signer *xpaging.CursorSigner, filter interface{}, sort xpaging.SortOptions, cursorOptions xpaging.CursorOptions) (KeysetQuery, error) {
+	xerrors.EnsureNotEmpty(signer, "signer")
+
+	cursorOptions = cursorOptions.Normalized()
+	sort = withIdSort(sort)
+
+	query := KeysetQuery{
+		Filter: bson.D{},
+		Sort:   ConvertSortOptionsToMongo(idField, xpaging.DirectionAsc, sort),
+		Limit:  cursorOptions.Limit + 1,
+		signer: signer,
+		sort:   sort,
+		first:  cursorOptions.Cursor == "",
+	}
+
+	if filter != nil {
+		query.Filter = append(query.Filter, bson.E{Key: "$and", Value: bson.A{filter}})
+	}
+
+	if query.first {
+		return query, nil
+	}
+
+	position, err := query.decode(cursorOptions.Cursor)
+	if err != nil {
+		return query, err
+	}
+
+	query.backward = position.Backward
+	if query.backward {
+		query.Sort = ConvertSortOptionsToMongo(idField, xpaging.DirectionAsc, reversed(sort))
+	}
+
+	query.Filter = append(query.Filter, bson.E{Key: "$or", Value: rangeFilter(sort, position.Values, query.backward)})
+
+	return query, nil
+}
+
+// FindOptions returns the options to find the items of the page
+func (q KeysetQuery) FindOptions() *options.FindOptions {
+	return options.Find().SetSort(q.Sort).SetLimit(q.Limit)
+}
+
+// Page returns the items of the page and the cursors to the next and previous pages, from the items found with
+// the query, in the order returned by mongo.
+func (q KeysetQuery) Page(found []bson.Raw) (items []bson.Raw, nextCursor string, prevCursor string, err error) {
+	items = pageItems(q, found)
+
+	if len(items) == 0 {
+		return items, "", "", nil
+	}
+
+	more := int64(len(found)) == q.Limit
+
+	// The page before the cursor always has a next page, and the page after it a previous one
+	hasNext := more || q.backward
+	hasPrev := (more && q.backward) || (!q.backward && !q.first)
+
+	if hasNext {
+		if nextCursor, err = q.encode(items[len(items)-1], false); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	if hasPrev {
+		if prevCursor, err = q.encode(items[0], true); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	return items, nextCursor, prevCursor, nil
+}
+
+// pageItems returns the items of the page from the items found, without the extra one, in the order of the sort
+func pageItems[I any](q KeysetQuery, found []I) []I {
+	items := found
+	if int64(len(items)) == q.Limit {
+		items = items[:len(items)-1]
+	}
+
+	if !q.backward {
+		return items
+	}
+
+	result := make([]I, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		result = append(result, items[i])
+	}
+	return result
+}
+
+// FindPage finds a page of the documents of the collection matching the filter, with keyset pagination.
+// See KeysetQuery.
+func FindPage[T any](ctx context.Context, collection *mongo.Collection, signer *xpaging.CursorSigner, filter interface{}, sort xpaging.SortOptions, cursorOptions xpaging.CursorOptions) (xpaging.CursorPaginatedResponse[T], error) {
+	response := xpaging.CursorPaginatedResponse[T]{Items: []T{}}
+
+	query, err := NewKeysetQuery(signer, filter, sort, cursorOptions)
+	if err != nil {
+		return response, err
+	}
+
+	cursor, err := collection.Find(ctx, query.Filter, query.FindOptions())
+	if err != nil {
+		return response, ConvertMongoError(err, collection.Name(), "%v", query.Filter)
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var found []bson.Raw
+	var decoded []T
+
+	for cursor.Next(ctx) {
+		var item T
+		if err := cursor.Decode(&item); err != nil {
+			return response, ConvertMongoError(err, collection.Name(), "%v", query.Filter)
+		}
+
+		decoded = append(decoded, item)
+		found = append(found, append(bson.Raw{}, cursor.Current...))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return response, ConvertMongoError(err, collection.Name(), "%v", query.Filter)
+	}
+
+	_, nextCursor, prevCursor, err := query.Page(found)
+	if err != nil {
+		return response, err
+	}
+
+	response.Items = append(response.Items, pageItems(query, decoded)...)
+	response.NextCursor = nextCursor
+	response.PrevCursor = prevCursor
+
+	return response, nil
+}
+
+// rangeFilter returns the conditions selecting the items after the values in the sort order, or before them if
+// backward. For a sort a, b it is: a > va OR (a == va AND b > vb), with < for descending keys.
+// Missing fields are null, which mongo sorts before any other value, so they are after any value going down, and
+// nothing is before them.
+func rangeFilter(sort xpaging.SortOptions, values []bson.RawValue, backward bool) bson.A {
+	conditions := bson.A{}
+
+	for i, entry := range sort {
+		descending := (entry.Direction == xpaging.DirectionDesc) != backward
+		if descending && isNull(values[i]) {
+			continue
+		}
+
+		condition := bson.D{}
+		for j := 0; j < i; j++ {
+			condition = append(condition, bson.E{Key: sort[j].FieldName, Value: values[j]})
+		}
+
+		condition = append(condition, rangeCondition(entry.FieldName, values[i], descending))
+		conditions = append(conditions, condition)
+	}
+
+	return conditions
+}
+
+// rangeCondition selects the values of the field greater than value, or lower if descending
+func rangeCondition(field string, value bson.RawValue, descending bool) bson.E {
+	if descending && field == idField {
+		// _id is never null
+		return bson.E{Key: field, Value: bson.D{{Key: "$lt", Value: value}}}
+	}
+
+	if descending {
+		return bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: field, Value: bson.D{{Key: "$lt", Value: value}}}},
+			bson.D{{Key: field, Value: nil}},
+		}}
+	}
+
+	if isNull(value) {
+		return bson.E{Key: field, Value: bson.D{{Key: "$ne", Value: nil}}}
+	}
+
+	return bson.E{Key: field, Value: bson.D{{Key: "$gt", Value: value}}}
+}
+
+func isNull(value bson.RawValue) bool {
+	return value.Type == bsontype.Null || value.Type == bsontype.Undefined
+}
+
+func (q KeysetQuery) encode(item bson.Raw, backward bool) (string, error) {
+	position := cursorPosition{Sort: sortKey(q.sort), Backward: backward}
+
+	for _, entry := range q.sort {
+		value, err := item.LookupErr(strings.Split(entry.FieldName, ".")...)
+		if err != nil {
+			// Missing fields are sorted as null
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		position.Values = append(position.Values, value)
+	}
+
+	payload, err := bson.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	return q.signer.Sign(payload), nil
+}
+
+func (q KeysetQuery) decode(token string) (cursorPosition, error) {
+	var position cursorPosition
+
+	payload, err := q.signer.Verify(token)
+	if err != nil {
+		return position, err
+	}
+
+	if err := bson.Unmarshal(payload, &position); err != nil {
+		return position, xerrors.NewInvalidArgumentError("cursor", "malformed")
+	}
+
+	if position.Sort != sortKey(q.sort) || len(position.Values) != len(q.sort) {
+		return position, xerrors.NewInvalidArgumentError("cursor", "created for other sort")
+	}
+
+	return position, nil
+}
+
+// withIdSort returns the sort with _id as the last key, if it is not already sorted by _id
+func withIdSort(sort xpaging.SortOptions) xpaging.SortOptions {
+	result := make(xpaging.SortOptions, 0, len(sort)+1)
+
+	for _, entry := range sort {
+		result = append(result, entry)
+		if entry.FieldName == idField {
+			return result
+		}
+	}
+
+	return append(result, xpaging.NewSortEntry(idField, xpaging.DirectionAsc))
+}
+
+func reversed(sort xpaging.SortOptions) xpaging.SortOptions {
+	result := make(xpaging.SortOptions, 0, len(sort))
+	for _, entry := range sort {
+		result = append(result, xpaging.NewSortEntry(entry.FieldName, -entry.Direction))
+	}
+	return result
+}
+
+func sortKey(sort xpaging.SortOptions) string {
+	parts := make([]string, 0, len(sort))
+	for _, entry := range sort {
+		parts = append(parts, fmt.Sprintf("%s:%d", entry.FieldName, entry.Direction))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,111 @@
+//go:build integration
+
+package xmongo_test
+
+import (
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func names(page xpaging.CursorPaginatedResponse[*client]) []string {
+	result := make([]string, 0, len(page.Items))
+	for _, item := range page.Items {
+		result = append(result, item.Name)
+	}
+	return result
+}
+
+func TestRepo_lists_by_cursor_forward_and_backward(t *testing.T) {
+	// GIVEN 5 documents with repeated names, and one in other tenant
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	signer := xpaging.NewCursorSigner([]byte("secret"))
+	byName := xpaging.SortOptions{xpaging.NewSortEntry("name", xpaging.DirectionAsc)}
+
+	for _, name := range []string{"Ann", "Bob", "Bob", "Bob", "Carl"} {
+		require.NoError(t, repo.Save(ctx, &client{Name: name}))
+	}
+	require.NoError(t, repo.Save(inTenant("other-tenant"), &client{Name: "Bob"}))
+
+	// WHEN the pages are walked forward
+	first, err := repo.ListByCursor(ctx, signer, nil, byName, xpaging.CursorOptions{Limit: 2})
+	require.NoError(t, err)
+	second, err := repo.ListByCursor(ctx, signer, nil, byName, xpaging.CursorOptions{Cursor: first.NextCursor, Limit: 2})
+	require.NoError(t, err)
+	third, err := repo.ListByCursor(ctx, signer, nil, byName, xpaging.CursorOptions{Cursor: second.NextCursor, Limit: 2})
+	require.NoError(t, err)
+
+	// THEN all the documents of the tenant are listed once
+	require.Equal(t, []string{"Ann", "Bob"}, names(first))
+	require.Equal(t, []string{"Bob", "Bob"}, names(second))
+	require.Equal(t, []string{"Carl"}, names(third))
+	require.Empty(t, first.PrevCursor)
+	require.Empty(t, third.NextCursor)
+
+	// AND walking backward returns the same pages
+	back, err := repo.ListByCursor(ctx, signer, nil, byName, xpaging.CursorOptions{Cursor: third.PrevCursor, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, second.Items, back.Items)
+
+	back, err = repo.ListByCursor(ctx, signer, bson.M{}, byName, xpaging.CursorOptions{Cursor: back.PrevCursor, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, first.Items, back.Items)
+	require.Empty(t, back.PrevCursor)
+}
+
+func TestRepo_lists_by_cursor_documents_without_the_sort_field(t *testing.T) {
+	for _, direction := range []xpaging.SortDirection{xpaging.DirectionAsc, xpaging.DirectionDesc} {
+		// GIVEN 2 documents with name, and 2 without it
+		ctx := inTenant("a-tenant")
+		repo := newTestRepo(t)
+		signer := xpaging.NewCursorSigner([]byte("secret"))
+		byName := xpaging.SortOptions{xpaging.NewSortEntry("name", direction)}
+
+		require.NoError(t, repo.Save(ctx, &client{Name: "Ann"}))
+		require.NoError(t, repo.Save(ctx, &client{Name: "Bob"}))
+		for i := 0; i < 2; i++ {
+			_, err := repo.Collection().InsertOne(ctx, bson.M{"_id": ids.New(), "tenant": "a-tenant", "version": 1})
+			require.NoError(t, err)
+		}
+
+		// WHEN the pages are walked forward, one by one
+		var pages []xpaging.CursorPaginatedResponse[*client]
+		cursor := ""
+		for {
+			page, err := repo.ListByCursor(ctx, signer, nil, byName, xpaging.CursorOptions{Cursor: cursor, Limit: 1})
+			require.NoError(t, err)
+			pages = append(pages, page)
+			if page.NextCursor == "" || len(pages) > 4 {
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		// THEN all the documents are listed once, with the ones without name sorted as null
+		require.Len(t, pages, 4)
+		listed := map[ids.Id]bool{}
+		for _, page := range pages {
+			listed[page.Items[0].ID] = true
+		}
+		require.Len(t, listed, 4)
+
+		expected := []string{"", "", "Ann", "Bob"}
+		if direction == xpaging.DirectionDesc {
+			expected = []string{"Bob", "Ann", "", ""}
+		}
+		for i, page := range pages {
+			require.Equal(t, expected[i:i+1], names(page))
+		}
+
+		// AND walking backward returns the same pages
+		for i := len(pages) - 1; i > 0; i-- {
+			back, err := repo.ListByCursor(ctx, signer, nil, byName, xpaging.CursorOptions{Cursor: pages[i].PrevCursor, Limit: 1})
+			require.NoError(t, err)
+			require.Equal(t, pages[i-1].Items, back.Items)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package xmongo
+
+import (
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var (
+	testSigner = xpaging.NewCursorSigner([]byte("secret"))
+	byNameDesc = xpaging.SortOptions{xpaging.NewSortEntry("name", xpaging.DirectionDesc)}
+)
+
+func rawDoc(t *testing.T, id int, name string) bson.Raw {
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "name", Value: name}})
+	require.NoError(t, err)
+	return raw
+}
+
+func rawValue(t *testing.T, value interface{}) bson.RawValue {
+	raw, err := bson.Marshal(bson.D{{Key: "v", Value: value}})
+	require.NoError(t, err)
+	return bson.Raw(raw).Lookup("v")
+}
+
+func TestNewKeysetQuery_first_page(t *testing.T) {
+	// WHEN the first page is queried
+	query, err := NewKeysetQuery(testSigner, bson.M{"status": "active"}, byNameDesc, xpaging.CursorOptions{Limit: 2})
+
+	// THEN the sort ends by _id, and one more item is read
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{Key: "name", Value: -1}, {Key: "_id", Value: 1}}, query.Sort)
+	require.Equal(t, int64(3), query.Limit)
+	require.Equal(t, bson.D{{Key: "$and", Value: bson.A{bson.M{"status": "active"}}}}, query.Filter)
+}
+
+func TestKeysetQuery_walks_pages_forward_and_backward(t *testing.T) {
+	// GIVEN the first page, with more items after it
+	first, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Limit: 2})
+	require.NoError(t, err)
+
+	items, next, prev, err := first.Page([]bson.Raw{rawDoc(t, 1, "Carl"), rawDoc(t, 2, "Bob"), rawDoc(t, 3, "Bob")})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.NotEmpty(t, next)
+	require.Empty(t, prev)
+
+	// WHEN the next page is queried
+	second, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Cursor: next, Limit: 2})
+	require.NoError(t, err)
+
+	// THEN it reads the items after the last one of the first page, including the ones without name
+	require.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: bson.D{{Key: "$lt", Value: rawValue(t, "Bob")}}}},
+			bson.D{{Key: "name", Value: nil}},
+		}}},
+		bson.D{{Key: "name", Value: rawValue(t, "Bob")}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: rawValue(t, 2)}}}},
+	}}}, second.Filter)
+
+	// AND being the last page, it only has a previous page
+	items, next, prev, err = second.Page([]bson.Raw{rawDoc(t, 3, "Bob")})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Empty(t, next)
+	require.NotEmpty(t, prev)
+
+	// WHEN the previous page is queried
+	back, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Cursor: prev, Limit: 2})
+	require.NoError(t, err)
+
+	// THEN it reads the items before the first one of the second page, in reverse order
+	require.Equal(t, bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: -1}}, back.Sort)
+	require.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "name", Value: bson.D{{Key: "$gt", Value: rawValue(t, "Bob")}}}},
+		bson.D{{Key: "name", Value: rawValue(t, "Bob")}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: rawValue(t, 3)}}}},
+	}}}, back.Filter)
+
+	// AND the items are returned in the order of the sort, being the first page
+	items, next, prev, err = back.Page([]bson.Raw{rawDoc(t, 2, "Bob"), rawDoc(t, 1, "Carl")})
+	require.NoError(t, err)
+	require.Equal(t, []bson.Raw{rawDoc(t, 1, "Carl"), rawDoc(t, 2, "Bob")}, items)
+	require.NotEmpty(t, next)
+	require.Empty(t, prev)
+}
+
+func TestNewKeysetQuery_rejects_invalid_cursors(t *testing.T) {
+	// GIVEN a cursor of a listing sorted by name
+	query, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Limit: 1})
+	require.NoError(t, err)
+	_, next, _, err := query.Page([]bson.Raw{rawDoc(t, 1, "Carl"), rawDoc(t, 2, "Bob")})
+	require.NoError(t, err)
+
+	// WHEN it is used with other sort
+	_, err = NewKeysetQuery(testSigner, nil, nil, xpaging.CursorOptions{Cursor: next})
+
+	// THEN it is rejected
+	require.ErrorIs(t, err, xerrors.ErrInvalidArgument)
+
+	// AND forged cursors are rejected
+	_, err = NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Cursor: "X" + next})
+	require.ErrorIs(t, err, xerrors.ErrInvalidArgument)
+}
+
+func TestKeysetQuery_sorts_missing_fields_as_null(t *testing.T) {
+	// GIVEN a page whose last item has no name
+	first, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Limit: 1})
+	require.NoError(t, err)
+
+	withoutName, err := bson.Marshal(bson.D{{Key: "_id", Value: 2}})
+	require.NoError(t, err)
+
+	_, next, _, err := first.Page([]bson.Raw{withoutName, rawDoc(t, 3, "Bob")})
+	require.NoError(t, err)
+
+	// WHEN the next page is queried
+	second, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Cursor: next, Limit: 1})
+	require.NoError(t, err)
+
+	// THEN it reads only the items without name after it, as nothing is lower than null
+	require.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "name", Value: bson.RawValue{Type: bsontype.Null}}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: rawValue(t, 2)}}}},
+	}}}, second.Filter)
+
+	_, err = bson.Marshal(second.Filter)
+	require.NoError(t, err)
+
+	// AND the page before it reads the items with name
+	_, _, prev, err := second.Page([]bson.Raw{withoutName})
+	require.NoError(t, err)
+
+	back, err := NewKeysetQuery(testSigner, nil, byNameDesc, xpaging.CursorOptions{Cursor: prev, Limit: 1})
+	require.NoError(t, err)
+
+	require.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "name", Value: bson.D{{Key: "$ne", Value: nil}}}},
+		bson.D{{Key: "name", Value: bson.RawValue{Type: bsontype.Null}}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: rawValue(t, 2)}}}},
+	}}}, back.Filter)
+}
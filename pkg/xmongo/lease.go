@@ -0,0 +1,115 @@
+package xmongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	LeaseUntilField    = "lockedUntil" // The end of the lease of a claimed document
+	LeaseOwnerField    = "lockedBy"    // The owner of the lease, if the Lease has one
+	LeaseAttemptsField = "attempts"    // The number of times the document was claimed
+)
+
+// Lease claims the documents of a collection for a time, so many workers, i.e. the replicas of a service, can process
+// the documents of the same collection without processing one at the same time. A document can be claimed if it is
+// not leased or its lease expired, and each claim increments its attempts.
+// The lease is kept in the lockedUntil, lockedBy and attempts fields of the documents.
+type Lease struct {
+	collection *mongo.Collection
+	sort       bson.D
+	owner      string
+}
+
+// LeaseOption configures a Lease
+type LeaseOption func(*Lease)
+
+// WithLeaseOwner sets the owner stored in the claimed documents, to update them only while holding the lease
+func WithLeaseOwner(owner string) LeaseOption {
+	return func(l *Lease) {
+		l.owner = owner
+	}
+}
+
+// NewLease creates a new Lease claiming the documents of the collection in the sort order
+func NewLease(collection *mongo.Collection, sort bson.D, options ...LeaseOption) *Lease {
+	xerrors.EnsureNotEmpty(collection, "collection")
+
+	l := &Lease{
+		collection: collection,
+		sort:       sort,
+	}
+
+	for _, option := range options {
+		option(l)
+	}
+
+	return l
+}
+
+// Available returns the filter of the documents not leased at now
+func (l *Lease) Available(now time.Time) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{LeaseUntilField: nil},
+			bson.M{LeaseUntilField: bson.M{"$lt": now}},
+		},
+	}
+}
+
+// Released returns the fields to $unset to release the lease of a document
+func (l *Lease) Released() bson.M {
+	return bson.M{LeaseUntilField: "", LeaseOwnerField: ""}
+}
+
+// ClaimNext claims the first document matching the filter that is available at now, until now plus the duration,
+// and decodes it, after the claim, in result. Returns false if there is no document to claim.
+func (l *Lease) ClaimNext(ctx context.Context, filter bson.M, now time.Time, duration time.Duration, result interface{}) (bool, error) {
+	set := bson.M{LeaseUntilField: now.Add(duration)}
+	if l.owner != "" {
+		set[LeaseOwnerField] = l.owner
+	}
+
+	query := bson.D{{Key: "$and", Value: bson.A{filter, l.Available(now)}}}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{LeaseAttemptsField: 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if l.sort != nil {
+		opts.SetSort(l.sort)
+	}
+
+	err := l.collection.FindOneAndUpdate(ctx, query, update, opts).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ConvertMongoError(err, l.collection.Name(), "claim %v", filter)
+	}
+
+	return true, nil
+}
+
+// Extend extends until now plus the duration the lease of the document matching the filter, if it is still held by the
+// owner, even if it expired while no other worker claimed it. Returns false if the lease was lost.
+// Requires an owner, set with WithLeaseOwner.
+func (l *Lease) Extend(ctx context.Context, filter bson.M, now time.Time, duration time.Duration) (bool, error) {
+	xerrors.EnsureNotEmpty(l.owner, "owner")
+
+	query := bson.D{{Key: "$and", Value: bson.A{filter, bson.M{LeaseOwnerField: l.owner}}}}
+	update := bson.M{"$set": bson.M{LeaseUntilField: now.Add(duration)}}
+
+	result, err := l.collection.UpdateOne(ctx, query, update)
+	if err != nil {
+		return false, ConvertMongoError(err, l.collection.Name(), "extend %v", filter)
+	}
+
+	return result.MatchedCount > 0, nil
+}
@@ -0,0 +1,122 @@
+//go:build integration
+
+package xmongo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type leasedTask struct {
+	ID          string     `bson:"_id"`
+	DueAt       time.Time  `bson:"dueAt"`
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty"`
+	LockedBy    string     `bson:"lockedBy,omitempty"`
+	Attempts    int        `bson:"attempts"`
+}
+
+func newTestLeaseCollection(t *testing.T, tasks ...leasedTask) *mongo.Collection {
+	collection := mongoInMemory.Client().Database("test").Collection("tasks-" + ids.New().String())
+	t.Cleanup(func() { _ = collection.Drop(context.Background()) })
+
+	for _, task := range tasks {
+		_, err := collection.InsertOne(context.Background(), task)
+		require.NoError(t, err)
+	}
+
+	return collection
+}
+
+func TestLease_claims_each_document_once_until_it_expires(t *testing.T) {
+	// GIVEN two tasks, and a lease ordered by due date
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	collection := newTestLeaseCollection(t,
+		leasedTask{ID: "second", DueAt: now.Add(-time.Minute)},
+		leasedTask{ID: "first", DueAt: now.Add(-time.Hour)},
+	)
+	lease := xmongo.NewLease(collection, bson.D{{Key: "dueAt", Value: 1}}, xmongo.WithLeaseOwner("worker-1"))
+	ctx := context.Background()
+
+	// WHEN the tasks are claimed
+	var first, second, none leasedTask
+	foundFirst, err := lease.ClaimNext(ctx, bson.M{}, now, time.Minute, &first)
+	require.NoError(t, err)
+	foundSecond, err := lease.ClaimNext(ctx, bson.M{}, now, time.Minute, &second)
+	require.NoError(t, err)
+	foundNone, err := lease.ClaimNext(ctx, bson.M{}, now, time.Minute, &none)
+	require.NoError(t, err)
+
+	// THEN each one is claimed once, in order, by the owner
+	require.True(t, foundFirst)
+	require.Equal(t, "first", first.ID)
+	require.Equal(t, 1, first.Attempts)
+	require.Equal(t, "worker-1", first.LockedBy)
+	require.Equal(t, now.Add(time.Minute), first.LockedUntil.UTC())
+
+	require.True(t, foundSecond)
+	require.Equal(t, "second", second.ID)
+
+	require.False(t, foundNone)
+
+	// AND a task is claimed again after its lease expires
+	var again leasedTask
+	found, err := lease.ClaimNext(ctx, bson.M{"_id": "first"}, now.Add(2*time.Minute), time.Minute, &again)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 2, again.Attempts)
+}
+
+func TestLease_claims_released_documents(t *testing.T) {
+	// GIVEN a claimed task
+	now := time.Now().UTC()
+	collection := newTestLeaseCollection(t, leasedTask{ID: "task", DueAt: now})
+	lease := xmongo.NewLease(collection, nil)
+	ctx := context.Background()
+
+	var task leasedTask
+	_, err := lease.ClaimNext(ctx, bson.M{}, now, time.Hour, &task)
+	require.NoError(t, err)
+
+	// WHEN its lease is released
+	_, err = collection.UpdateByID(ctx, task.ID, bson.M{"$unset": lease.Released()})
+	require.NoError(t, err)
+
+	// THEN it can be claimed again before the lease would expire
+	found, err := lease.ClaimNext(ctx, bson.M{}, now, time.Hour, &task)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 2, task.Attempts)
+}
+
+func TestLease_extends_only_the_leases_of_its_owner(t *testing.T) {
+	// GIVEN a task claimed by a worker
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	collection := newTestLeaseCollection(t, leasedTask{ID: "task", DueAt: now})
+	lease := xmongo.NewLease(collection, nil, xmongo.WithLeaseOwner("worker-1"))
+	other := xmongo.NewLease(collection, nil, xmongo.WithLeaseOwner("worker-2"))
+	ctx := context.Background()
+
+	var task leasedTask
+	_, err := lease.ClaimNext(ctx, bson.M{}, now, time.Minute, &task)
+	require.NoError(t, err)
+
+	// WHEN the owner and other worker extend the lease
+	extended, err := lease.Extend(ctx, bson.M{"_id": "task"}, now, time.Hour)
+	require.NoError(t, err)
+	extendedByOther, err := other.Extend(ctx, bson.M{"_id": "task"}, now, 2*time.Hour)
+	require.NoError(t, err)
+
+	// THEN only the owner extends it
+	require.True(t, extended)
+	require.False(t, extendedByOther)
+
+	require.NoError(t, collection.FindOne(ctx, bson.M{"_id": "task"}).Decode(&task))
+	require.Equal(t, now.Add(time.Hour), task.LockedUntil.UTC())
+}
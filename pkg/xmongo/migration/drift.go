@@ -0,0 +1,171 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const idIndexName = "_id_"
+
+// DriftKind is the kind of difference between an index declared by the migrations and the database
+type DriftKind string
+
+const (
+	DriftMissing    DriftKind = "missing"    // The index is declared but it does not exist
+	DriftUnexpected DriftKind = "unexpected" // The index exists but it is not declared
+	DriftChanged    DriftKind = "changed"    // The index exists with other keys or options
+)
+
+// IndexDrift is a difference between the indexes declared by the migrations and the indexes in the database
+type IndexDrift struct {
+	Collection string
+	Index      string
+	Kind       DriftKind
+	Details    string // The differences of a changed index
+}
+
+func (d IndexDrift) String() string {
+	if d.Details == "" {
+		return fmt.Sprintf("%s index %s.%s", d.Kind, d.Collection, d.Index)
+	}
+	return fmt.Sprintf("%s index %s.%s: %s", d.Kind, d.Collection, d.Index, d.Details)
+}
+
+// declaredIndexes returns the indexes by name of each collection, after applying all the migrations in order
+func declaredIndexes(migrations []Migration) map[string]map[string]mongo.IndexModel {
+	declared := make(map[string]map[string]mongo.IndexModel)
+
+	for _, migration := range migrations {
+		change := migration.indexes
+		if change == nil {
+			continue
+		}
+
+		indexes, found := declared[change.collection]
+		if !found {
+			indexes = make(map[string]mongo.IndexModel)
+			declared[change.collection] = indexes
+		}
+
+		for _, model := range change.create {
+			indexes[*model.Options.Name] = model
+		}
+
+		for _, name := range change.drop {
+			delete(indexes, name)
+		}
+	}
+
+	return declared
+}
+
+// compareIndexes compares the declared indexes of the collection with the existing ones, as returned by listIndexes
+func compareIndexes(collection string, declared map[string]mongo.IndexModel, existing []bson.Raw) ([]IndexDrift, error) {
+	var drifts []IndexDrift
+	found := make(map[string]bool)
+
+	for _, index := range existing {
+		name, _ := index.Lookup("name").StringValueOK()
+		if name == idIndexName {
+			continue
+		}
+
+		found[name] = true
+
+		model, isDeclared := declared[name]
+		if !isDeclared {
+			drifts = append(drifts, IndexDrift{Collection: collection, Index: name, Kind: DriftUnexpected})
+			continue
+		}
+
+		differences, err := indexDifferences(model, index)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(differences) > 0 {
+			drifts = append(drifts, IndexDrift{Collection: collection, Index: name, Kind: DriftChanged, Details: strings.Join(differences, ", ")})
+		}
+	}
+
+	for name := range declared {
+		if !found[name] {
+			drifts = append(drifts, IndexDrift{Collection: collection, Index: name, Kind: DriftMissing})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Index < drifts[j].Index })
+
+	return drifts, nil
+}
+
+// indexDifferences compares the keys, the unique flag and the TTL of the declared index with the existing one
+func indexDifferences(model mongo.IndexModel, existing bson.Raw) ([]string, error) {
+	var differences []string
+
+	keys, err := bson.Marshal(model.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	declaredKeys := keysName(keys)
+	existingKeysDoc, _ := existing.Lookup("key").DocumentOK()
+	existingKeys := keysName(existingKeysDoc)
+	if declaredKeys != existingKeys {
+		differences = append(differences, fmt.Sprintf("keys %s, declared %s", existingKeys, declaredKeys))
+	}
+
+	declaredUnique := model.Options.Unique != nil && *model.Options.Unique
+	existingUnique, _ := existing.Lookup("unique").BooleanOK()
+	if declaredUnique != existingUnique {
+		differences = append(differences, fmt.Sprintf("unique %t, declared %t", existingUnique, declaredUnique))
+	}
+
+	declaredTTL := "none"
+	if model.Options.ExpireAfterSeconds != nil {
+		declaredTTL = strconv.Itoa(int(*model.Options.ExpireAfterSeconds))
+	}
+	existingTTL := "none"
+	if value, err := existing.LookupErr("expireAfterSeconds"); err == nil {
+		existingTTL = formatValue(value)
+	}
+	if declaredTTL != existingTTL {
+		differences = append(differences, fmt.Sprintf("expireAfterSeconds %s, declared %s", existingTTL, declaredTTL))
+	}
+
+	return differences, nil
+}
+
+// keysName returns the name mongo gives by default to an index with the keys, i.e. field1_1_field2_-1
+func keysName(keys bson.Raw) string {
+	elements, _ := keys.Elements()
+
+	parts := make([]string, 0, 2*len(elements))
+	for _, element := range elements {
+		parts = append(parts, element.Key(), formatValue(element.Value()))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// formatValue formats the numbers as integers, as they are declared as int but could be stored as double
+func formatValue(value bson.RawValue) string {
+	switch value.Type {
+	case bsontype.Int32:
+		return strconv.Itoa(int(value.Int32()))
+	case bsontype.Int64:
+		return strconv.FormatInt(value.Int64(), 10)
+	case bsontype.Double:
+		return strconv.FormatFloat(value.Double(), 'f', -1, 64)
+	case bsontype.String:
+		return value.StringValue()
+	default:
+		return value.String()
+	}
+}
@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func existingIndex(t *testing.T, index bson.D) bson.Raw {
+	raw, err := bson.Marshal(index)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestCreateIndexes_names_indexes_as_mongo(t *testing.T) {
+	// WHEN indexes without name are declared
+	migration := CreateIndexes(1, "clients",
+		mongo.IndexModel{Keys: bson.D{{Key: "partnerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email_index")},
+	)
+
+	// THEN they get the default mongo name
+	require.Equal(t, "partnerId_1_createdAt_-1", *migration.indexes.create[0].Options.Name)
+	require.Equal(t, "email_index", *migration.indexes.create[1].Options.Name)
+	require.Equal(t, "create indexes [partnerId_1_createdAt_-1 email_index] in clients", migration.Description)
+}
+
+func TestDeclaredIndexes_applies_drops_in_order(t *testing.T) {
+	// GIVEN an index created, dropped and created again with other keys
+	migrations := []Migration{
+		CreateIndexes(1, "clients", mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email")}),
+		CreateIndexes(2, "clients", mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}}),
+		DropIndexes(3, "clients", "email"),
+		CreateIndexes(4, "clients", mongo.IndexModel{Keys: bson.D{{Key: "email", Value: -1}}, Options: options.Index().SetName("email")}),
+	}
+
+	// WHEN the declared indexes are computed
+	declared := declaredIndexes(migrations)
+
+	// THEN the last declaration wins
+	require.Len(t, declared["clients"], 2)
+	require.Equal(t, bson.D{{Key: "email", Value: -1}}, declared["clients"]["email"].Keys)
+	require.Contains(t, declared["clients"], "name_1")
+}
+
+func TestCompareIndexes_reports_drift(t *testing.T) {
+	// GIVEN declared indexes
+	declared := declaredIndexes([]Migration{
+		CreateIndexes(1, "clients",
+			mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+			mongo.IndexModel{Keys: bson.D{{Key: "partnerId", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(60)},
+			mongo.IndexModel{Keys: bson.D{{Key: "name", Value: "text"}}},
+		),
+	})["clients"]
+
+	// AND the indexes in the database
+	existing := []bson.Raw{
+		existingIndex(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}}),
+		existingIndex(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "email", Value: 1}}}, {Key: "name", Value: "email_1"}}),
+		existingIndex(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "expiresAt", Value: 1.0}}}, {Key: "name", Value: "expiresAt_1"}, {Key: "expireAfterSeconds", Value: int32(60)}}),
+		existingIndex(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "name", Value: "text"}}}, {Key: "name", Value: "name_text"}}),
+		existingIndex(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "legacy", Value: 1}}}, {Key: "name", Value: "legacy_1"}}),
+	}
+
+	// WHEN they are compared
+	drifts, err := compareIndexes("clients", declared, existing)
+
+	// THEN the missing, unexpected and changed indexes are reported
+	require.NoError(t, err)
+	require.Equal(t, []IndexDrift{
+		{Collection: "clients", Index: "email_1", Kind: DriftChanged, Details: "unique false, declared true"},
+		{Collection: "clients", Index: "legacy_1", Kind: DriftUnexpected},
+		{Collection: "clients", Index: "partnerId_1", Kind: DriftMissing},
+	}, drifts)
+}
@@ -0,0 +1,127 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const codeNamespaceNotFound = 26
+
+// Migration is a versioned change of the database, applied once by the Migrator in order of version.
+// Use CreateIndexes, DropIndexes, SetValidator and Backfill to declare the common ones, or set Up for any other.
+type Migration struct {
+	Version     int    // Unique and positive, migrations are applied in ascending order
+	Description string // What the migration does, recorded with it
+	Up          func(ctx context.Context, db *mongo.Database) error
+
+	indexes *indexChange // The indexes created or dropped, to detect the drift
+}
+
+type indexChange struct {
+	collection string
+	create     []mongo.IndexModel
+	drop       []string
+}
+
+// CreateIndexes declares a migration creating the indexes in the collection.
+// Indexes without name are named as mongo does by default, i.e. field1_1_field2_-1.
+func CreateIndexes(version int, collection string, models ...mongo.IndexModel) Migration {
+	named := make([]mongo.IndexModel, 0, len(models))
+	names := make([]string, 0, len(models))
+
+	for _, model := range models {
+		model = withName(model)
+		named = append(named, model)
+		names = append(names, *model.Options.Name)
+	}
+
+	return Migration{
+		Version:     version,
+		Description: fmt.Sprintf("create indexes %v in %s", names, collection),
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collection).Indexes().CreateMany(ctx, named)
+			return xmongo.ConvertMongoError(err, "index", "%v in %s", names, collection)
+		},
+		indexes: &indexChange{collection: collection, create: named},
+	}
+}
+
+// DropIndexes declares a migration dropping the named indexes of the collection
+func DropIndexes(version int, collection string, names ...string) Migration {
+	return Migration{
+		Version:     version,
+		Description: fmt.Sprintf("drop indexes %v in %s", names, collection),
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range names {
+				if _, err := db.Collection(collection).Indexes().DropOne(ctx, name); err != nil {
+					return xmongo.ConvertMongoError(err, "index", "%s in %s", name, collection)
+				}
+			}
+			return nil
+		},
+		indexes: &indexChange{collection: collection, drop: names},
+	}
+}
+
+// SetValidator declares a migration setting the JSON schema validator of the collection, creating it if it does
+// not exist. Documents already stored are not validated.
+func SetValidator(version int, collection string, schema bson.M) Migration {
+	validator := bson.M{"$jsonSchema": schema}
+
+	return Migration{
+		Version:     version,
+		Description: fmt.Sprintf("set schema validator of %s", collection),
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := db.RunCommand(ctx, bson.D{{Key: "collMod", Value: collection}, {Key: "validator", Value: validator}}).Err()
+			if isNamespaceNotFound(err) {
+				err = db.CreateCollection(ctx, collection, options.CreateCollection().SetValidator(validator))
+			}
+			return xmongo.ConvertMongoError(err, "collection", "%s", collection)
+		},
+	}
+}
+
+// Backfill declares a migration updating all the documents of the collection matching the filter
+func Backfill(version int, description string, collection string, filter interface{}, update interface{}) Migration {
+	return Migration{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection(collection).UpdateMany(ctx, filter, update)
+			return xmongo.ConvertMongoError(err, collection, "%v", filter)
+		},
+	}
+}
+
+// withName returns the model with the default index name if it has none
+func withName(model mongo.IndexModel) mongo.IndexModel {
+	if model.Options != nil && model.Options.Name != nil {
+		return model
+	}
+
+	opts := options.Index()
+	if model.Options != nil {
+		copied := *model.Options
+		opts = &copied
+	}
+
+	keys, err := bson.Marshal(model.Keys)
+	if err != nil {
+		panic(fmt.Sprintf("invalid index keys %v: %s", model.Keys, err))
+	}
+
+	model.Options = opts.SetName(keysName(keys))
+
+	return model
+}
+
+func isNamespaceNotFound(err error) bool {
+	var serverError mongo.ServerError
+	return errors.As(err, &serverError) && serverError.HasErrorCode(codeNamespaceNotFound)
+}
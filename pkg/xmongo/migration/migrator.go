@@ -0,0 +1,362 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCollection   = "migrations"
+	defaultLockDuration = 5 * time.Minute
+	defaultPollInterval = time.Second
+
+	lockId = "migrations"
+)
+
+// Record is an applied migration, as stored in the migrations collection
+type Record struct {
+	Version     int           `bson:"_id"`
+	Description string        `bson:"description"`
+	AppliedAt   time.Time     `bson:"appliedAt"`
+	AppliedBy   string        `bson:"appliedBy"` // The migrator that applied it
+	Duration    time.Duration `bson:"duration"`
+}
+
+// Info identifies a migration in a Report
+type Info struct {
+	Version     int
+	Description string
+}
+
+// Report is the result of Migrate or DryRun
+type Report struct {
+	Applied []Info       // The migrations applied by Migrate
+	Pending []Info       // The migrations not applied yet
+	Drift   []IndexDrift // The differences between the declared indexes and the database, only reported by DryRun
+}
+
+// Migrator applies the migrations to a database, recording the applied ones in a migrations collection.
+// Many replicas of the service can run the migrations when they start: a replica takes a lock, with a lease renewed
+// before each migration, and the other replicas wait until it is released to find there is nothing left to apply.
+type Migrator struct {
+	logger       *zap.Logger
+	db           *mongo.Database
+	migrations   []Migration
+	records      *mongo.Collection
+	locks        *mongo.Collection
+	lease        *xmongo.Lease
+	owner        string
+	lockDuration time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+// Option configures a Migrator
+type Option func(*Migrator)
+
+// WithCollection sets the collection where the applied migrations are recorded. The lock is stored in the
+// collection with the "_lock" suffix. Default is "migrations".
+func WithCollection(name string) Option {
+	return func(m *Migrator) {
+		m.records = m.db.Collection(name)
+		m.locks = m.db.Collection(name + "_lock")
+	}
+}
+
+// WithLockDuration sets how long the lock is held before other replica can take it. It must be longer than the time
+// to apply a migration, as it is renewed before each one. Default is 5 minutes.
+func WithLockDuration(duration time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockDuration = duration
+	}
+}
+
+// WithPollInterval sets how often a replica waiting for the lock tries to take it. Default is 1 second.
+func WithPollInterval(interval time.Duration) Option {
+	return func(m *Migrator) {
+		m.pollInterval = interval
+	}
+}
+
+// NewMigrator creates a new Migrator applying the migrations to the given database.
+// Panics if a version is not positive or it is repeated.
+func NewMigrator(logger *zap.Logger, client *mongo.Client, databaseName string, migrations []Migration, options ...Option) *Migrator {
+	xerrors.EnsureNotEmpty(logger, "logger")
+	xerrors.EnsureNotEmpty(client, "client")
+	xerrors.EnsureNotEmpty(databaseName, "databaseName")
+
+	db := client.Database(databaseName)
+
+	m := &Migrator{
+		logger:       logger.Named("migrator"),
+		db:           db,
+		migrations:   sortedMigrations(migrations),
+		records:      db.Collection(defaultCollection),
+		locks:        db.Collection(defaultCollection + "_lock"),
+		owner:        newOwner(),
+		lockDuration: defaultLockDuration,
+		pollInterval: defaultPollInterval,
+		now:          time.Now,
+	}
+
+	for _, option := range options {
+		option(m)
+	}
+
+	m.lease = xmongo.NewLease(m.locks, nil, xmongo.WithLeaseOwner(m.owner))
+
+	return m
+}
+
+// sortedMigrations returns the migrations sorted by version, checking the versions are valid
+func sortedMigrations(migrations []Migration) []Migration {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, migration := range sorted {
+		xerrors.EnsureNotEmpty(migration.Up, "migration %d Up", migration.Version)
+
+		if migration.Version <= 0 {
+			panic(fmt.Sprintf("migration version %d must be positive", migration.Version))
+		}
+		if i > 0 && sorted[i-1].Version == migration.Version {
+			panic(fmt.Sprintf("migration version %d is repeated", migration.Version))
+		}
+	}
+
+	return sorted
+}
+
+// newOwner returns a unique name for this migrator, to identify the lock it holds
+func newOwner() string {
+	host, _ := os.Hostname()
+	return host + "/" + ids.New().String()
+}
+
+// Migrate applies the pending migrations in order of version, waiting for the lock if other replica holds it.
+// It stops at the first failing migration, which is applied again in the next run.
+func (m *Migrator) Migrate(ctx context.Context) (Report, error) {
+	var report Report
+
+	if err := m.lock(ctx); err != nil {
+		return report, err
+	}
+	defer m.unlock()
+
+	pending, err := m.pending(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for i, migration := range pending {
+		if err := m.apply(ctx, migration); err != nil {
+			report.Pending = infos(pending[i:])
+			return report, err
+		}
+
+		report.Applied = append(report.Applied, info(migration))
+	}
+
+	return report, nil
+}
+
+// DryRun returns the pending migrations, and the drift between the indexes declared by all the migrations and the
+// indexes in the database. It does not change the database.
+func (m *Migrator) DryRun(ctx context.Context) (Report, error) {
+	var report Report
+
+	pending, err := m.pending(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Pending = infos(pending)
+
+	collections := declaredIndexes(m.migrations)
+
+	names := make([]string, 0, len(collections))
+	for name := range collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		existing, err := m.listIndexes(ctx, name)
+		if err != nil {
+			return report, err
+		}
+
+		drifts, err := compareIndexes(name, collections[name], existing)
+		if err != nil {
+			return report, err
+		}
+
+		report.Drift = append(report.Drift, drifts...)
+	}
+
+	return report, nil
+}
+
+// Applied returns the applied migrations, in order of version
+func (m *Migrator) Applied(ctx context.Context) ([]Record, error) {
+	cursor, err := m.records.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, xmongo.ConvertMongoError(err, "migration", "applied")
+	}
+
+	records := []Record{}
+	err = cursor.All(ctx, &records)
+
+	return records, xmongo.ConvertMongoError(err, "migration", "applied")
+}
+
+func (m *Migrator) pending(ctx context.Context) ([]Migration, error) {
+	records, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	if err := m.renewLock(ctx); err != nil {
+		return err
+	}
+
+	logger := m.logger.With(zap.Int("version", migration.Version), zap.String("description", migration.Description))
+	logger.Info("applying migration")
+
+	start := m.now()
+
+	if err := migration.Up(ctx, m.db); err != nil {
+		logger.Error("migration failed", zap.Error(err))
+		return err
+	}
+
+	record := Record{
+		Version:     migration.Version,
+		Description: migration.Description,
+		AppliedAt:   m.now(),
+		AppliedBy:   m.owner,
+		Duration:    m.now().Sub(start),
+	}
+
+	if _, err := m.records.InsertOne(ctx, record); err != nil {
+		return xmongo.ConvertMongoError(err, "migration", "%d", migration.Version)
+	}
+
+	logger.Info("migration applied", zap.Duration("duration", record.Duration))
+
+	return nil
+}
+
+func (m *Migrator) listIndexes(ctx context.Context, collection string) ([]bson.Raw, error) {
+	cursor, err := m.db.Collection(collection).Indexes().List(ctx)
+	if isNamespaceNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xmongo.ConvertMongoError(err, "index", "%s", collection)
+	}
+
+	var indexes []bson.Raw
+	err = cursor.All(ctx, &indexes)
+
+	return indexes, xmongo.ConvertMongoError(err, "index", "%s", collection)
+}
+
+// lock takes the migrations lock, waiting until other replica releases it or its lease expires
+func (m *Migrator) lock(ctx context.Context) error {
+	if err := m.ensureLock(ctx); err != nil {
+		return err
+	}
+
+	for {
+		locked, err := m.tryLock(ctx)
+		if err != nil || locked {
+			return err
+		}
+
+		m.logger.Info("waiting for other replica to apply the migrations")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// ensureLock creates the lock document to claim, if it does not exist
+func (m *Migrator) ensureLock(ctx context.Context) error {
+	_, err := m.locks.InsertOne(ctx, bson.M{"_id": lockId})
+
+	err = xmongo.ConvertMongoError(err, "migrations lock", "%s", lockId)
+	if errors.Is(err, xerrors.ErrDuplicate) {
+		return nil
+	}
+
+	return err
+}
+
+// tryLock takes the lock if it is free or its lease expired
+func (m *Migrator) tryLock(ctx context.Context) (bool, error) {
+	var lock bson.M
+	return m.lease.ClaimNext(ctx, bson.M{"_id": lockId}, m.now(), m.lockDuration, &lock)
+}
+
+func (m *Migrator) renewLock(ctx context.Context) error {
+	locked, err := m.lease.Extend(ctx, bson.M{"_id": lockId}, m.now(), m.lockDuration)
+	if err == nil && !locked {
+		err = xerrors.NewConditionNotMetError("migrations lock", "lease of %s lost", m.owner)
+	}
+	return err
+}
+
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": lockId, xmongo.LeaseOwnerField: m.owner}
+	if _, err := m.locks.UpdateOne(ctx, filter, bson.M{"$unset": m.lease.Released()}); err != nil {
+		m.logger.Warn("could not release the migrations lock", zap.Error(err))
+	}
+}
+
+func info(migration Migration) Info {
+	return Info{Version: migration.Version, Description: migration.Description}
+}
+
+func infos(migrations []Migration) []Info {
+	result := make([]Info, 0, len(migrations))
+	for _, migration := range migrations {
+		result = append(result, info(migration))
+	}
+	return result
+}
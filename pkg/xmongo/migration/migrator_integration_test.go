@@ -0,0 +1,170 @@
+//go:build integration
+
+package migration
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect()
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+func newTestMigrator(t *testing.T, migrations []Migration) *Migrator {
+	databaseName := "migrations-" + ids.New().String()
+
+	t.Cleanup(func() { _ = mongoInMemory.Client().Database(databaseName).Drop(context.Background()) })
+
+	return NewMigrator(zap.NewNop(), mongoInMemory.Client(), databaseName, migrations, WithPollInterval(10*time.Millisecond))
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		CreateIndexes(1, "clients", mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)}),
+		SetValidator(2, "clients", bson.M{
+			"bsonType": "object",
+			"required": bson.A{"email"},
+		}),
+		Backfill(3, "set status of clients", "clients", bson.M{"status": nil}, bson.M{"$set": bson.M{"status": "active"}}),
+	}
+}
+
+func TestMigrator_applies_pending_migrations_once(t *testing.T) {
+	// GIVEN a client stored before the migrations
+	ctx := context.Background()
+	migrator := newTestMigrator(t, testMigrations())
+
+	clients := migrator.db.Collection("clients")
+	_, err := clients.InsertOne(ctx, bson.M{"email": "john@example.com"})
+	require.NoError(t, err)
+
+	// WHEN the migrations are applied twice
+	report, err := migrator.Migrate(ctx)
+	require.NoError(t, err)
+	again, err := migrator.Migrate(ctx)
+	require.NoError(t, err)
+
+	// THEN they are applied in the first run only
+	require.Len(t, report.Applied, 3)
+	require.Empty(t, again.Applied)
+
+	records, err := migrator.Applied(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, []int{records[0].Version, records[1].Version, records[2].Version})
+
+	// AND the data was backfilled
+	var client bson.M
+	require.NoError(t, clients.FindOne(ctx, bson.M{}).Decode(&client))
+	require.Equal(t, "active", client["status"])
+
+	// AND the schema is validated
+	_, err = clients.InsertOne(ctx, bson.M{"name": "without email"})
+	require.Error(t, err)
+}
+
+func TestMigrator_applies_migrations_in_one_replica(t *testing.T) {
+	// GIVEN a slow migration counting its runs
+	var lock sync.Mutex
+	runs := 0
+
+	migrations := []Migration{{
+		Version:     1,
+		Description: "slow migration",
+		Up: func(context.Context, *mongo.Database) error {
+			lock.Lock()
+			runs++
+			lock.Unlock()
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		},
+	}}
+
+	migrator := newTestMigrator(t, migrations)
+	other := NewMigrator(zap.NewNop(), mongoInMemory.Client(), migrator.db.Name(), migrations, WithPollInterval(10*time.Millisecond))
+
+	// WHEN two replicas migrate at the same time
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, m := range []*Migrator{migrator, other} {
+		wg.Add(1)
+		go func(i int, m *Migrator) {
+			defer wg.Done()
+			_, errs[i] = m.Migrate(context.Background())
+		}(i, m)
+	}
+	wg.Wait()
+
+	// THEN the migration runs once
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.Equal(t, 1, runs)
+}
+
+func TestMigrator_takes_the_lock_of_other_replica_after_its_lease_expires(t *testing.T) {
+	// GIVEN a lock held by a replica that stopped before releasing it
+	ctx := context.Background()
+	migrator := newTestMigrator(t, testMigrations())
+
+	_, err := migrator.locks.InsertOne(ctx, bson.M{
+		"_id":                  lockId,
+		xmongo.LeaseOwnerField: "stopped-replica",
+		xmongo.LeaseUntilField: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	// WHEN the migrations are applied
+	report, err := migrator.Migrate(ctx)
+
+	// THEN the lock is taken and the migrations applied
+	require.NoError(t, err)
+	require.Len(t, report.Applied, 3)
+
+	// AND the lock is released
+	var lock bson.M
+	require.NoError(t, migrator.locks.FindOne(ctx, bson.M{"_id": lockId}).Decode(&lock))
+	require.NotContains(t, lock, xmongo.LeaseOwnerField)
+	require.NotContains(t, lock, xmongo.LeaseUntilField)
+}
+
+func TestMigrator_dry_run_reports_pending_migrations_and_index_drift(t *testing.T) {
+	// GIVEN a database with an index not declared
+	ctx := context.Background()
+	migrator := newTestMigrator(t, testMigrations())
+
+	_, err := migrator.db.Collection("clients").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "legacy", Value: 1}}})
+	require.NoError(t, err)
+
+	// WHEN a dry run is done
+	report, err := migrator.DryRun(ctx)
+
+	// THEN the pending migrations and the drift are reported
+	require.NoError(t, err)
+	require.Len(t, report.Pending, 3)
+	require.Equal(t, []IndexDrift{
+		{Collection: "clients", Index: "email_1", Kind: DriftMissing},
+		{Collection: "clients", Index: "legacy_1", Kind: DriftUnexpected},
+	}, report.Drift)
+
+	// AND nothing was applied
+	records, err := migrator.Applied(ctx)
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
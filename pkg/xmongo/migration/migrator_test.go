@@ -0,0 +1,25 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func noop(context.Context, *mongo.Database) error { return nil }
+
+func TestSortedMigrations_sorts_by_version(t *testing.T) {
+	// WHEN migrations are declared out of order
+	sorted := sortedMigrations([]Migration{{Version: 3, Up: noop}, {Version: 1, Up: noop}, {Version: 2, Up: noop}})
+
+	// THEN they are sorted by version
+	require.Equal(t, []Info{{Version: 1}, {Version: 2}, {Version: 3}}, infos(sorted))
+}
+
+func TestSortedMigrations_rejects_invalid_versions(t *testing.T) {
+	require.Panics(t, func() { sortedMigrations([]Migration{{Version: 1, Up: noop}, {Version: 1, Up: noop}}) })
+	require.Panics(t, func() { sortedMigrations([]Migration{{Version: 0, Up: noop}}) })
+	require.Panics(t, func() { sortedMigrations([]Migration{{Version: 1}}) })
+}
@@ -0,0 +1,193 @@
+package xmongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idField      = "_id"
+	tenantField  = "tenant"
+	versionField = "version"
+)
+
+// Document is an entity stored in a Repo.
+// Pointers to structs embedding entity.Metadata with the `bson:",inline"` tag implement it.
+type Document interface {
+	GetID() ids.Id
+	GetTenant() string
+	GetVersion() int
+	// Touch updates the metadata to the next version of the entity, in the tenant of the context if it has none.
+	// Returns a function that restores the previous metadata.
+	Touch(ctx context.Context, now time.Time) (restore func())
+}
+
+// Repo is a generic repository of documents stored in a collection, as pointers to the entity, i.e. Repo[*Client].
+// All the operations are scoped to the tenant of the context.
+// Save uses optimistic locking on the version of the entity, failing with xerrors.ErrConditionNotMet on conflicts.
+type Repo[T Document] struct {
+	collection *mongo.Collection
+	now        func() time.Time
+}
+
+// NewRepo creates a new Repo storing the documents in the collection
+func NewRepo[T Document](collection *mongo.Collection) *Repo[T] {
+	xerrors.EnsureNotEmpty(collection, "collection")
+
+	return &Repo[T]{
+		collection: collection,
+		now:        time.Now,
+	}
+}
+
+// Collection returns the collection where the documents are stored
+func (r *Repo[T]) Collection() *mongo.Collection {
+	return r.collection
+}
+
+// Find returns the document with the given id in the tenant of the context.
+// Returns a not found error if it does not exist.
+func (r *Repo[T]) Find(ctx context.Context, id ids.Id) (T, error) {
+	var doc T
+
+	err := r.collection.FindOne(ctx, r.byId(ctx, id)).Decode(&doc)
+
+	return doc, ConvertMongoError(err, r.collection.Name(), "%s", id)
+}
+
+// Save stores a new version of the document, updating its metadata.
+// New documents, with version 0, are inserted; the existing ones are replaced only if the stored version is the
+// version of the document, otherwise a condition not met error is returned.
+// On error, the metadata of the document is restored, so it can be saved again. In a transaction of WithTransaction,
+// it is restored too if the transaction fails after the document was saved, so it can be saved again when retried.
+func (r *Repo[T]) Save(ctx context.Context, doc T) error {
+	tenant := xcontext.GetTenantOrDefault(ctx)
+
+	if doc.GetTenant() != "" && doc.GetTenant() != tenant {
+		return xerrors.NewForbiddenError(r.collection.Name(), "%s in tenant %s", doc.GetID(), doc.GetTenant())
+	}
+
+	version := doc.GetVersion()
+
+	restore := doc.Touch(ctx, r.now())
+
+	if err := r.save(ctx, doc, version); err != nil {
+		restore()
+		return err
+	}
+
+	onTransactionFailed(ctx, restore)
+
+	return nil
+}
+
+// save inserts or replaces the touched document, expecting the stored one to be in the given version
+func (r *Repo[T]) save(ctx context.Context, doc T, version int) error {
+	if version == 0 {
+		return r.insert(ctx, doc)
+	}
+
+	filter := r.byId(ctx, doc.GetID())
+	filter = append(filter, bson.E{Key: versionField, Value: version})
+
+	result, err := r.collection.ReplaceOne(ctx, filter, doc)
+	if err != nil {
+		return ConvertMongoError(err, r.collection.Name(), "%s", doc.GetID())
+	}
+
+	if result.MatchedCount == 0 {
+		return xerrors.NewConditionNotMetError(r.collection.Name(), "%s version %d", doc.GetID(), version)
+	}
+
+	return nil
+}
+
+func (r *Repo[T]) insert(ctx context.Context, doc T) error {
+	_, err := r.collection.InsertOne(ctx, doc)
+
+	err = ConvertMongoError(err, r.collection.Name(), "%s", doc.GetID())
+	if errors.Is(err, xerrors.ErrDuplicate) {
+		return xerrors.NewConditionNotMetError(r.collection.Name(), "%s already exists", doc.GetID())
+	}
+
+	return err
+}
+
+// Delete removes the document with the given id in the tenant of the context.
+// Returns a not found error if it does not exist.
+func (r *Repo[T]) Delete(ctx context.Context, id ids.Id) error {
+	result, err := r.collection.DeleteOne(ctx, r.byId(ctx, id))
+	if err != nil {
+		return ConvertMongoError(err, r.collection.Name(), "%s", id)
+	}
+
+	if result.DeletedCount == 0 {
+		return xerrors.NewNotFoundError(r.collection.Name(), "%s", id)
+	}
+
+	return nil
+}
+
+// List returns a page of the documents matching the filter in the tenant of the context.
+// Without sort options, documents are sorted by ID.
+func (r *Repo[T]) List(ctx context.Context, filter bson.M, sort xpaging.SortOptions, paging xpaging.PagingOptions) (xpaging.PaginatedResponse[T], error) {
+	paging = paging.Normalized()
+	query := r.inTenant(ctx, filter)
+
+	response := xpaging.PaginatedResponse[T]{Items: []T{}, PagingOptions: paging}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return response, ConvertMongoError(err, r.collection.Name(), "%v", query)
+	}
+	response.Total = total
+
+	opts := options.Find().
+		SetSort(ConvertSortOptionsToMongo(idField, xpaging.DirectionAsc, sort)).
+		SetSkip(paging.Offset).
+		SetLimit(paging.Limit)
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return response, ConvertMongoError(err, r.collection.Name(), "%v", query)
+	}
+
+	if err := cursor.All(ctx, &response.Items); err != nil {
+		return response, ConvertMongoError(err, r.collection.Name(), "%v", query)
+	}
+
+	return response, nil
+}
+
+// ListByCursor returns a page of the documents matching the filter in the tenant of the context, with keyset
+// pagination. See KeysetQuery.
+func (r *Repo[T]) ListByCursor(ctx context.Context, signer *xpaging.CursorSigner, filter bson.M, sort xpaging.SortOptions, cursorOptions xpaging.CursorOptions) (xpaging.CursorPaginatedResponse[T], error) {
+	return FindPage[T](ctx, r.collection, signer, r.inTenant(ctx, filter), sort, cursorOptions)
+}
+
+func (r *Repo[T]) byId(ctx context.Context, id ids.Id) bson.D {
+	return bson.D{
+		{Key: idField, Value: id},
+		{Key: tenantField, Value: xcontext.GetTenantOrDefault(ctx)},
+	}
+}
+
+// inTenant returns the filter restricted to the tenant of the context
+func (r *Repo[T]) inTenant(ctx context.Context, filter bson.M) bson.D {
+	query := bson.D{{Key: tenantField, Value: xcontext.GetTenantOrDefault(ctx)}}
+
+	if len(filter) > 0 {
+		query = append(query, bson.E{Key: "$and", Value: bson.A{filter}})
+	}
+
+	return query
+}
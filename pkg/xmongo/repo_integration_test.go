@@ -0,0 +1,137 @@
+//go:build integration
+
+package xmongo_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/entity"
+	"github.com/AltScore/gothic/v2/pkg/ids"
+	"github.com/AltScore/gothic/v2/pkg/xcontext"
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var mongoInMemory xmongo.MongoInMemory
+
+func TestMain(m *testing.M) {
+	mongoInMemory.Connect(xmongo.WithReplicaSet())
+	code := m.Run()
+	mongoInMemory.Disconnect()
+
+	os.Exit(code)
+}
+
+type client struct {
+	entity.Metadata `bson:",inline"`
+	Name            string `bson:"name"`
+}
+
+func newTestRepo(t *testing.T) *xmongo.Repo[*client] {
+	repo := xmongo.NewRepo[*client](mongoInMemory.Client().Database("test").Collection("clients-" + ids.New().String()))
+
+	t.Cleanup(func() { _ = repo.Collection().Drop(context.Background()) })
+
+	return repo
+}
+
+func inTenant(tenant string) context.Context {
+	return xcontext.WithTenant(context.Background(), tenant)
+}
+
+func TestRepo_saves_and_finds_documents_in_the_tenant(t *testing.T) {
+	// GIVEN a document saved in a tenant
+	repo := newTestRepo(t)
+	doc := &client{Name: "John"}
+
+	require.NoError(t, repo.Save(inTenant("a-tenant"), doc))
+
+	// WHEN it is found
+	found, err := repo.Find(inTenant("a-tenant"), doc.ID)
+
+	// THEN it is the first version, in the tenant
+	require.NoError(t, err)
+	require.Equal(t, "John", found.Name)
+	require.Equal(t, 1, found.Version)
+	require.Equal(t, "a-tenant", found.Tenant)
+
+	// AND it is not found in other tenants
+	_, err = repo.Find(inTenant("other-tenant"), doc.ID)
+	require.ErrorIs(t, err, xerrors.ErrNotFound)
+}
+
+func TestRepo_rejects_stale_versions(t *testing.T) {
+	// GIVEN a document loaded twice
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	doc := &client{Name: "John"}
+	require.NoError(t, repo.Save(ctx, doc))
+
+	first, err := repo.Find(ctx, doc.ID)
+	require.NoError(t, err)
+	second, err := repo.Find(ctx, doc.ID)
+	require.NoError(t, err)
+
+	// WHEN both copies are saved
+	first.Name = "Jane"
+	require.NoError(t, repo.Save(ctx, first))
+
+	second.Name = "Joe"
+	err = repo.Save(ctx, second)
+
+	// THEN the second one fails, keeping its version
+	require.ErrorIs(t, err, xerrors.ErrConditionNotMet)
+	require.Equal(t, 1, second.Version)
+
+	found, err := repo.Find(ctx, doc.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Jane", found.Name)
+	require.Equal(t, 2, found.Version)
+
+	// AND inserting it again fails too
+	require.ErrorIs(t, repo.Save(ctx, &client{Metadata: entity.New(entity.WithId(doc.ID)), Name: "Copy"}), xerrors.ErrConditionNotMet)
+}
+
+func TestRepo_lists_pages_of_documents_in_the_tenant(t *testing.T) {
+	// GIVEN 3 documents in a tenant and one in other
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+
+	for _, name := range []string{"Ann", "Bob", "Carl"} {
+		require.NoError(t, repo.Save(ctx, &client{Name: name}))
+	}
+	require.NoError(t, repo.Save(inTenant("other-tenant"), &client{Name: "Dan"}))
+
+	// WHEN the second page is listed sorted by name
+	page, err := repo.List(ctx, bson.M{"name": bson.M{"$ne": "Carl"}}, xpaging.SortOptions{xpaging.NewSortEntry("name", xpaging.DirectionDesc)}, xpaging.PagingOptions{Offset: 1, Limit: 1})
+
+	// THEN only the documents of the tenant matching the filter are counted
+	require.NoError(t, err)
+	require.Equal(t, int64(2), page.Total)
+	require.Len(t, page.Items, 1)
+	require.Equal(t, "Ann", page.Items[0].Name)
+}
+
+func TestRepo_deletes_documents_in_the_tenant(t *testing.T) {
+	// GIVEN a document
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	doc := &client{Name: "John"}
+	require.NoError(t, repo.Save(ctx, doc))
+
+	// WHEN it is deleted from another tenant
+	err := repo.Delete(inTenant("other-tenant"), doc.ID)
+
+	// THEN it is not found
+	require.ErrorIs(t, err, xerrors.ErrNotFound)
+
+	// AND it can be deleted from its tenant
+	require.NoError(t, repo.Delete(ctx, doc.ID))
+	_, err = repo.Find(ctx, doc.ID)
+	require.ErrorIs(t, err, xerrors.ErrNotFound)
+}
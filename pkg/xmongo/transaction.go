@@ -0,0 +1,163 @@
+package xmongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultTransactionAttempts = 5
+
+type transactionConfig struct {
+	maxAttempts int
+	options     *options.TransactionOptions
+}
+
+// TransactionOption configures WithTransaction
+type TransactionOption func(*transactionConfig)
+
+// WithTransactionAttempts sets how many times the transaction is run when it fails with a transient error.
+// Default is 5.
+func WithTransactionAttempts(maxAttempts int) TransactionOption {
+	return func(c *transactionConfig) {
+		c.maxAttempts = maxAttempts
+	}
+}
+
+// WithTransactionOptions sets the read concern, write concern and read preference of the transaction
+func WithTransactionOptions(opts *options.TransactionOptions) TransactionOption {
+	return func(c *transactionConfig) {
+		c.options = opts
+	}
+}
+
+// WithTransaction runs fn in a transaction of a new session of the client, committing it if fn returns nil and
+// aborting it otherwise.
+//
+// The context given to fn carries the session, so the operations done with it by any repository join the
+// transaction. If ctx already carries a session, fn joins that transaction, and the outer call commits it.
+//
+// When fn or the commit fail with a TransientTransactionError, the whole transaction is run again, so fn must not
+// have side effects outside the database. When the commit fails with an UnknownTransactionCommitResult, only the
+// commit is retried. Mongo errors are converted with ConvertMongoError, other errors of fn are returned as is.
+//
+// When the transaction fails, the metadata of the documents saved by a Repo in fn is restored as before the
+// transaction, so fn can save them again when it is run again. Other changes fn did to the documents are kept.
+func WithTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error, opts ...TransactionOption) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	config := transactionConfig{maxAttempts: defaultTransactionAttempts}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return ConvertMongoError(err, "transaction", "start session")
+	}
+	defer session.EndSession(ctx)
+
+	touched := &touchedDocuments{}
+	sessionCtx := mongo.NewSessionContext(context.WithValue(ctx, touchedDocumentsKey{}, touched), session)
+
+	err = retryTransient(ctx, config.maxAttempts, func() error {
+		err := runTransaction(sessionCtx, config, fn)
+		if err != nil {
+			touched.restore()
+		}
+		return err
+	})
+
+	return convertTransactionError(err)
+}
+
+type touchedDocumentsKey struct{}
+
+// touchedDocuments keeps how to restore the documents saved in a transaction, in the order they were saved
+type touchedDocuments struct {
+	restores []func()
+	lock     sync.Mutex
+}
+
+// onTransactionFailed registers restore to be called if the transaction of the context fails.
+// It does nothing outside a transaction started by WithTransaction.
+func onTransactionFailed(ctx context.Context, restore func()) {
+	touched, ok := ctx.Value(touchedDocumentsKey{}).(*touchedDocuments)
+	if !ok {
+		return
+	}
+
+	touched.lock.Lock()
+	defer touched.lock.Unlock()
+
+	touched.restores = append(touched.restores, restore)
+}
+
+// restore restores the documents in reverse order, so a document saved many times gets its first metadata
+func (t *touchedDocuments) restore() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i := len(t.restores) - 1; i >= 0; i-- {
+		t.restores[i]()
+	}
+	t.restores = nil
+}
+
+// retryTransient calls run until it does not fail with a transient transaction error, up to max attempts
+func retryTransient(ctx context.Context, maxAttempts int, run func() error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = run()
+
+		if err == nil || !isTransientTransactionError(err) || attempt >= maxAttempts || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func runTransaction(ctx mongo.SessionContext, config transactionConfig, fn func(ctx context.Context) error) error {
+	if err := ctx.StartTransaction(config.options); err != nil {
+		return err
+	}
+
+	if err := fn(ctx); err != nil {
+		_ = ctx.AbortTransaction(ctx)
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := ctx.CommitTransaction(ctx)
+		if err == nil || !hasErrorLabel(err, labelUnknownTransactionCommit) || mongo.IsTimeout(err) || attempt >= config.maxAttempts {
+			return err
+		}
+	}
+}
+
+// isTransientTransactionError returns true if the error is a TransientTransactionError of mongo,
+// or it was already converted by ConvertMongoError
+func isTransientTransactionError(err error) bool {
+	return hasErrorLabel(err, labelTransientTransaction) || errors.Is(err, xerrors.ErrTransientTransaction)
+}
+
+// convertTransactionError converts the mongo errors, keeping the errors already converted and the application ones
+func convertTransactionError(err error) error {
+	var serverError mongo.ServerError
+	var httpError xerrors.HttpError
+
+	switch {
+	case err == nil || errors.As(err, &httpError):
+		return err
+	case errors.As(err, &serverError) || errors.Is(err, mongo.ErrNoDocuments) || mongo.IsTimeout(err) || mongo.IsNetworkError(err):
+		return ConvertMongoError(err, "mongo", "transaction")
+	default:
+		return err
+	}
+}
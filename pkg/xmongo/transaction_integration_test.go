@@ -0,0 +1,170 @@
+//go:build integration
+
+package xmongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xmongo"
+	"github.com/AltScore/gothic/v2/pkg/xpaging"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWithTransaction_commits_writes_of_repositories(t *testing.T) {
+	// GIVEN two documents
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	first, second := &client{Name: "Ann"}, &client{Name: "Bob"}
+
+	// WHEN they are saved in a transaction
+	err := xmongo.WithTransaction(ctx, mongoInMemory.Client(), func(ctx context.Context) error {
+		if err := repo.Save(ctx, first); err != nil {
+			return err
+		}
+		return repo.Save(ctx, second)
+	})
+
+	// THEN both are stored
+	require.NoError(t, err)
+
+	page, err := repo.List(ctx, nil, nil, xpaging.PagingOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), page.Total)
+}
+
+func TestWithTransaction_aborts_on_error(t *testing.T) {
+	// GIVEN a transaction failing after saving a document
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	doc := &client{Name: "Ann"}
+	appErr := errors.New("insufficient funds")
+
+	// WHEN it runs
+	err := xmongo.WithTransaction(ctx, mongoInMemory.Client(), func(ctx context.Context) error {
+		if err := repo.Save(ctx, doc); err != nil {
+			return err
+		}
+
+		// AND a nested transaction joins it
+		return xmongo.WithTransaction(ctx, mongoInMemory.Client(), func(context.Context) error {
+			return appErr
+		})
+	})
+
+	// THEN the error is returned as is, and the document is not stored
+	require.Equal(t, appErr, err)
+
+	_, err = repo.Find(ctx, doc.ID)
+	require.ErrorIs(t, err, xerrors.ErrNotFound)
+}
+
+func TestWithTransaction_retries_write_conflicts(t *testing.T) {
+	// GIVEN a stored document
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	doc := &client{Name: "Ann"}
+	require.NoError(t, repo.Save(ctx, doc))
+
+	attempts := 0
+
+	// WHEN a transaction reads it, and it is updated outside the transaction before the transaction updates it
+	err := xmongo.WithTransaction(ctx, mongoInMemory.Client(), func(txCtx context.Context) error {
+		attempts++
+
+		if _, err := repo.Find(txCtx, doc.ID); err != nil {
+			return err
+		}
+
+		if attempts == 1 {
+			_, err := repo.Collection().UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"name": "Outside"}})
+			require.NoError(t, err)
+		}
+
+		_, err := repo.Collection().UpdateOne(txCtx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"name": "Inside"}})
+		return err
+	})
+
+	// THEN the transaction is run again
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+
+	found, err := repo.Find(ctx, doc.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Inside", found.Name)
+}
+
+func TestWithTransaction_retries_saves_of_the_same_document(t *testing.T) {
+	// GIVEN a stored document
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	doc := &client{Name: "Ann"}
+	require.NoError(t, repo.Save(ctx, doc))
+
+	attempts := 0
+
+	// WHEN a transaction saves it, and it is updated outside the transaction before the first save
+	err := xmongo.WithTransaction(ctx, mongoInMemory.Client(), func(txCtx context.Context) error {
+		attempts++
+
+		if _, err := repo.Find(txCtx, doc.ID); err != nil {
+			return err
+		}
+
+		if attempts == 1 {
+			_, err := repo.Collection().UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"name": "Outside"}})
+			require.NoError(t, err)
+		}
+
+		doc.Name = "Inside"
+		return repo.Save(txCtx, doc)
+	})
+
+	// THEN the save is retried from the version of the document
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, 2, doc.Version)
+
+	found, err := repo.Find(ctx, doc.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Inside", found.Name)
+	require.Equal(t, 2, found.Version)
+}
+
+func TestWithTransaction_restores_saved_documents_when_a_later_step_fails(t *testing.T) {
+	// GIVEN a stored document
+	ctx := inTenant("a-tenant")
+	repo := newTestRepo(t)
+	doc := &client{Name: "Ann"}
+	require.NoError(t, repo.Save(ctx, doc))
+
+	attempts := 0
+
+	// WHEN a transaction saves it, and a later step fails with a transient error in the first attempt
+	err := xmongo.WithTransaction(ctx, mongoInMemory.Client(), func(txCtx context.Context) error {
+		attempts++
+
+		doc.Name = "Inside"
+		if err := repo.Save(txCtx, doc); err != nil {
+			return err
+		}
+
+		if attempts == 1 {
+			return xerrors.NewTransientTransactionError("client", "lost primary", "%s", doc.ID)
+		}
+		return nil
+	})
+
+	// THEN the save is retried from the version before the transaction
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, 2, doc.Version)
+
+	found, err := repo.Find(ctx, doc.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Inside", found.Name)
+	require.Equal(t, 2, found.Version)
+}
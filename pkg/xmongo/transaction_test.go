@@ -0,0 +1,94 @@
+package xmongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRetryTransient_retries_transient_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{
+			name:  "mongo transient error",
+			err:   mongo.CommandError{Code: 112, Labels: []string{"TransientTransactionError"}},
+			calls: 3,
+		},
+		{
+			name:  "converted transient error",
+			err:   xerrors.NewTransientTransactionError("client", "write conflict", "%s", "an-id"),
+			calls: 3,
+		},
+		{
+			name:  "other error",
+			err:   errors.New("invalid client"),
+			calls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+
+			err := retryTransient(context.Background(), 3, func() error {
+				calls++
+				return tt.err
+			})
+
+			require.Equal(t, tt.err, err)
+			require.Equal(t, tt.calls, calls)
+		})
+	}
+}
+
+func TestRetryTransient_stops_when_succeeds(t *testing.T) {
+	calls := 0
+
+	err := retryTransient(context.Background(), 5, func() error {
+		calls++
+		if calls < 2 {
+			return mongo.CommandError{Labels: []string{"TransientTransactionError"}}
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+}
+
+func TestConvertTransactionError_keeps_application_errors(t *testing.T) {
+	appErr := errors.New("insufficient funds")
+	converted := xerrors.NewNotFoundError("client", "%s", "an-id")
+
+	require.Equal(t, appErr, convertTransactionError(appErr))
+	require.Equal(t, converted, convertTransactionError(converted))
+	require.ErrorIs(t, convertTransactionError(mongo.CommandError{Code: 112}), xerrors.ErrWriteConflict)
+}
+
+func TestTouchedDocuments_restores_in_reverse_order(t *testing.T) {
+	// GIVEN a document saved twice in a transaction
+	touched := &touchedDocuments{}
+	ctx := context.WithValue(context.Background(), touchedDocumentsKey{}, touched)
+
+	version := 1
+	onTransactionFailed(ctx, func() { version = 1 })
+	onTransactionFailed(ctx, func() { version = 2 })
+	version = 3
+
+	// WHEN the transaction fails
+	touched.restore()
+
+	// THEN the document gets the version before the transaction
+	require.Equal(t, 1, version)
+	require.Empty(t, touched.restores)
+
+	// AND nothing is registered outside a transaction
+	onTransactionFailed(context.Background(), func() { version = 0 })
+	require.Equal(t, 1, version)
+}
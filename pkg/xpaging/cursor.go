@@ -0,0 +1,87 @@
+package xpaging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/AltScore/gothic/v2/pkg/xvalidator"
+)
+
+// CursorOptions are the options of a keyset paginated listing. Cursor is the NextCursor or PrevCursor of the page
+// returned before, empty for the first page.
+type CursorOptions struct {
+	Cursor string `query:"cursor" json:"cursor,omitempty"`
+	Limit  int64  `query:"limit"  json:"limit" validate:"min=0,max=100"`
+}
+
+func (co CursorOptions) Validate() error {
+	return xvalidator.Struct(co)
+}
+
+// Normalized returns the options with the limit normalized as in PagingOptions
+func (co CursorOptions) Normalized() CursorOptions {
+	return CursorOptions{
+		Cursor: co.Cursor,
+		Limit:  PagingOptions{Limit: co.Limit}.Normalized().Limit,
+	}
+}
+
+// CursorPaginatedResponse is a page of a keyset paginated listing. The cursors are empty when there are no more
+// items in that direction.
+type CursorPaginatedResponse[C any] struct {
+	Items      []C    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// CursorSigner signs the cursor tokens, so clients cannot forge them to read other positions or inject values in
+// the queries. Tokens are opaque to the clients.
+type CursorSigner struct {
+	key []byte
+}
+
+// NewCursorSigner creates a new CursorSigner with the secret key
+func NewCursorSigner(key []byte) *CursorSigner {
+	xerrors.EnsureNotEmpty(key, "key")
+
+	return &CursorSigner{key: key}
+}
+
+// Sign returns the token with the payload and its signature
+func (s *CursorSigner) Sign(payload []byte) string {
+	encoding := base64.RawURLEncoding
+
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(s.signature(payload))
+}
+
+// Verify returns the payload of the token. Returns an invalid argument error if the token was not signed with the
+// key of this signer.
+func (s *CursorSigner) Verify(token string) ([]byte, error) {
+	encoding := base64.RawURLEncoding
+
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, xerrors.NewInvalidArgumentError("cursor", "malformed")
+	}
+
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, xerrors.NewInvalidArgumentError("cursor", "malformed")
+	}
+
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, s.signature(payload)) {
+		return nil, xerrors.NewInvalidArgumentError("cursor", "invalid signature")
+	}
+
+	return payload, nil
+}
+
+func (s *CursorSigner) signature(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,49 @@
+package xpaging
+
+import (
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xerrors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorSigner_verifies_signed_tokens(t *testing.T) {
+	// GIVEN a signed token
+	signer := NewCursorSigner([]byte("secret"))
+	token := signer.Sign([]byte("position"))
+
+	// WHEN it is verified
+	payload, err := signer.Verify(token)
+
+	// THEN the payload is returned
+	require.NoError(t, err)
+	require.Equal(t, []byte("position"), payload)
+}
+
+func TestCursorSigner_rejects_forged_tokens(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	token := signer.Sign([]byte("position"))
+	other := NewCursorSigner([]byte("other secret")).Sign([]byte("position"))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "position"},
+		{name: "tampered payload", token: "X" + token},
+		{name: "signed with other key", token: other},
+		{name: "without signature", token: token[:len(token)-10]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signer.Verify(tt.token)
+
+			require.ErrorIs(t, err, xerrors.ErrInvalidArgument)
+		})
+	}
+}
+
+func TestCursorOptions_Normalized(t *testing.T) {
+	require.Equal(t, CursorOptions{Cursor: "c", Limit: 10}, CursorOptions{Cursor: "c"}.Normalized())
+	require.Equal(t, CursorOptions{Limit: 100}, CursorOptions{Limit: 500}.Normalized())
+}
@@ -0,0 +1,16 @@
+package xehtest
+
+import (
+	"testing"
+
+	"github.com/AltScore/gothic/v2/pkg/xeh"
+	"github.com/stretchr/testify/require"
+)
+
+// RequireCompleteUpcasters asserts that every event type in the registry has the upcasters from version 1
+// up to its current version. Use it in a test of the service registering the upcasters.
+func RequireCompleteUpcasters(t testing.TB, registry *xeh.UpcasterRegistry) {
+	t.Helper()
+
+	require.NoError(t, registry.Validate(), "upcaster chains are incomplete")
+}